@@ -63,6 +63,118 @@ func SecSIPIDGetIdentityPrvKey(origTN *C.char, destTN *C.char, attestVal *C.char
 	return C.int(len(signature))
 }
 
+// SecSIPIDGetIdentityMulti --
+// Generate the Identity header content for a call to several destinations
+// (e.g., forked or group calls) using the input attributes
+// * origTN - calling number
+// * destTNs - called numbers, separated by comma
+// * attestVal - attestation level
+// * origID - unique ID for tracking purposes, if empty string a UUID is generated
+// * x5uVal - location of public certificate
+// * prvkeyPath - path to private key to be used to generate the signature
+// * outPtr - to be set to the pointer containing the output (it is a
+//   0-terminated string); the `*outPtr` must be freed after use
+// * return: the length of `*outPtr` on success or error return code (< 0)
+//export SecSIPIDGetIdentityMulti
+func SecSIPIDGetIdentityMulti(origTN *C.char, destTNs *C.char, attestVal *C.char, origID *C.char, x5uVal *C.char, prvkeyPath *C.char, outPtr **C.char) C.int {
+	signature, ret, _ := secsipid.SJWTGetIdentityMulti(C.GoString(origTN), secsipid.SJWTParseTNList(C.GoString(destTNs)), C.GoString(attestVal), C.GoString(origID), C.GoString(x5uVal), C.GoString(prvkeyPath))
+	*outPtr = C.CString(signature)
+	if ret < 0 {
+		return C.int(ret)
+	}
+	return C.int(len(signature))
+}
+
+// SecSIPIDGetIdentityMultiPrvKey --
+// Generate the Identity header content for a call to several destinations
+// using the input attributes
+// * origTN - calling number
+// * destTNs - called numbers, separated by comma
+// * attestVal - attestation level
+// * origID - unique ID for tracking purposes, if empty string a UUID is generated
+// * x5uVal - location of public certificate
+// * prvkeyData - content of private key to be used to generate the signature
+// * outPtr - to be set to the pointer containing the output (it is a
+//   0-terminated string); the `*outPtr` must be freed after use
+// * return: the length of `*outPtr` on success or error return code (< 0)
+//export SecSIPIDGetIdentityMultiPrvKey
+func SecSIPIDGetIdentityMultiPrvKey(origTN *C.char, destTNs *C.char, attestVal *C.char, origID *C.char, x5uVal *C.char, prvkeyData *C.char, outPtr **C.char) C.int {
+	signature, ret, _ := secsipid.SJWTGetIdentityMultiPrvKey(C.GoString(origTN), secsipid.SJWTParseTNList(C.GoString(destTNs)), C.GoString(attestVal), C.GoString(origID), C.GoString(x5uVal), []byte(C.GoString(prvkeyData)))
+	*outPtr = C.CString(signature)
+	if ret < 0 {
+		return C.int(ret)
+	}
+	return C.int(len(signature))
+}
+
+// SecSIPIDGetIdentityURI --
+// Generate the Identity header content using the input attributes, with
+// support for SIP URI identities
+// * origTN - calling number (empty string if not used)
+// * origURI - calling SIP URI (empty string if not used)
+// * destTN - called number (empty string if not used)
+// * destURI - called SIP URI (empty string if not used)
+// * attestVal - attestation level
+// * origID - unique ID for tracking purposes, if empty string a UUID is generated
+// * x5uVal - location of public certificate
+// * prvkeyPath - path to private key to be used to generate the signature
+// * outPtr - to be set to the pointer containing the output (it is a
+//   0-terminated string); the `*outPtr` must be freed after use
+// * return: the length of `*outPtr` on success or error return code (< 0)
+//export SecSIPIDGetIdentityURI
+func SecSIPIDGetIdentityURI(origTN *C.char, origURI *C.char, destTN *C.char, destURI *C.char, attestVal *C.char, origID *C.char, x5uVal *C.char, prvkeyPath *C.char, outPtr **C.char) C.int {
+	opts := cIdentityURIOptions(origTN, origURI, destTN, destURI, attestVal, origID, x5uVal)
+	signature, ret, _ := secsipid.SJWTGetIdentityOpts(opts, C.GoString(prvkeyPath))
+	*outPtr = C.CString(signature)
+	if ret < 0 {
+		return C.int(ret)
+	}
+	return C.int(len(signature))
+}
+
+// SecSIPIDGetIdentityURIPrvKey --
+// Generate the Identity header content using the input attributes, with
+// support for SIP URI identities
+// * origTN - calling number (empty string if not used)
+// * origURI - calling SIP URI (empty string if not used)
+// * destTN - called number (empty string if not used)
+// * destURI - called SIP URI (empty string if not used)
+// * attestVal - attestation level
+// * origID - unique ID for tracking purposes, if empty string a UUID is generated
+// * x5uVal - location of public certificate
+// * prvkeyData - content of private key to be used to generate the signature
+// * outPtr - to be set to the pointer containing the output (it is a
+//   0-terminated string); the `*outPtr` must be freed after use
+// * return: the length of `*outPtr` on success or error return code (< 0)
+//export SecSIPIDGetIdentityURIPrvKey
+func SecSIPIDGetIdentityURIPrvKey(origTN *C.char, origURI *C.char, destTN *C.char, destURI *C.char, attestVal *C.char, origID *C.char, x5uVal *C.char, prvkeyData *C.char, outPtr **C.char) C.int {
+	opts := cIdentityURIOptions(origTN, origURI, destTN, destURI, attestVal, origID, x5uVal)
+	signature, ret, _ := secsipid.SJWTGetIdentityPrvKeyOpts(opts, []byte(C.GoString(prvkeyData)))
+	*outPtr = C.CString(signature)
+	if ret < 0 {
+		return C.int(ret)
+	}
+	return C.int(len(signature))
+}
+
+// cIdentityURIOptions - build the PASSporT attributes from C parameters
+func cIdentityURIOptions(origTN *C.char, origURI *C.char, destTN *C.char, destURI *C.char, attestVal *C.char, origID *C.char, x5uVal *C.char) secsipid.SJWTIdentityOptions {
+	opts := secsipid.SJWTIdentityOptions{
+		OrigTN:  C.GoString(origTN),
+		OrigURI: C.GoString(origURI),
+		Attest:  C.GoString(attestVal),
+		OrigID:  C.GoString(origID),
+		X5u:     C.GoString(x5uVal),
+	}
+	if sDestTN := C.GoString(destTN); len(sDestTN) > 0 {
+		opts.DestTNs = []string{sDestTN}
+	}
+	if sDestURI := C.GoString(destURI); len(sDestURI) > 0 {
+		opts.DestURIs = []string{sDestURI}
+	}
+	return opts
+}
+
 // SecSIPIDCheck --
 // check the Identity header value
 // * identityVal - identity header value
@@ -105,6 +217,93 @@ func SecSIPIDCheckFull(identityVal *C.char, identityLen C.int, expireVal C.int,
 	return C.int(ret)
 }
 
+// SecSIPIDCheckFullSIP --
+// check the Identity header value and its claims against the values of the
+// SIP request (orig against P-Asserted-Identity, or From without it, dest
+// against To and Request-URI, iat against Date)
+// * identityVal - identity header value with header parameters
+// * identityLen - length of identityVal, if it is 0, identityVal is expected
+//   to be 0-terminated
+// * expireVal - number of seconds until the validity is considered expired
+// * pubkeyPath - file path or URL to public key
+// * timeoutVal - timeout in seconds to try to fetch the public key via HTTP
+// * fromVal - From header value (empty string to skip)
+// * paiVal - P-Asserted-Identity header value (empty string to skip)
+// * toVal - To header value (empty string to skip)
+// * ruriVal - Request-URI (empty string to skip)
+// * dateVal - Date header value (empty string to skip)
+// * return: 0 - if validity is ok; <0 - on error or validity is not ok
+//export SecSIPIDCheckFullSIP
+func SecSIPIDCheckFullSIP(identityVal *C.char, identityLen C.int, expireVal C.int, pubkeyPath *C.char, timeoutVal C.int, fromVal *C.char, paiVal *C.char, toVal *C.char, ruriVal *C.char, dateVal *C.char) C.int {
+	var sIdentity string
+	if identityLen == 0 {
+		sIdentity = C.GoString(identityVal)
+	} else {
+		sIdentity = C.GoStringN(identityVal, identityLen)
+	}
+	res := secsipid.SJWTCheckFullIdentitySIPResult(sIdentity, int(expireVal), C.GoString(pubkeyPath), int(timeoutVal), secsipid.SJWTSIPHeaders{
+		From:       C.GoString(fromVal),
+		PAI:        C.GoString(paiVal),
+		To:         C.GoString(toVal),
+		RequestURI: C.GoString(ruriVal),
+		Date:       C.GoString(dateVal),
+	})
+	return C.int(res.ErrCode)
+}
+
+// SecSIPIDCheckSIPMessage --
+// check the Identity header of the SIP message and its claims against the
+// headers of the message
+// * msgVal - the SIP message
+// * msgLen - length of msgVal, if it is 0, msgVal is expected to be
+//   0-terminated
+// * expireVal - number of seconds until the validity is considered expired
+// * pubkeyPath - file path or URL to public key
+// * timeoutVal - timeout in seconds to try to fetch the public key via HTTP
+// * return: 0 - if validity is ok; <0 - on error or validity is not ok
+//export SecSIPIDCheckSIPMessage
+func SecSIPIDCheckSIPMessage(msgVal *C.char, msgLen C.int, expireVal C.int, pubkeyPath *C.char, timeoutVal C.int) C.int {
+	var sMsg string
+	if msgLen == 0 {
+		sMsg = C.GoString(msgVal)
+	} else {
+		sMsg = C.GoStringN(msgVal, msgLen)
+	}
+	res := secsipid.SJWTCheckSIPMessageResult([]byte(sMsg), int(expireVal), C.GoString(pubkeyPath), int(timeoutVal))
+	return C.int(res.ErrCode)
+}
+
+// SecSIPIDCheckSIPMessagePolicy --
+// check all the Identity headers of the SIP message, each one with the public
+// key from its info parameter if pubkeyPath is empty, against the headers of
+// the message, and return the verdict of the policy
+// * msgVal - the SIP message
+// * msgLen - length of msgVal, if it is 0, msgVal is expected to be
+//   0-terminated
+// * expireVal - number of seconds until the validity is considered expired
+// * pubkeyPath - file path or URL to public key (empty string to use the info
+//   parameters)
+// * timeoutVal - timeout in seconds to try to fetch the public key via HTTP
+// * policyVal - "any", "all" or comma separated list of the PASSporT types
+//   with at least one valid Identity header (empty string for "shaken")
+// * return: 0 - if the policy is satisfied; <0 - on error or the policy is
+//   not satisfied
+//export SecSIPIDCheckSIPMessagePolicy
+func SecSIPIDCheckSIPMessagePolicy(msgVal *C.char, msgLen C.int, expireVal C.int, pubkeyPath *C.char, timeoutVal C.int, policyVal *C.char) C.int {
+	var sMsg string
+	if msgLen == 0 {
+		sMsg = C.GoString(msgVal)
+	} else {
+		sMsg = C.GoStringN(msgVal, msgLen)
+	}
+	policy, ret, err := secsipid.SJWTParseIdentityPolicy(C.GoString(policyVal))
+	if err != nil {
+		return C.int(ret)
+	}
+	res := secsipid.SJWTCheckSIPMessageIdentities([]byte(sMsg), int(expireVal), C.GoString(pubkeyPath), int(timeoutVal), policy)
+	return C.int(res.ErrCode)
+}
+
 // SecSIPIDCheckFullPubKey --
 // check the Identity header value
 // * identityVal - identity header value with header parameters
@@ -196,5 +395,75 @@ func SecSIPIDOptSetV(optNameVal *C.char) C.int {
 	return C.int(ret)
 }
 
+// SecSIPIDGetSIPResponse --
+// get the SIP response code and reason phrase for a verification failure
+// * errCode - the error code returned by a check function
+// * outPtr - to be set to the pointer containing the reason phrase (it is a
+//   0-terminated string); the `*outPtr` must be freed after use
+// * return: the SIP response code (428, 436, 437, 438, ...) or 0 if errCode
+//   is 0 (in this case `*outPtr` is not set)
+//export SecSIPIDGetSIPResponse
+func SecSIPIDGetSIPResponse(errCode C.int, outPtr **C.char) C.int {
+	code, text := secsipid.SJWTGetSIPResponse(int(errCode))
+	if code == 0 {
+		return C.int(0)
+	}
+	*outPtr = C.CString(text)
+	return C.int(code)
+}
+
+// SecSIPIDGetReasonHeader --
+// get the Reason header for a verification failure
+// * errCode - the error code returned by a check function
+// * outPtr - to be set to the pointer containing the header, like
+//   `Reason: STIR;cause=438;text="Invalid Identity Header"` (it is a
+//   0-terminated string, without ending CRLF); the `*outPtr` must be freed
+//   after use
+// * return: the length of `*outPtr` or 0 if errCode is 0 (in this case
+//   `*outPtr` is not set)
+//export SecSIPIDGetReasonHeader
+func SecSIPIDGetReasonHeader(errCode C.int, outPtr **C.char) C.int {
+	hdr := secsipid.SJWTGetReasonHeader(int(errCode))
+	if len(hdr) == 0 {
+		return C.int(0)
+	}
+	*outPtr = C.CString(hdr)
+	return C.int(len(hdr))
+}
+
+// SecSIPIDGetVerstat --
+// get the verstat value for the result of a verification: TN-Validation-Passed
+// if errCode is 0, for any attestation level (it is reported separately in the
+// attest claim), No-TN-Validation for an empty Identity header, otherwise
+// TN-Validation-Failed
+// * errCode - the error code returned by a check function
+// * attestVal - the attestation level of the PASSporT (0-terminated string),
+//   it does not change the verstat value
+// * outPtr - to be set to the pointer containing the verstat value (it is a
+//   0-terminated string); the `*outPtr` must be freed after use
+// * return: the length of `*outPtr`
+//export SecSIPIDGetVerstat
+func SecSIPIDGetVerstat(errCode C.int, attestVal *C.char, outPtr **C.char) C.int {
+	verstat := secsipid.SJWTGetVerstat(int(errCode), C.GoString(attestVal))
+	*outPtr = C.CString(verstat)
+	return C.int(len(verstat))
+}
+
+// SecSIPIDSetVerstat --
+// add the verstat parameter to the URI of a From or P-Asserted-Identity
+// header value
+// * hdrVal - the value of the header, without the header name (0-terminated
+//   string)
+// * verstat - the verstat value (0-terminated string)
+// * outPtr - to be set to the pointer containing the new header value (it is
+//   a 0-terminated string); the `*outPtr` must be freed after use
+// * return: the length of `*outPtr`
+//export SecSIPIDSetVerstat
+func SecSIPIDSetVerstat(hdrVal *C.char, verstat *C.char, outPtr **C.char) C.int {
+	newVal := secsipid.SJWTSetVerstat(C.GoString(hdrVal), C.GoString(verstat))
+	*outPtr = C.CString(newVal)
+	return C.int(len(newVal))
+}
+
 //
 func main() {}
@@ -105,12 +105,73 @@ extern int SecSIPIDGetIdentity(char* origTN, char* destTN, char* attestVal, char
 // * return: the length of `*outPtr` on success or error return code (< 0)
 extern int SecSIPIDGetIdentityPrvKey(char* origTN, char* destTN, char* attestVal, char* origID, char* x5uVal, char* prvkeyData, char** outPtr);
 
+// SecSIPIDGetIdentityMulti --
+// Generate the Identity header content for a call to several destinations
+// (e.g., forked or group calls) using the input attributes
+// * origTN - calling number
+// * destTNs - called numbers, separated by comma
+// * attestVal - attestation level
+// * origID - unique ID for tracking purposes, if empty string a UUID is generated
+// * x5uVal - location of public certificate
+// * prvkeyPath - path to private key to be used to generate the signature
+// * outPtr - to be set to the pointer containing the output (it is a
+//   0-terminated string); the `*outPtr` must be freed after use
+// * return: the length of `*outPtr` on success or error return code (< 0)
+extern int SecSIPIDGetIdentityMulti(char* origTN, char* destTNs, char* attestVal, char* origID, char* x5uVal, char* prvkeyPath, char** outPtr);
+
+// SecSIPIDGetIdentityMultiPrvKey --
+// Generate the Identity header content for a call to several destinations
+// using the input attributes
+// * origTN - calling number
+// * destTNs - called numbers, separated by comma
+// * attestVal - attestation level
+// * origID - unique ID for tracking purposes, if empty string a UUID is generated
+// * x5uVal - location of public certificate
+// * prvkeyData - content of private key to be used to generate the signature
+// * outPtr - to be set to the pointer containing the output (it is a
+//   0-terminated string); the `*outPtr` must be freed after use
+// * return: the length of `*outPtr` on success or error return code (< 0)
+extern int SecSIPIDGetIdentityMultiPrvKey(char* origTN, char* destTNs, char* attestVal, char* origID, char* x5uVal, char* prvkeyData, char** outPtr);
+
+// SecSIPIDGetIdentityURI --
+// Generate the Identity header content using the input attributes, with
+// support for SIP URI identities
+// * origTN - calling number (empty string if not used)
+// * origURI - calling SIP URI (empty string if not used)
+// * destTN - called number (empty string if not used)
+// * destURI - called SIP URI (empty string if not used)
+// * attestVal - attestation level
+// * origID - unique ID for tracking purposes, if empty string a UUID is generated
+// * x5uVal - location of public certificate
+// * prvkeyPath - path to private key to be used to generate the signature
+// * outPtr - to be set to the pointer containing the output (it is a
+//   0-terminated string); the `*outPtr` must be freed after use
+// * return: the length of `*outPtr` on success or error return code (< 0)
+extern int SecSIPIDGetIdentityURI(char* origTN, char* origURI, char* destTN, char* destURI, char* attestVal, char* origID, char* x5uVal, char* prvkeyPath, char** outPtr);
+
+// SecSIPIDGetIdentityURIPrvKey --
+// Generate the Identity header content using the input attributes, with
+// support for SIP URI identities
+// * origTN - calling number (empty string if not used)
+// * origURI - calling SIP URI (empty string if not used)
+// * destTN - called number (empty string if not used)
+// * destURI - called SIP URI (empty string if not used)
+// * attestVal - attestation level
+// * origID - unique ID for tracking purposes, if empty string a UUID is generated
+// * x5uVal - location of public certificate
+// * prvkeyData - content of private key to be used to generate the signature
+// * outPtr - to be set to the pointer containing the output (it is a
+//   0-terminated string); the `*outPtr` must be freed after use
+// * return: the length of `*outPtr` on success or error return code (< 0)
+extern int SecSIPIDGetIdentityURIPrvKey(char* origTN, char* origURI, char* destTN, char* destURI, char* attestVal, char* origID, char* x5uVal, char* prvkeyData, char** outPtr);
+
 // SecSIPIDCheck --
 // check the Identity header value
 // * identityVal - identity header value
 // * identityLen - length of identityVal, if is 0, identityVal is expected
 //   to be 0-terminated
 // * expireVal - number of seconds until the validity is considered expired
+//   (0 - default of 60 seconds)
 // * pubkeyPath - file path or URL to public key
 // * timeoutVal - timeout in seconds to try to fetch the public key via HTTP
 // * return: 0 - if validity is ok; <0 - on error or validity is not ok
@@ -122,17 +183,69 @@ extern int SecSIPIDCheck(char* identityVal, int identityLen, int expireVal, char
 // * identityLen - length of identityVal, if it is 0, identityVal is expected
 //   to be 0-terminated
 // * expireVal - number of seconds until the validity is considered expired
+//   (0 - default of 60 seconds)
 // * pubkeyPath - file path or URL to public key
 // * timeoutVal - timeout in seconds to try to fetch the public key via HTTP
 // * return: 0 - if validity is ok; <0 - on error or validity is not ok
 extern int SecSIPIDCheckFull(char* identityVal, int identityLen, int expireVal, char* pubkeyPath, int timeoutVal);
 
+// SecSIPIDCheckFullSIP --
+// check the Identity header value and its claims against the values of the
+// SIP request (orig against P-Asserted-Identity, or From without it, dest
+// against To and Request-URI, iat against Date)
+// * identityVal - identity header value with header parameters
+// * identityLen - length of identityVal, if it is 0, identityVal is expected
+//   to be 0-terminated
+// * expireVal - number of seconds until the validity is considered expired
+//   (0 - default of 60 seconds)
+// * pubkeyPath - file path or URL to public key
+// * timeoutVal - timeout in seconds to try to fetch the public key via HTTP
+// * fromVal - From header value (empty string to skip)
+// * paiVal - P-Asserted-Identity header value (empty string to skip)
+// * toVal - To header value (empty string to skip)
+// * ruriVal - Request-URI (empty string to skip)
+// * dateVal - Date header value (empty string to skip)
+// * return: 0 - if validity is ok; <0 - on error or validity is not ok
+extern int SecSIPIDCheckFullSIP(char* identityVal, int identityLen, int expireVal, char* pubkeyPath, int timeoutVal, char* fromVal, char* paiVal, char* toVal, char* ruriVal, char* dateVal);
+
+// SecSIPIDCheckSIPMessage --
+// check the Identity header of the SIP message and its claims against the
+// headers of the message
+// * msgVal - the SIP message
+// * msgLen - length of msgVal, if it is 0, msgVal is expected to be
+//   0-terminated
+// * expireVal - number of seconds until the validity is considered expired
+//   (0 - default of 60 seconds)
+// * pubkeyPath - file path or URL to public key
+// * timeoutVal - timeout in seconds to try to fetch the public key via HTTP
+// * return: 0 - if validity is ok; <0 - on error or validity is not ok
+extern int SecSIPIDCheckSIPMessage(char* msgVal, int msgLen, int expireVal, char* pubkeyPath, int timeoutVal);
+
+// SecSIPIDCheckSIPMessagePolicy --
+// check all the Identity headers of the SIP message, each one with the public
+// key from its info parameter if pubkeyPath is empty, against the headers of
+// the message, and return the verdict of the policy
+// * msgVal - the SIP message
+// * msgLen - length of msgVal, if it is 0, msgVal is expected to be
+//   0-terminated
+// * expireVal - number of seconds until the validity is considered expired
+//   (0 - default of 60 seconds)
+// * pubkeyPath - file path or URL to public key (empty string to use the info
+//   parameters)
+// * timeoutVal - timeout in seconds to try to fetch the public key via HTTP
+// * policyVal - "any", "all" or comma separated list of the PASSporT types
+//   with at least one valid Identity header (empty string for "shaken")
+// * return: 0 - if the policy is satisfied; <0 - on error or the policy is
+//   not satisfied
+extern int SecSIPIDCheckSIPMessagePolicy(char* msgVal, int msgLen, int expireVal, char* pubkeyPath, int timeoutVal, char* policyVal);
+
 // SecSIPIDCheckFullPubKey --
 // check the Identity header value
 // * identityVal - identity header value with header parameters
 // * identityLen - length of identityVal, if it is 0, identityVal is expected
 //   to be 0-terminated
 // * expireVal - number of seconds until the validity is considered expired
+//   (0 - default of 60 seconds)
 // * pubkeyVal - the value of the public key
 // * pubkeyLen - the length of the public key, if it is 0, then the pubkeyVal
 //   is expected to be 0-terminated
@@ -176,6 +289,50 @@ extern int SecSIPIDOptSetN(char* optName, int optVal);
 // * 0 if option was set, -1 otherwise
 extern int SecSIPIDOptSetV(char* optNameVal);
 
+// SecSIPIDGetSIPResponse --
+// get the SIP response code and reason phrase for a verification failure
+// * errCode - the error code returned by a check function
+// * outPtr - to be set to the pointer containing the reason phrase (it is a
+//   0-terminated string); the `*outPtr` must be freed after use
+// * return: the SIP response code (428, 436, 437, 438, ...) or 0 if errCode
+//   is 0 (in this case `*outPtr` is not set)
+extern int SecSIPIDGetSIPResponse(int errCode, char** outPtr);
+
+// SecSIPIDGetReasonHeader --
+// get the Reason header for a verification failure
+// * errCode - the error code returned by a check function
+// * outPtr - to be set to the pointer containing the header, like
+//   `Reason: STIR;cause=438;text="Invalid Identity Header"` (it is a
+//   0-terminated string, without ending CRLF); the `*outPtr` must be freed
+//   after use
+// * return: the length of `*outPtr` or 0 if errCode is 0 (in this case
+//   `*outPtr` is not set)
+extern int SecSIPIDGetReasonHeader(int errCode, char** outPtr);
+
+// SecSIPIDGetVerstat --
+// get the verstat value for the result of a verification: TN-Validation-Passed
+// if errCode is 0, for any attestation level (it is reported separately in the
+// attest claim), No-TN-Validation for an empty Identity header, otherwise
+// TN-Validation-Failed
+// * errCode - the error code returned by a check function
+// * attestVal - the attestation level of the PASSporT (0-terminated string),
+//   it does not change the verstat value
+// * outPtr - to be set to the pointer containing the verstat value (it is a
+//   0-terminated string); the `*outPtr` must be freed after use
+// * return: the length of `*outPtr`
+extern int SecSIPIDGetVerstat(int errCode, char* attestVal, char** outPtr);
+
+// SecSIPIDSetVerstat --
+// add the verstat parameter to the URI of a From or P-Asserted-Identity
+// header value
+// * hdrVal - the value of the header, without the header name (0-terminated
+//   string)
+// * verstat - the verstat value (0-terminated string)
+// * outPtr - to be set to the pointer containing the new header value (it is
+//   a 0-terminated string); the `*outPtr` must be freed after use
+// * return: the length of `*outPtr`
+extern int SecSIPIDSetVerstat(char* hdrVal, char* verstat, char** outPtr);
+
 #ifdef __cplusplus
 }
 #endif
@@ -1,8 +1,10 @@
 module github.com/asipto/secsipidx
 
-go 1.16
+go 1.21
 
 require (
 	github.com/gomagedon/expectate v1.1.0
 	github.com/google/uuid v1.3.0
 )
+
+require github.com/google/go-cmp v0.5.4 // indirect
@@ -33,6 +33,7 @@ type CLIOptions struct {
 	fpayload    string
 	identity    string
 	fidentity   string
+	fsipmsg     string
 	alg         string
 	ppt         string
 	typ         string
@@ -40,13 +41,19 @@ type CLIOptions struct {
 	attest      string
 	desttn      string
 	origtn      string
+	desturi     string
+	origuri     string
 	iat         int
 	origid      string
 	check       bool
+	checkoutput string
 	sign        bool
 	signfull    bool
 	jsonparse   bool
 	expire      int
+	iatskew     int
+	certtimeiat bool
+	checkrcd    bool
 	timeout     int
 	ltest       bool
 	version     bool
@@ -55,7 +62,14 @@ type CLIOptions struct {
 	cafile      string
 	cainter     string
 	crlfile     string
+	crlgrace    int
 	certverify  int
+	tncanon     bool
+	tncc        string
+	compact     bool
+	pcap        string
+	pcapformat  string
+	idpolicy    string
 }
 
 var cliops = CLIOptions{
@@ -72,6 +86,7 @@ var cliops = CLIOptions{
 	fpayload:    "",
 	identity:    "",
 	fidentity:   "",
+	fsipmsg:     "",
 	alg:         "ES256",
 	ppt:         "shaken",
 	typ:         "passport",
@@ -79,13 +94,19 @@ var cliops = CLIOptions{
 	attest:      "C",
 	desttn:      "",
 	origtn:      "",
+	desturi:     "",
+	origuri:     "",
 	iat:         0,
 	origid:      "",
 	check:       false,
+	checkoutput: "",
 	sign:        false,
 	signfull:    false,
 	jsonparse:   false,
 	expire:      0,
+	iatskew:     -1,
+	certtimeiat: false,
+	checkrcd:    false,
 	timeout:     3,
 	ltest:       false,
 	version:     false,
@@ -94,7 +115,14 @@ var cliops = CLIOptions{
 	cafile:      "",
 	cainter:     "",
 	crlfile:     "",
+	crlgrace:    0,
 	certverify:  0,
+	tncanon:     false,
+	tncc:        "",
+	compact:     false,
+	pcap:        "",
+	pcapformat:  "csv",
+	idpolicy:    "",
 }
 
 // initialize application components
@@ -122,6 +150,7 @@ func init() {
 	flag.StringVar(&cliops.fpayload, "fpayload", cliops.fpayload, "path to file with payload value in JSON format")
 	flag.StringVar(&cliops.payload, "payload", cliops.payload, "payload value in JSON format")
 	flag.StringVar(&cliops.fidentity, "fidentity", cliops.fidentity, "path to file with identity value")
+	flag.StringVar(&cliops.fsipmsg, "fsipmsg", cliops.fsipmsg, "path to file with SIP message to check all its identity headers ('-' for stdin)")
 	flag.StringVar(&cliops.identity, "identity", cliops.identity, "identity value")
 	flag.StringVar(&cliops.alg, "alg", cliops.alg, "encryption algorithm (default: ES256)")
 	flag.StringVar(&cliops.ppt, "ppt", cliops.ppt, "used extension (default: shaken)")
@@ -129,20 +158,30 @@ func init() {
 	flag.StringVar(&cliops.x5u, "x5u", cliops.x5u, "value of the field with the location of the certificate used to sign the token (default: '')")
 	flag.StringVar(&cliops.attest, "attest", cliops.attest, "attestation level (default: 'C')")
 	flag.StringVar(&cliops.attest, "a", cliops.attest, "attestation level (default: 'C')")
-	flag.StringVar(&cliops.desttn, "dest-tn", cliops.desttn, "destination (called) number (default: '')")
-	flag.StringVar(&cliops.desttn, "d", cliops.desttn, "destination (called) number (default: '')")
+	flag.StringVar(&cliops.desttn, "dest-tn", cliops.desttn, "destination (called) numbers, separated by comma (default: '')")
+	flag.StringVar(&cliops.desttn, "d", cliops.desttn, "destination (called) numbers, separated by comma (default: '')")
 	flag.StringVar(&cliops.origtn, "orig-tn", cliops.origtn, "origination (calling) number (default: '')")
 	flag.StringVar(&cliops.origtn, "o", cliops.origtn, "origination (calling) number (default: '')")
+	flag.StringVar(&cliops.desturi, "dest-uri", cliops.desturi, "destination (called) SIP URI (default: '')")
+	flag.StringVar(&cliops.origuri, "orig-uri", cliops.origuri, "origination (calling) SIP URI (default: '')")
 	flag.IntVar(&cliops.iat, "iat", cliops.iat, "timestamp when the token was created")
 	flag.StringVar(&cliops.origid, "orig-id", cliops.origid, "origination identifier (default: '')")
 	flag.BoolVar(&cliops.check, "check", cliops.check, "check validity of the signature")
 	flag.BoolVar(&cliops.check, "c", cliops.check, "check validity of the signature")
+	flag.StringVar(&cliops.pcap, "pcap", cliops.pcap, "path to capture file in pcap format to check the identity headers of the INVITE requests")
+	flag.StringVar(&cliops.pcapformat, "pcap-format", cliops.pcapformat, "format of the pcap check report: 'csv' or 'json'")
+	flag.StringVar(&cliops.idpolicy, "identity-policy", cliops.idpolicy, "policy for the identity headers of a call with -fsipmsg and http check: 'any', 'all' or list of required PASSporT types (default: 'shaken' for http check)")
+	flag.StringVar(&cliops.checkoutput, "check-output", cliops.checkoutput, "print the details of the check in 'text' or 'json' format (default: '')")
 	flag.BoolVar(&cliops.sign, "sign", cliops.sign, "sign the header and payload")
 	flag.BoolVar(&cliops.sign, "s", cliops.sign, "sign the header and payload")
 	flag.BoolVar(&cliops.signfull, "sign-full", cliops.sign, "sign the header and payload, with parameters")
 	flag.BoolVar(&cliops.signfull, "S", cliops.sign, "sign the header and payload, with parameters")
-	flag.BoolVar(&cliops.jsonparse, "json-parse", cliops.jsonparse, "parse and re-serialize JSON header and payaload values")
-	flag.IntVar(&cliops.expire, "expire", cliops.expire, "duration of token validity (in seconds)")
+	flag.BoolVar(&cliops.compact, "compact", cliops.compact, "build the identity header in compact form with -sign-full (only orig, dest and iat claims)")
+	flag.BoolVar(&cliops.jsonparse, "json-parse", cliops.jsonparse, "parse and re-serialize JSON header and payaload values (canonical form, unknown members are preserved)")
+	flag.IntVar(&cliops.expire, "expire", cliops.expire, "duration of token validity after iat (in seconds, default: 60)")
+	flag.IntVar(&cliops.iatskew, "iat-future-skew", cliops.iatskew, "tolerated clock skew for iat in the future (in seconds, 0 - none, default: 60)")
+	flag.BoolVar(&cliops.certtimeiat, "cert-time-iat", cliops.certtimeiat, "verify the validity of the certificate at the time of iat instead of current time")
+	flag.BoolVar(&cliops.checkrcd, "check-rcd", cliops.checkrcd, "check the rcd claim and the rcdi digests of shaken PASSporTs")
 	flag.IntVar(&cliops.timeout, "timeout", cliops.timeout, "http get timeout (in seconds, default: 3)")
 	flag.BoolVar(&cliops.ltest, "ltest", cliops.ltest, "run local basic test")
 	flag.BoolVar(&cliops.ltest, "l", cliops.ltest, "run local basic test")
@@ -151,7 +190,10 @@ func init() {
 	flag.IntVar(&cliops.cacheexpire, "cache-expire", cliops.cacheexpire, "duration of cached certificates (in seconds, default 3600)")
 	flag.StringVar(&cliops.cafile, "ca-file", cliops.cafile, "file with root CA certificates in pem format")
 	flag.StringVar(&cliops.cainter, "ca-inter", cliops.cainter, "file with intermediate CA certificates in pem format")
-	flag.StringVar(&cliops.crlfile, "crl-file", cliops.crlfile, "file with CRL in pem format")
+	flag.StringVar(&cliops.crlfile, "crl-file", cliops.crlfile, "files or directories with CRLs in pem or der format (comma separated)")
+	flag.IntVar(&cliops.crlgrace, "crl-grace", cliops.crlgrace, "duration a CRL is accepted after its next update (in seconds, default: 0)")
+	flag.BoolVar(&cliops.tncanon, "tn-canonicalize", cliops.tncanon, "set and compare the telephone numbers in canonical form (RFC 8224 section 8.3)")
+	flag.StringVar(&cliops.tncc, "tn-country-code", cliops.tncc, "country code used to canonicalize national telephone numbers (default: '')")
 	flag.IntVar(&cliops.certverify, "cert-verify", cliops.certverify, "certificate verification mode (default 0")
 }
 
@@ -204,9 +246,30 @@ func localTest() {
 	fmt.Printf("Signature: %s\n", signatureText)
 }
 
+// secsipidxCLIIdentityOptions - attributes of the PASSporT from cli parameters
+func secsipidxCLIIdentityOptions() secsipid.SJWTIdentityOptions {
+	opts := secsipid.SJWTIdentityOptions{
+		OrigTN:  cliops.origtn,
+		OrigURI: cliops.origuri,
+		Attest:  cliops.attest,
+		OrigID:  cliops.origid,
+		X5u:     cliops.x5u,
+		Compact: cliops.compact,
+	}
+	if destTNs := secsipid.SJWTParseTNList(cliops.desttn); len(destTNs) > 0 {
+		opts.DestTNs = destTNs
+	} else if len(cliops.desturi) == 0 {
+		opts.DestTNs = []string{cliops.desttn}
+	}
+	if len(cliops.desturi) > 0 {
+		opts.DestURIs = []string{cliops.desturi}
+	}
+	return opts
+}
+
 func secsipidxCLISignFull() int {
 
-	token, _, err := secsipid.SJWTGetIdentity(cliops.origtn, cliops.desttn, cliops.attest, cliops.origid, cliops.x5u, cliops.fprvkey)
+	token, _, err := secsipid.SJWTGetIdentityOpts(secsipidxCLIIdentityOptions(), cliops.fprvkey)
 
 	if err != nil {
 		fmt.Printf("error: %v\n", err)
@@ -295,14 +358,17 @@ func secsipidxCLISign() int {
 			sPayload = cliops.payload
 		}
 	} else {
+		opts := secsipidxCLIIdentityOptions()
 		payload = secsipid.SJWTPayload{
 			ATTest: cliops.attest,
 			Dest: secsipid.SJWTDest{
-				TN: []string{cliops.desttn},
+				TN:  opts.DestTNs,
+				URI: opts.DestURIs,
 			},
 			IAT: int64(cliops.iat),
 			Orig: secsipid.SJWTOrig{
-				TN: cliops.origtn,
+				TN:  opts.OrigTN,
+				URI: opts.OrigURI,
 			},
 			OrigID: cliops.origid,
 		}
@@ -334,6 +400,9 @@ func secsipidxCLICheck() int {
 	var ret int
 	var err error
 
+	if len(cliops.fsipmsg) > 0 {
+		return secsipidxCLICheckSIPMessage()
+	}
 	if len(cliops.fpubkey) <= 0 {
 		fmt.Printf("path to public key not provided\n")
 		return -1
@@ -348,17 +417,215 @@ func secsipidxCLICheck() int {
 		return -1
 	}
 
-	ret, err = secsipid.SJWTCheckFullIdentity(sIdentity, cliops.expire, cliops.fpubkey, cliops.timeout)
+	res := secsipid.SJWTCheckFullIdentityResult(sIdentity, cliops.expire, cliops.fpubkey, cliops.timeout)
+	ret, err = res.ErrCode, res.Err
 
 	if err != nil {
 		fmt.Printf("error message: %v\n", err)
 	}
+	switch cliops.checkoutput {
+	case "text":
+		fmt.Printf("%s", res.String())
+	case "json":
+		jsonResult, _ := json.Marshal(res)
+		fmt.Printf("%s\n", jsonResult)
+	}
 	return ret
 }
 
-func httpHandleV1Check(w http.ResponseWriter, r *http.Request) {
-	var ret int
+// sipMsgIdentityResult - result of the check for an identity header of a SIP
+// message
+type sipMsgIdentityResult struct {
+	Index    int                          `json:"index"`
+	Identity string                       `json:"identity"`
+	Result   *secsipid.VerificationResult `json:"result"`
+}
+
+// secsipidxCLICheckSIPMessage - check all identity headers of the SIP message
+// against its From, To and Date headers, printing a report per header; the
+// public key is taken from the info parameter if not provided
+func secsipidxCLICheckSIPMessage() int {
+	var msgData []byte
+	var err error
+
+	if cliops.fsipmsg == "-" {
+		msgData, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		msgData, err = ioutil.ReadFile(cliops.fsipmsg)
+	}
+	if err != nil {
+		fmt.Printf("failed to read SIP message: %v\n", err)
+		return secsipid.SJWTRetErrFileRead
+	}
+
+	if len(cliops.idpolicy) > 0 {
+		return secsipidxCLICheckSIPMessagePolicy(msgData)
+	}
+
+	msg, ret, err := secsipid.SJWTParseSIPMessage(msgData)
+	if err != nil {
+		fmt.Printf("error message: %v\n", err)
+		return ret
+	}
+	identities := msg.IdentityValues()
+	if len(identities) == 0 {
+		fmt.Printf("error message: %v\n", secsipid.ErrSIPHdrEmpty)
+		return secsipid.SJWTRetErrSIPHdrEmpty
+	}
+
+	results := []sipMsgIdentityResult{}
+	ret = secsipid.SJWTRetOK
+	for i, identity := range identities {
+		res := secsipid.SJWTCheckFullIdentitySIPResult(identity, cliops.expire, cliops.fpubkey, cliops.timeout, msg.SIPHeaders())
+		results = append(results, sipMsgIdentityResult{Index: i, Identity: identity, Result: res})
+		if res.ErrCode != secsipid.SJWTRetOK && ret == secsipid.SJWTRetOK {
+			ret = res.ErrCode
+		}
+		if cliops.checkoutput == "json" {
+			continue
+		}
+		if res.OK() {
+			fmt.Printf("identity[%d]: ok\n", i)
+		} else {
+			fmt.Printf("identity[%d]: not-ok - error code: %d - error message: %v\n", i, res.ErrCode, res.Err)
+		}
+		if cliops.checkoutput == "text" {
+			fmt.Printf("%s\n", res.String())
+		}
+	}
+	if cliops.checkoutput == "json" {
+		jsonResults, _ := json.Marshal(results)
+		fmt.Printf("%s\n", jsonResults)
+	}
+	return ret
+}
+
+// secsipidxCLICheckSIPMessagePolicy - check all identity headers of the SIP
+// message and print the verdict of the identity policy
+func secsipidxCLICheckSIPMessagePolicy(msgData []byte) int {
+	policy, ret, err := secsipid.SJWTParseIdentityPolicy(cliops.idpolicy)
+	if err != nil {
+		fmt.Printf("error message: %v\n", err)
+		return ret
+	}
+
+	res := secsipid.SJWTCheckSIPMessageIdentities(msgData, cliops.expire, cliops.fpubkey, cliops.timeout, policy)
+	switch cliops.checkoutput {
+	case "json":
+		jsonResult, _ := json.Marshal(res)
+		fmt.Printf("%s\n", jsonResult)
+	case "text":
+		fmt.Printf("%s", res.String())
+	default:
+		for _, ir := range res.Results {
+			if ir.ErrCode == secsipid.SJWTRetOK {
+				fmt.Printf("identity[%d]: ok\n", ir.Index)
+			} else {
+				fmt.Printf("identity[%d]: not-ok - error code: %d - error message: %v\n", ir.Index, ir.ErrCode, ir.Err)
+			}
+		}
+		if res.Err != nil {
+			fmt.Printf("error message: %v\n", res.Err)
+		}
+	}
+	return res.ErrCode
+}
+
+// httpCheckRequest - body of /v1/check request in JSON format, with all the
+// identity headers of a call and optionally the values of the SIP request
+type httpCheckRequest struct {
+	Identities       []string `json:"identities"`
+	Policy           string   `json:"policy"`
+	From             string   `json:"from"`
+	PAI              string   `json:"pai"`
+	To               string   `json:"to"`
+	RequestURI       string   `json:"requestUri"`
+	Date             string   `json:"date"`
+	ResourcePriority string   `json:"resourcePriority"`
+}
+
+// httpCheckMultiRequest - return the request for checking several identity
+// headers, nil if the body has a single identity header in text format
+//
+// The body can be a JSON document (with Content-Type application/json) or,
+// when the 'policy' URL parameter is given, have an identity header on each
+// line.
+func httpCheckMultiRequest(r *http.Request, body []byte) (*httpCheckRequest, error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		req := &httpCheckRequest{}
+		if err := json.Unmarshal(body, req); err != nil {
+			return nil, err
+		}
+		if len(req.Policy) == 0 {
+			req.Policy = r.URL.Query().Get("policy")
+		}
+		return req, nil
+	}
+
+	// without policy, the text body is a single identity, which can be
+	// folded over several lines
+	policy := r.URL.Query().Get("policy")
+	if len(policy) == 0 {
+		return nil, nil
+	}
+	var identities []string
+	for _, line := range strings.Split(string(body), "\n") {
+		if line = strings.TrimSpace(line); len(line) > 0 {
+			identities = append(identities, line)
+		}
+	}
+	return &httpCheckRequest{
+		Identities: identities,
+		Policy:     policy,
+	}, nil
+}
+
+// httpHandleV1CheckMulti - check all the identity headers of a call and
+// reply with the verdict of the policy
+func httpHandleV1CheckMulti(w http.ResponseWriter, r *http.Request, req *httpCheckRequest) {
+	if len(req.Policy) == 0 {
+		req.Policy = cliops.idpolicy
+	}
+	policy, _, err := secsipid.SJWTParseIdentityPolicy(req.Policy)
+	if err != nil {
+		fmt.Printf("invalid identity policy: %v\n", err)
+		http.Error(w, "invalid policy", http.StatusBadRequest)
+		return
+	}
+
+	res := secsipid.SJWTCheckIdentitiesResult(req.Identities, cliops.expire, cliops.fpubkey, cliops.timeout,
+		secsipid.SJWTSIPHeaders{
+			From:             req.From,
+			PAI:              req.PAI,
+			To:               req.To,
+			RequestURI:       req.RequestURI,
+			Date:             req.Date,
+			ResourcePriority: req.ResourcePriority,
+		}, policy)
+
+	if res.Err != nil {
+		fmt.Printf("failed checking identities: %v\n", res.Err)
+	} else {
+		fmt.Printf("valid identities - return code: %d\n", res.ErrCode)
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if res.Err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(res)
+		return
+	}
 
+	if res.Err != nil {
+		http.Error(w, "FAILED\n", http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "OK\n")
+}
+
+func httpHandleV1Check(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("incoming request for identity check ...\n")
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -366,14 +633,37 @@ func httpHandleV1Check(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "cannot read body", http.StatusBadRequest)
 		return
 	}
-	ret, err = secsipid.SJWTCheckFullIdentity(string(body), cliops.expire, cliops.fpubkey, cliops.timeout)
-
+	req, err := httpCheckMultiRequest(r, body)
 	if err != nil {
-		fmt.Printf("failed checking identity: %v\n", err)
+		fmt.Printf("error parsing body: %v\n", err)
+		http.Error(w, "cannot parse body", http.StatusBadRequest)
+		return
+	}
+	if req != nil {
+		httpHandleV1CheckMulti(w, r, req)
+		return
+	}
+	res := secsipid.SJWTCheckFullIdentityResult(string(body), cliops.expire, cliops.fpubkey, cliops.timeout)
+
+	if res.Err != nil {
+		fmt.Printf("failed checking identity: %v\n", res.Err)
+	} else {
+		fmt.Printf("valid identity - return code: %d\n", res.ErrCode)
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if res.Err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	if res.Err != nil {
 		http.Error(w, "FAILED\n", http.StatusInternalServerError)
 		return
 	}
-	fmt.Printf("valid identity - return code: %d\n", ret)
 	fmt.Fprintf(w, "OK\n")
 }
 
@@ -394,7 +684,8 @@ func httpHandleV1SignCSV(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var hdr string
-	hdr, _, err = secsipid.SJWTGetIdentity(token[0], token[1], token[2], token[3], token[4], cliops.fprvkey)
+	// several destination numbers are separated by semicolon
+	hdr, _, err = secsipid.SJWTGetIdentityMulti(token[0], secsipid.SJWTParseTNList(token[1]), token[2], token[3], token[4], cliops.fprvkey)
 	if err != nil {
 		fmt.Printf("error reading body: %v", err)
 		http.Error(w, "cannot read body", http.StatusBadRequest)
@@ -462,12 +753,30 @@ func main() {
 	if len(cliops.crlfile) > 0 {
 		secsipid.SJWTLibOptSetS("CertCRLFile", cliops.crlfile)
 	}
+	if cliops.crlgrace > 0 {
+		secsipid.SJWTLibOptSetN("CRLGrace", cliops.crlgrace)
+	}
 	if cliops.certverify > 0 {
 		secsipid.SJWTLibOptSetN("CertVerify", cliops.certverify)
 	}
+	if cliops.iatskew >= 0 {
+		secsipid.SJWTLibOptSetN("IATFutureSkew", cliops.iatskew)
+	}
+	if cliops.certtimeiat {
+		secsipid.SJWTLibOptSetN("CertTimeIAT", 1)
+	}
+	if cliops.checkrcd {
+		secsipid.SJWTLibOptSetN("CheckRCD", 1)
+	}
 	if len(cliops.x5u) > 0 {
 		secsipid.SJWTLibOptSetS("x5u", cliops.x5u)
 	}
+	if cliops.tncanon {
+		secsipid.SJWTLibOptSetN("TNCanonicalize", 1)
+	}
+	if len(cliops.tncc) > 0 {
+		secsipid.SJWTLibOptSetS("TNCountryCode", cliops.tncc)
+	}
 
 	if (len(cliops.httpsrv) > 0) || (len(cliops.httpssrv) > 0 && len(cliops.httpspubkey) > 0 && len(cliops.httpsprvkey) > 0) {
 		http.HandleFunc("/v1/check", httpHandleV1Check)
@@ -487,7 +796,10 @@ func main() {
 	}
 
 	ret = 0
-	if cliops.check {
+	if len(cliops.pcap) > 0 {
+		ret = secsipidxPcap(cliops.pcap)
+		os.Exit(ret)
+	} else if cliops.check {
 		ret = secsipidxCLICheck()
 		if ret == 0 {
 			fmt.Printf("ok\n")
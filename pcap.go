@@ -0,0 +1,584 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// link layer types of the capture files
+const (
+	pcapLinkNull     = 0
+	pcapLinkEthernet = 1
+	pcapLinkRaw      = 101
+	pcapLinkSLL      = 113
+	pcapLinkIPv4     = 228
+	pcapLinkIPv6     = 229
+	pcapLinkSLL2     = 276
+)
+
+// pcapPacket - packet read from the capture file
+type pcapPacket struct {
+	ts   time.Time
+	data []byte
+}
+
+// pcapSIPMessage - SIP message extracted from the captured traffic
+type pcapSIPMessage struct {
+	ts        time.Time
+	src       string
+	dst       string
+	transport string
+	data      []byte
+}
+
+// pcapTCPSegment - payload of a TCP packet
+type pcapTCPSegment struct {
+	seq  uint32
+	ts   time.Time
+	data []byte
+}
+
+// pcapTCPFlow - segments of a TCP connection in one direction
+type pcapTCPFlow struct {
+	src      string
+	dst      string
+	segments []pcapTCPSegment
+}
+
+// pcapIPFragments - fragments of an IPv4 datagram
+type pcapIPFragments struct {
+	frags map[int][]byte
+	total int
+}
+
+// pcapReader - extracts the SIP messages from the packets of a capture file
+type pcapReader struct {
+	linkType  uint32
+	messages  []pcapSIPMessage
+	tcpFlows  map[string]*pcapTCPFlow
+	flowOrder []string
+	ipFrags   map[string]*pcapIPFragments
+}
+
+// pcapReportRow - verification result for an Identity header of an INVITE
+type pcapReportRow struct {
+	Time      string `json:"time"`
+	Src       string `json:"src"`
+	Dst       string `json:"dst"`
+	Transport string `json:"transport"`
+	CallID    string `json:"callId"`
+	Index     int    `json:"index"`
+	Attest    string `json:"attest"`
+	Orig      string `json:"orig"`
+	Dest      string `json:"dest"`
+	X5u       string `json:"x5u"`
+	SPC       string `json:"spc,omitempty"`
+	Verstat   string `json:"verstat"`
+	ErrCode   int    `json:"errCode"`
+	ErrMsg    string `json:"errMsg,omitempty"`
+}
+
+var pcapContentLengthRE = regexp.MustCompile(`(?im)^(content-length|l)[ \t]*:[ \t]*([0-9]+)`)
+
+// pcapReadFile - read the packets of a capture file in libpcap format
+func pcapReadFile(filePath string) (uint32, []pcapPacket, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(data) < 24 {
+		return 0, nil, errors.New("capture file too short")
+	}
+
+	var order binary.ByteOrder
+	nanoSec := false
+	switch binary.LittleEndian.Uint32(data[0:4]) {
+	case 0xa1b2c3d4:
+		order = binary.LittleEndian
+	case 0xd4c3b2a1:
+		order = binary.BigEndian
+	case 0xa1b23c4d:
+		order = binary.LittleEndian
+		nanoSec = true
+	case 0x4d3cb2a1:
+		order = binary.BigEndian
+		nanoSec = true
+	case 0x0a0d0d0a:
+		return 0, nil, errors.New("pcapng format not supported - convert it to pcap (e.g., editcap -F pcap)")
+	default:
+		return 0, nil, errors.New("unknown capture file format")
+	}
+	linkType := order.Uint32(data[20:24]) & 0x0fffffff
+
+	var packets []pcapPacket
+	for offset := 24; offset+16 <= len(data); {
+		tsSec := int64(order.Uint32(data[offset : offset+4]))
+		tsFrac := int64(order.Uint32(data[offset+4 : offset+8]))
+		capLen := int(order.Uint32(data[offset+8 : offset+12]))
+		offset += 16
+		if offset+capLen > len(data) {
+			// truncated capture file
+			break
+		}
+		if !nanoSec {
+			tsFrac *= 1000
+		}
+		packets = append(packets, pcapPacket{
+			ts:   time.Unix(tsSec, tsFrac),
+			data: data[offset : offset+capLen],
+		})
+		offset += capLen
+	}
+	return linkType, packets, nil
+}
+
+// pcapExtractSIPMessages - return the SIP messages of the capture file, sent
+// over UDP or TCP (the TCP streams being reassembled)
+func pcapExtractSIPMessages(filePath string) ([]pcapSIPMessage, error) {
+	linkType, packets, err := pcapReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &pcapReader{
+		linkType: linkType,
+		tcpFlows: map[string]*pcapTCPFlow{},
+		ipFrags:  map[string]*pcapIPFragments{},
+	}
+	for _, pkt := range packets {
+		r.addPacket(pkt)
+	}
+	for _, flowKey := range r.flowOrder {
+		r.addTCPFlowMessages(r.tcpFlows[flowKey])
+	}
+	sort.SliceStable(r.messages, func(i, j int) bool {
+		return r.messages[i].ts.Before(r.messages[j].ts)
+	})
+	return r.messages, nil
+}
+
+// addPacket - decode the link layer of the packet
+func (r *pcapReader) addPacket(pkt pcapPacket) {
+	data := pkt.data
+	etherType := uint16(0)
+
+	switch r.linkType {
+	case pcapLinkEthernet:
+		if len(data) < 14 {
+			return
+		}
+		etherType = binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+		// VLAN tags
+		for (etherType == 0x8100 || etherType == 0x88a8) && len(data) >= 4 {
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+	case pcapLinkSLL:
+		if len(data) < 16 {
+			return
+		}
+		etherType = binary.BigEndian.Uint16(data[14:16])
+		data = data[16:]
+	case pcapLinkSLL2:
+		if len(data) < 20 {
+			return
+		}
+		etherType = binary.BigEndian.Uint16(data[0:2])
+		data = data[20:]
+	case pcapLinkNull:
+		if len(data) < 4 {
+			return
+		}
+		data = data[4:]
+	case pcapLinkRaw, pcapLinkIPv4, pcapLinkIPv6:
+	default:
+		return
+	}
+	if len(data) == 0 {
+		return
+	}
+
+	switch {
+	case etherType == 0x0800 || (etherType == 0 && data[0]>>4 == 4):
+		r.addIPv4(pkt.ts, data)
+	case etherType == 0x86dd || (etherType == 0 && data[0]>>4 == 6):
+		r.addIPv6(pkt.ts, data)
+	}
+}
+
+// addIPv4 - decode the IPv4 header, reassembling the fragmented datagrams
+func (r *pcapReader) addIPv4(ts time.Time, data []byte) {
+	if len(data) < 20 {
+		return
+	}
+	hdrLen := int(data[0]&0x0f) * 4
+	totalLen := int(binary.BigEndian.Uint16(data[2:4]))
+	if hdrLen < 20 || totalLen < hdrLen || totalLen > len(data) {
+		return
+	}
+	src := net.IP(data[12:16]).String()
+	dst := net.IP(data[16:20]).String()
+	proto := data[9]
+	flags := binary.BigEndian.Uint16(data[6:8])
+	fragOffset := int(flags&0x1fff) * 8
+	moreFrags := flags&0x2000 != 0
+	payload := data[hdrLen:totalLen]
+
+	if moreFrags || fragOffset > 0 {
+		key := fmt.Sprintf("%s|%s|%d|%d", src, dst, binary.BigEndian.Uint16(data[4:6]), proto)
+		frags, ok := r.ipFrags[key]
+		if !ok {
+			frags = &pcapIPFragments{frags: map[int][]byte{}, total: -1}
+			r.ipFrags[key] = frags
+		}
+		frags.frags[fragOffset] = payload
+		if !moreFrags {
+			frags.total = fragOffset + len(payload)
+		}
+		if payload = frags.assemble(); payload == nil {
+			return
+		}
+		delete(r.ipFrags, key)
+	}
+	r.addTransport(ts, proto, src, dst, payload)
+}
+
+// assemble - return the datagram payload if all the fragments were received
+func (f *pcapIPFragments) assemble() []byte {
+	if f.total < 0 {
+		return nil
+	}
+	payload := make([]byte, 0, f.total)
+	for len(payload) < f.total {
+		frag, ok := f.frags[len(payload)]
+		if !ok || len(frag) == 0 {
+			return nil
+		}
+		payload = append(payload, frag...)
+	}
+	return payload[:f.total]
+}
+
+// addIPv6 - decode the IPv6 header, skipping the extension headers
+func (r *pcapReader) addIPv6(ts time.Time, data []byte) {
+	if len(data) < 40 {
+		return
+	}
+	payloadLen := int(binary.BigEndian.Uint16(data[4:6]))
+	if 40+payloadLen > len(data) {
+		return
+	}
+	src := net.IP(data[8:24]).String()
+	dst := net.IP(data[24:40]).String()
+	proto := data[6]
+	payload := data[40 : 40+payloadLen]
+
+	for proto == 0 || proto == 43 || proto == 60 {
+		if len(payload) < 8 {
+			return
+		}
+		extLen := (int(payload[1]) + 1) * 8
+		if extLen > len(payload) {
+			return
+		}
+		proto = payload[0]
+		payload = payload[extLen:]
+	}
+	if proto == 44 {
+		// fragmented IPv6 datagrams are not supported
+		return
+	}
+	r.addTransport(ts, proto, src, dst, payload)
+}
+
+// addTransport - decode the UDP or TCP header
+func (r *pcapReader) addTransport(ts time.Time, proto byte, srcIP string, dstIP string, data []byte) {
+	switch proto {
+	case 17:
+		if len(data) < 8 {
+			return
+		}
+		src := net.JoinHostPort(srcIP, strconv.Itoa(int(binary.BigEndian.Uint16(data[0:2]))))
+		dst := net.JoinHostPort(dstIP, strconv.Itoa(int(binary.BigEndian.Uint16(data[2:4]))))
+		payload := data[8:]
+		if len(bytes.TrimSpace(payload)) == 0 {
+			// keep-alive
+			return
+		}
+		r.messages = append(r.messages, pcapSIPMessage{
+			ts:        ts,
+			src:       src,
+			dst:       dst,
+			transport: "udp",
+			data:      payload,
+		})
+	case 6:
+		if len(data) < 20 {
+			return
+		}
+		hdrLen := int(data[12]>>4) * 4
+		if hdrLen < 20 || hdrLen > len(data) {
+			return
+		}
+		src := net.JoinHostPort(srcIP, strconv.Itoa(int(binary.BigEndian.Uint16(data[0:2]))))
+		dst := net.JoinHostPort(dstIP, strconv.Itoa(int(binary.BigEndian.Uint16(data[2:4]))))
+		seq := binary.BigEndian.Uint32(data[4:8])
+		if data[13]&0x02 != 0 {
+			// SYN takes one sequence number
+			seq++
+		}
+		payload := data[hdrLen:]
+		if len(payload) == 0 {
+			return
+		}
+		flowKey := src + ">" + dst
+		flow, ok := r.tcpFlows[flowKey]
+		if !ok {
+			flow = &pcapTCPFlow{src: src, dst: dst}
+			r.tcpFlows[flowKey] = flow
+			r.flowOrder = append(r.flowOrder, flowKey)
+		}
+		flow.segments = append(flow.segments, pcapTCPSegment{seq: seq, ts: ts, data: payload})
+	}
+}
+
+// addTCPFlowMessages - reassemble the TCP stream and split it in SIP messages
+// using the Content-Length header
+func (r *pcapReader) addTCPFlowMessages(flow *pcapTCPFlow) {
+	if len(flow.segments) == 0 {
+		return
+	}
+
+	// order the segments by the offset relative to the first one
+	base := flow.segments[0].seq
+	sort.SliceStable(flow.segments, func(i, j int) bool {
+		return int32(flow.segments[i].seq-base) < int32(flow.segments[j].seq-base)
+	})
+	base = flow.segments[0].seq
+
+	var stream []byte
+	var offsets []int
+	var times []time.Time
+	for _, seg := range flow.segments {
+		rel := int(seg.seq - base)
+		if rel+len(seg.data) <= len(stream) {
+			// retransmission
+			continue
+		}
+		if rel > len(stream) {
+			// missing data - continue with the segment
+			rel = len(stream)
+		}
+		offsets = append(offsets, len(stream))
+		times = append(times, seg.ts)
+		stream = append(stream, seg.data[len(stream)-rel:]...)
+	}
+
+	tsAt := func(offset int) time.Time {
+		idx := sort.Search(len(offsets), func(i int) bool { return offsets[i] > offset }) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return times[idx]
+	}
+
+	for start := 0; start < len(stream); {
+		// skip keep-alive line breaks
+		for start < len(stream) && (stream[start] == '\r' || stream[start] == '\n') {
+			start++
+		}
+		if start >= len(stream) {
+			break
+		}
+		eoh := bytes.Index(stream[start:], []byte("\r\n\r\n"))
+		sepLen := 4
+		if eoh < 0 {
+			if eoh = bytes.Index(stream[start:], []byte("\n\n")); eoh < 0 {
+				break
+			}
+			sepLen = 2
+		}
+		bodyLen := 0
+		if m := pcapContentLengthRE.FindSubmatch(stream[start : start+eoh]); m != nil {
+			bodyLen, _ = strconv.Atoi(string(m[2]))
+		}
+		if bodyLen > len(stream)-start-eoh-sepLen {
+			// incomplete message at the end of the capture
+			break
+		}
+		end := start + eoh + sepLen + bodyLen
+		r.messages = append(r.messages, pcapSIPMessage{
+			ts:        tsAt(start),
+			src:       flow.src,
+			dst:       flow.dst,
+			transport: "tcp",
+			data:      stream[start:end],
+		})
+		start = end
+	}
+}
+
+// secsipidxPcapVerifier - verifier with the cli options, checking the
+// validity at the time the message was captured; the CRLs being the current
+// ones, their thisUpdate and nextUpdate are not checked
+func secsipidxPcapVerifier(ts time.Time) *secsipid.Verifier {
+	var iatFutureSkew *int
+	if cliops.iatskew >= 0 {
+		iatFutureSkew = &cliops.iatskew
+	}
+	return secsipid.NewVerifier(secsipid.VerifierOptions{
+		CacheDirPath: cliops.cachedir,
+		CacheExpire:  cliops.cacheexpire,
+		CertCAFile:   cliops.cafile,
+		CertCAInter:  cliops.cainter,
+		CertCRLFile:  cliops.crlfile,
+		CRLGrace:     cliops.crlgrace,
+		SkipCRLTime:  true,
+		CertVerify:   cliops.certverify,
+		Expire:       cliops.expire,
+		Timeout:      cliops.timeout,
+		Now:          func() time.Time { return ts },
+
+		IATFutureSkew: iatFutureSkew,
+		CertTimeIAT:   cliops.certtimeiat,
+		CheckRCD:      cliops.checkrcd,
+	})
+}
+
+// secsipidxPcap - verify the Identity headers of the INVITE requests in the
+// capture file, printing a report in csv or json format
+func secsipidxPcap(filePath string) int {
+	messages, err := pcapExtractSIPMessages(filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read capture file: %v\n", err)
+		return -1
+	}
+
+	if len(cliops.cachedir) == 0 {
+		// cache the downloaded certificates, to fetch them only once
+		cacheDir, err := ioutil.TempDir("", "secsipidx-pcap")
+		if err == nil {
+			defer os.RemoveAll(cacheDir)
+			cliops.cachedir = cacheDir
+		}
+	}
+
+	rows := []pcapReportRow{}
+	for _, capMsg := range messages {
+		msg, _, err := secsipid.SJWTParseSIPMessage(capMsg.data)
+		if err != nil || msg.Method != "INVITE" {
+			continue
+		}
+		row := pcapReportRow{
+			Time:      capMsg.ts.UTC().Format(time.RFC3339Nano),
+			Src:       capMsg.src,
+			Dst:       capMsg.dst,
+			Transport: capMsg.transport,
+			CallID:    msg.Header("Call-ID"),
+		}
+		identities := msg.IdentityValues()
+		if len(identities) == 0 {
+			row.Verstat = secsipid.SJWTGetVerstat(secsipid.SJWTRetErrSIPHdrEmpty, "")
+			row.ErrCode = secsipid.SJWTRetErrSIPHdrEmpty
+			row.ErrMsg = secsipid.ErrSIPHdrEmpty.Error()
+			rows = append(rows, row)
+			continue
+		}
+		verifier := secsipidxPcapVerifier(capMsg.ts)
+		for i, identity := range identities {
+			res := verifier.CheckFullIdentityResult(identity, cliops.fpubkey)
+			iRow := row
+			iRow.Index = i
+			iRow.Attest = res.Attest
+			iRow.X5u = res.Info
+			iRow.SPC = res.SPC
+			if res.Header != nil && len(res.Header.X5u) > 0 {
+				iRow.X5u = res.Header.X5u
+			}
+			payload := res.Payload
+			if payload == nil {
+				// verification failed before decoding the payload
+				payload = pcapIdentityPayload(identity)
+			}
+			if payload != nil {
+				if len(iRow.Attest) == 0 {
+					iRow.Attest = payload.ATTest
+				}
+				iRow.Orig = payload.Orig.TN
+				if len(iRow.Orig) == 0 {
+					iRow.Orig = payload.Orig.URI
+				}
+				iRow.Dest = strings.Join(append(append([]string{}, payload.Dest.TN...), payload.Dest.URI...), ";")
+			}
+			iRow.Verstat = res.Verstat()
+			iRow.ErrCode = res.ErrCode
+			if res.Err != nil {
+				iRow.ErrMsg = res.Err.Error()
+			}
+			rows = append(rows, iRow)
+		}
+	}
+
+	if cliops.pcapformat == "json" {
+		jsonRows, _ := json.Marshal(rows)
+		fmt.Printf("%s\n", jsonRows)
+		return 0
+	}
+	if err := pcapWriteCSV(os.Stdout, rows); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the report: %v\n", err)
+		return -1
+	}
+	return 0
+}
+
+// pcapIdentityPayload - decode the payload of the Identity header value,
+// without verifying it, to report the claims of the failed verifications
+func pcapIdentityPayload(identityVal string) *secsipid.SJWTPayload {
+	hdr, _, err := secsipid.SJWTParseIdentityHeader(identityVal)
+	if err != nil {
+		return nil
+	}
+	btoken := strings.Split(hdr.Token, ".")
+	if len(btoken) != 3 || len(btoken[1]) == 0 {
+		return nil
+	}
+	jsonPayload, err := secsipid.SJWTBase64DecodeBytes(btoken[1])
+	if err != nil {
+		return nil
+	}
+	payload := &secsipid.SJWTPayload{}
+	if json.Unmarshal(jsonPayload, payload) != nil {
+		return nil
+	}
+	return payload
+}
+
+// pcapWriteCSV - write the report rows in csv format, with a header line
+func pcapWriteCSV(w io.Writer, rows []pcapReportRow) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "src", "dst", "transport", "callid", "index", "attest",
+		"orig", "dest", "x5u", "spc", "verstat", "errcode", "errmsg"})
+	for _, row := range rows {
+		cw.Write([]string{row.Time, row.Src, row.Dst, row.Transport, row.CallID,
+			strconv.Itoa(row.Index), row.Attest, row.Orig, row.Dest, row.X5u,
+			row.SPC, row.Verstat, strconv.Itoa(row.ErrCode), row.ErrMsg})
+	}
+	cw.Flush()
+	return cw.Error()
+}
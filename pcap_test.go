@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gomagedon/expectate"
+)
+
+const (
+	pcapTestInvite = "INVITE sip:+15551234567@127.0.0.1 SIP/2.0\r\n" +
+		"Call-ID: pcap-test\r\n" +
+		"Content-Length: 4\r\n" +
+		"\r\n" +
+		"v=0\n"
+	pcapTestBye = "BYE sip:+15551234567@127.0.0.1 SIP/2.0\r\n" +
+		"Call-ID: pcap-test\r\n" +
+		"l: 0\r\n" +
+		"\r\n"
+)
+
+// pcapTestFile - capture file in libpcap format with the packets
+func pcapTestFile(linkType uint32, packets ...[]byte) []byte {
+	data := make([]byte, 24)
+	binary.LittleEndian.PutUint32(data[0:4], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(data[4:6], 2)
+	binary.LittleEndian.PutUint16(data[6:8], 4)
+	binary.LittleEndian.PutUint32(data[16:20], 65535)
+	binary.LittleEndian.PutUint32(data[20:24], linkType)
+	for i, pkt := range packets {
+		rec := make([]byte, 16)
+		binary.LittleEndian.PutUint32(rec[0:4], uint32(1700000000+i))
+		binary.LittleEndian.PutUint32(rec[8:12], uint32(len(pkt)))
+		binary.LittleEndian.PutUint32(rec[12:16], uint32(len(pkt)))
+		data = append(append(data, rec...), pkt...)
+	}
+	return data
+}
+
+// pcapTestEthernet - Ethernet frame with the payload
+func pcapTestEthernet(etherType uint16, payload []byte) []byte {
+	frame := make([]byte, 14)
+	binary.BigEndian.PutUint16(frame[12:14], etherType)
+	return append(frame, payload...)
+}
+
+// pcapTestSLL - Linux cooked capture frame with the payload
+func pcapTestSLL(etherType uint16, payload []byte) []byte {
+	frame := make([]byte, 16)
+	binary.BigEndian.PutUint16(frame[14:16], etherType)
+	return append(frame, payload...)
+}
+
+// pcapTestIPv4 - IPv4 packet from 192.0.2.1 to 192.0.2.2, fragOffset is
+// in bytes
+func pcapTestIPv4(proto byte, id uint16, fragOffset int, moreFrags bool, payload []byte) []byte {
+	pkt := make([]byte, 20)
+	pkt[0] = 0x45
+	binary.BigEndian.PutUint16(pkt[2:4], uint16(20+len(payload)))
+	binary.BigEndian.PutUint16(pkt[4:6], id)
+	flags := uint16(fragOffset / 8)
+	if moreFrags {
+		flags |= 0x2000
+	}
+	binary.BigEndian.PutUint16(pkt[6:8], flags)
+	pkt[8] = 64
+	pkt[9] = proto
+	copy(pkt[12:16], []byte{192, 0, 2, 1})
+	copy(pkt[16:20], []byte{192, 0, 2, 2})
+	return append(pkt, payload...)
+}
+
+// pcapTestIPv6 - IPv6 packet from 2001:db8::1 to 2001:db8::2
+func pcapTestIPv6(proto byte, payload []byte) []byte {
+	pkt := make([]byte, 40)
+	pkt[0] = 0x60
+	binary.BigEndian.PutUint16(pkt[4:6], uint16(len(payload)))
+	pkt[6] = proto
+	pkt[7] = 64
+	copy(pkt[8:24], []byte{0x20, 0x01, 0x0d, 0xb8, 15: 1})
+	copy(pkt[24:40], []byte{0x20, 0x01, 0x0d, 0xb8, 15: 2})
+	return append(pkt, payload...)
+}
+
+// pcapTestUDP - UDP datagram from port 5060 to port 5060
+func pcapTestUDP(payload string) []byte {
+	dgram := make([]byte, 8)
+	binary.BigEndian.PutUint16(dgram[0:2], 5060)
+	binary.BigEndian.PutUint16(dgram[2:4], 5060)
+	binary.BigEndian.PutUint16(dgram[4:6], uint16(8+len(payload)))
+	return append(dgram, payload...)
+}
+
+// pcapTestTCP - TCP segment from port 40000 to port 5060
+func pcapTestTCP(seq uint32, payload string) []byte {
+	seg := make([]byte, 20)
+	binary.BigEndian.PutUint16(seg[0:2], 40000)
+	binary.BigEndian.PutUint16(seg[2:4], 5060)
+	binary.BigEndian.PutUint32(seg[4:8], seq)
+	seg[12] = 5 << 4
+	seg[13] = 0x18
+	return append(seg, payload...)
+}
+
+// pcapTestExtract - write the capture to a file and extract its SIP messages
+func pcapTestExtract(t *testing.T, capture []byte) ([]pcapSIPMessage, error) {
+	filePath := path.Join(t.TempDir(), "test.pcap")
+	os.WriteFile(filePath, capture, 0600)
+	return pcapExtractSIPMessages(filePath)
+}
+
+type PcapExtractTest struct {
+	capture []byte
+
+	expectedErrMsg    string
+	expectedMessages  []string
+	expectedTransport string
+}
+
+func TestPcapExtractSIPMessages(t *testing.T) {
+	stream := pcapTestInvite + pcapTestBye
+	udpInvite := pcapTestUDP(pcapTestInvite)
+	truncatedIPv4 := pcapTestEthernet(0x0800, pcapTestIPv4(17, 1, 0, false, udpInvite))
+	tcpLongHdr := pcapTestTCP(1000, pcapTestInvite)
+	tcpLongHdr[12] = 15 << 4
+
+	testCases := map[string]PcapExtractTest{
+		"OK with UDP over Ethernet": {
+			capture:           pcapTestFile(pcapLinkEthernet, pcapTestEthernet(0x0800, pcapTestIPv4(17, 1, 0, false, udpInvite))),
+			expectedMessages:  []string{pcapTestInvite},
+			expectedTransport: "udp",
+		},
+		"OK with UDP over Ethernet with VLAN tag": {
+			capture: pcapTestFile(pcapLinkEthernet, pcapTestEthernet(0x8100,
+				append([]byte{0x00, 0x64, 0x08, 0x00}, pcapTestIPv4(17, 1, 0, false, udpInvite)...))),
+			expectedMessages:  []string{pcapTestInvite},
+			expectedTransport: "udp",
+		},
+		"OK with UDP over Linux SLL": {
+			capture:           pcapTestFile(pcapLinkSLL, pcapTestSLL(0x0800, pcapTestIPv4(17, 1, 0, false, udpInvite))),
+			expectedMessages:  []string{pcapTestInvite},
+			expectedTransport: "udp",
+		},
+		"OK with UDP over IPv6": {
+			capture:           pcapTestFile(pcapLinkEthernet, pcapTestEthernet(0x86dd, pcapTestIPv6(17, udpInvite))),
+			expectedMessages:  []string{pcapTestInvite},
+			expectedTransport: "udp",
+		},
+		"OK with fragmented IPv4 received out of order": {
+			capture: pcapTestFile(pcapLinkRaw,
+				pcapTestIPv4(17, 7, 48, false, udpInvite[48:]),
+				pcapTestIPv4(17, 7, 0, true, udpInvite[:24]),
+				pcapTestIPv4(17, 7, 24, true, udpInvite[24:48])),
+			expectedMessages:  []string{pcapTestInvite},
+			expectedTransport: "udp",
+		},
+		"OK without message with missing IPv4 fragment": {
+			capture: pcapTestFile(pcapLinkRaw,
+				pcapTestIPv4(17, 7, 0, true, udpInvite[:24]),
+				pcapTestIPv4(17, 7, 48, false, udpInvite[48:])),
+		},
+		"OK with out-of-order and retransmitted TCP segments": {
+			capture: pcapTestFile(pcapLinkRaw,
+				pcapTestIPv4(6, 1, 0, false, pcapTestTCP(1020, stream[20:70])),
+				pcapTestIPv4(6, 2, 0, false, pcapTestTCP(1000, stream[:20])),
+				pcapTestIPv4(6, 3, 0, false, pcapTestTCP(1000, stream[:20])),
+				pcapTestIPv4(6, 4, 0, false, pcapTestTCP(1070, stream[70:]))),
+			expectedMessages:  []string{pcapTestInvite, pcapTestBye},
+			expectedTransport: "tcp",
+		},
+		"OK with TCP message incomplete at the end of the capture": {
+			capture: pcapTestFile(pcapLinkRaw,
+				pcapTestIPv4(6, 1, 0, false, pcapTestTCP(1000, stream[:len(stream)-10]))),
+			expectedMessages:  []string{pcapTestInvite},
+			expectedTransport: "tcp",
+		},
+		"OK without message with overflowing Content-Length": {
+			capture: pcapTestFile(pcapLinkRaw,
+				pcapTestIPv4(6, 1, 0, false, pcapTestTCP(1000, "INVITE sip:a@b SIP/2.0\r\nContent-Length: 9223372036854775807\r\n\r\nv=0\n"))),
+		},
+		"OK without message with TCP header length beyond the segment": {
+			capture: pcapTestFile(pcapLinkRaw, pcapTestIPv4(6, 1, 0, false, tcpLongHdr[:40])),
+		},
+		"OK without message with IPv4 total length beyond the packet": {
+			capture: pcapTestFile(pcapLinkEthernet, truncatedIPv4[:len(truncatedIPv4)-10]),
+		},
+		"OK without message with truncated IPv4 header": {
+			capture: pcapTestFile(pcapLinkEthernet, pcapTestEthernet(0x0800, []byte{0x45, 0x00, 0x00})),
+		},
+		"OK with truncated record at the end of the file": {
+			capture: func() []byte {
+				capture := pcapTestFile(pcapLinkRaw,
+					pcapTestIPv4(17, 1, 0, false, udpInvite),
+					pcapTestIPv4(17, 2, 0, false, pcapTestUDP(pcapTestBye)))
+				return capture[:len(capture)-10]
+			}(),
+			expectedMessages:  []string{pcapTestInvite},
+			expectedTransport: "udp",
+		},
+		"OK without message with unsupported link type": {
+			capture: pcapTestFile(147, pcapTestIPv4(17, 1, 0, false, udpInvite)),
+		},
+		"Error with too short file": {
+			capture:        []byte{0xd4, 0xc3, 0xb2, 0xa1},
+			expectedErrMsg: "capture file too short",
+		},
+		"Error with pcapng file": {
+			capture:        append([]byte{0x0a, 0x0d, 0x0d, 0x0a}, make([]byte, 24)...),
+			expectedErrMsg: "pcapng format not supported - convert it to pcap (e.g., editcap -F pcap)",
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			messages, err := pcapTestExtract(t, testCase.capture)
+
+			if len(testCase.expectedErrMsg) > 0 {
+				expect(err.Error()).ToBe(testCase.expectedErrMsg)
+				return
+			}
+			expect(err).ToBe(nil)
+			var data []string
+			for _, msg := range messages {
+				data = append(data, string(msg.data))
+				expect(msg.transport).ToBe(testCase.expectedTransport)
+			}
+			expect(data).ToEqual(testCase.expectedMessages)
+		})
+	}
+
+	t.Run("OK with addresses of the UDP message", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		messages, _ := pcapTestExtract(t, pcapTestFile(pcapLinkRaw, pcapTestIPv6(17, udpInvite)))
+
+		expect(len(messages)).ToBe(1)
+		expect(messages[0].src).ToBe("[2001:db8::1]:5060")
+		expect(messages[0].dst).ToBe("[2001:db8::2]:5060")
+		expect(messages[0].ts.Unix()).ToBe(int64(1700000000))
+	})
+}
+
+func TestPcapTruncatedPackets(t *testing.T) {
+	udpInvite := pcapTestUDP(pcapTestInvite)
+	packets := map[string]struct {
+		linkType uint32
+		data     []byte
+	}{
+		"Ethernet UDP":  {pcapLinkEthernet, pcapTestEthernet(0x0800, pcapTestIPv4(17, 1, 0, false, udpInvite))},
+		"Ethernet VLAN": {pcapLinkEthernet, pcapTestEthernet(0x8100, append([]byte{0x00, 0x64, 0x86, 0xdd}, pcapTestIPv6(17, udpInvite)...))},
+		"SLL TCP":       {pcapLinkSLL, pcapTestSLL(0x0800, pcapTestIPv4(6, 1, 0, false, pcapTestTCP(1000, pcapTestInvite)))},
+		"SLL2 IPv6":     {pcapLinkSLL2, append(append([]byte{0x86, 0xdd}, make([]byte, 18)...), pcapTestIPv6(17, udpInvite)...)},
+		"Null IPv4":     {pcapLinkNull, append([]byte{2, 0, 0, 0}, pcapTestIPv4(17, 1, 0, false, udpInvite)...)},
+		"IPv4 fragment": {pcapLinkRaw, pcapTestIPv4(17, 1, 0, true, udpInvite[:24])},
+		"IPv6 ext hdr":  {pcapLinkIPv6, pcapTestIPv6(0, append([]byte{17, 0, 0, 0, 0, 0, 0, 0}, udpInvite...))},
+	}
+
+	// the packets and the capture file cut at each length are skipped
+	// without panic
+	for name, pkt := range packets {
+		t.Run(name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			for n := 0; n <= len(pkt.data); n++ {
+				_, err := pcapTestExtract(t, pcapTestFile(pkt.linkType, pkt.data[:n]))
+				expect(err).ToBe(nil)
+			}
+			capture := pcapTestFile(pkt.linkType, pkt.data)
+			for n := 24; n <= len(capture); n++ {
+				_, err := pcapTestExtract(t, capture[:n])
+				expect(err).ToBe(nil)
+			}
+		})
+	}
+}
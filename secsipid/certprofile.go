@@ -0,0 +1,48 @@
+package secsipid
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/asn1"
+	"strings"
+)
+
+// SJWTOIDSHAKENPolicy - OID of the SHAKEN certificate policy (ATIS-1000080)
+var SJWTOIDSHAKENPolicy = asn1.ObjectIdentifier{2, 16, 840, 1, 114569, 1, 1, 1}
+
+// SJWTCheckCertProfile - verify that the signing certificate follows the
+// SHAKEN certificate profile (ATIS-1000080), returning the code of the first
+// rule that is not satisfied
+func SJWTCheckCertProfile(cert *x509.Certificate) (int, error) {
+	hasPolicy := false
+	for _, policy := range cert.PolicyIdentifiers {
+		hasPolicy = hasPolicy || policy.Equal(SJWTOIDSHAKENPolicy)
+	}
+	if !hasPolicy {
+		return SJWTRetErrCertProfilePolicy, newError(SJWTRetErrCertProfilePolicy, "no SHAKEN certificate policy")
+	}
+
+	if cert.KeyUsage != x509.KeyUsageDigitalSignature {
+		return SJWTRetErrCertProfileKeyUsage, newError(SJWTRetErrCertProfileKeyUsage, "key usage not only digital signature")
+	}
+
+	ecdsaPubKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok || ecdsaPubKey.Curve != elliptic.P256() {
+		return SJWTRetErrCertProfileKey, newError(SJWTRetErrCertProfileKey, "public key not EC P-256")
+	}
+
+	if len(cert.CRLDistributionPoints) == 0 {
+		return SJWTRetErrCertProfileCRLDP, newError(SJWTRetErrCertProfileCRLDP, "no CRL distribution point")
+	}
+
+	if ret, err := checkTNAuthList(cert); err != nil {
+		return ret, err
+	}
+
+	if !strings.Contains(cert.Subject.CommonName, "SHAKEN") {
+		return SJWTRetErrCertProfileSubject, newError(SJWTRetErrCertProfileSubject, "subject common name without SHAKEN")
+	}
+
+	return SJWTRetOK, nil
+}
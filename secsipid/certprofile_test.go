@@ -0,0 +1,138 @@
+package secsipid_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+// generateProfileCert - certificate following the SHAKEN profile, changed
+// by the function before being signed by the CA
+func (gen DummyCertGenerator) generateProfileCert(change func(cert *x509.Certificate) interface{}) *x509.Certificate {
+	tnAuthListDER, _ := asn1.Marshal([]asn1.RawValue{tnAuthListEntry(0, "123A")})
+	prvKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cert := &x509.Certificate{
+		SerialNumber:          big.NewInt(2024),
+		Subject:               pkix.Name{CommonName: "SHAKEN 123A", Organization: []string{"Bar, Inc."}},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		PolicyIdentifiers:     []asn1.ObjectIdentifier{secsipid.SJWTOIDSHAKENPolicy},
+		CRLDistributionPoints: []string{"https://127.0.0.1/crl.der"},
+		ExtraExtensions:       []pkix.Extension{{Id: secsipid.SJWTOIDTNAuthList, Value: tnAuthListDER}},
+	}
+	var pubKey interface{} = &prvKey.PublicKey
+	if change != nil {
+		if key := change(cert); key != nil {
+			pubKey = key
+		}
+	}
+	certBytes, _ := x509.CreateCertificate(rand.Reader, cert, gen.ca, pubKey, gen.caPrivKey)
+	cert, _ = x509.ParseCertificate(certBytes)
+	return cert
+}
+
+type CheckCertProfileTest struct {
+	change func(cert *x509.Certificate) interface{}
+
+	expectedErrCode int
+}
+
+func TestCheckCertProfile(t *testing.T) {
+	ca := NewDummyCA()
+
+	testCases := map[string]CheckCertProfileTest{
+		"OK with SHAKEN profile": {
+			expectedErrCode: secsipid.SJWTRetOK,
+		},
+		"ErrCertProfilePolicy without SHAKEN policy": {
+			change: func(cert *x509.Certificate) interface{} {
+				cert.PolicyIdentifiers = []asn1.ObjectIdentifier{{2, 5, 29, 32, 0}}
+				return nil
+			},
+			expectedErrCode: secsipid.SJWTRetErrCertProfilePolicy,
+		},
+		"ErrCertProfileKeyUsage with key encipherment": {
+			change: func(cert *x509.Certificate) interface{} {
+				cert.KeyUsage |= x509.KeyUsageKeyEncipherment
+				return nil
+			},
+			expectedErrCode: secsipid.SJWTRetErrCertProfileKeyUsage,
+		},
+		"ErrCertProfileKey with P-384 key": {
+			change: func(cert *x509.Certificate) interface{} {
+				prvKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+				return &prvKey.PublicKey
+			},
+			expectedErrCode: secsipid.SJWTRetErrCertProfileKey,
+		},
+		"ErrCertProfileKey with RSA key": {
+			change: func(cert *x509.Certificate) interface{} {
+				prvKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+				return &prvKey.PublicKey
+			},
+			expectedErrCode: secsipid.SJWTRetErrCertProfileKey,
+		},
+		"ErrCertProfileCRLDP without CRL distribution point": {
+			change: func(cert *x509.Certificate) interface{} {
+				cert.CRLDistributionPoints = nil
+				return nil
+			},
+			expectedErrCode: secsipid.SJWTRetErrCertProfileCRLDP,
+		},
+		"ErrCertTNAuthList without TNAuthList": {
+			change: func(cert *x509.Certificate) interface{} {
+				cert.ExtraExtensions = nil
+				return nil
+			},
+			expectedErrCode: secsipid.SJWTRetErrCertTNAuthList,
+		},
+		"ErrCertProfileSubject without SHAKEN in common name": {
+			change: func(cert *x509.Certificate) interface{} {
+				cert.Subject.CommonName = "Bar 123A"
+				return nil
+			},
+			expectedErrCode: secsipid.SJWTRetErrCertProfileSubject,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			errCode, err := secsipid.SJWTCheckCertProfile(ca.generateProfileCert(testCase.change))
+
+			expect(errCode).ToBe(testCase.expectedErrCode)
+			expect(secsipid.SJWTErrorCode(err)).ToBe(testCase.expectedErrCode)
+		})
+	}
+
+	t.Run("Verifier with profile mode", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+			CertVerify: secsipid.SJWTCertVerifyCAFile | secsipid.SJWTCertVerifyProfile,
+			RootCAs:    []*x509.Certificate{parseDummyCA(ca)},
+		})
+		certPEM := func(cert *x509.Certificate) []byte {
+			return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		}
+
+		errCode, _ := verifier.PubKeyVerify(certPEM(ca.generateProfileCert(nil)))
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+
+		errCode, _ = verifier.PubKeyVerify(ca.generateCertWithTNAuthList(nil))
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertProfilePolicy)
+	})
+}
@@ -0,0 +1,188 @@
+package secsipid
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// marshalJSON - serialize v without escaping the HTML characters ('<', '>'
+// and '&'), as they are in the canonical form of RFC 8225
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	// the encoder ends the value with a new line
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// marshalClaims - serialize the structure with the extra members, in the
+// canonical form of RFC 8225 (members ordered lexicographically, no white
+// spaces); members of the structure take precedence over extra ones
+//
+// The fields of the claim structures are declared in lexicographic order, so
+// without extra members the structure is serialized directly.
+func marshalClaims(v interface{}, extra map[string]interface{}) ([]byte, error) {
+	data, err := marshalJSON(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+	members := map[string]interface{}{}
+	if err = unmarshalUseNumber(data, &members); err != nil {
+		return nil, err
+	}
+	for name, val := range extra {
+		if _, ok := members[name]; !ok {
+			members[name] = val
+		}
+	}
+	// maps are serialized with the keys sorted
+	return marshalJSON(members)
+}
+
+// unmarshalClaims - deserialize the data in the structure v (pointer), storing
+// the members that are not fields of the structure in the extra map
+func unmarshalClaims(data []byte, v interface{}, extra *map[string]interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	members := map[string]interface{}{}
+	if err := unmarshalUseNumber(data, &members); err != nil {
+		return err
+	}
+	for name := range jsonFieldNames(reflect.TypeOf(v).Elem()) {
+		delete(members, name)
+	}
+	if len(members) > 0 {
+		*extra = members
+	} else {
+		*extra = nil
+	}
+	return nil
+}
+
+// unmarshalUseNumber - deserialize keeping numbers as json.Number, to not lose
+// the precision of large integers
+func unmarshalUseNumber(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// jsonFieldNames - return the JSON member names of the structure fields
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if len(name) == 0 {
+			name = field.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// MarshalJSON - serialize the header with the extra members
+func (h SJWTHeader) MarshalJSON() ([]byte, error) {
+	type header SJWTHeader
+	return marshalClaims(header(h), h.Extra)
+}
+
+// UnmarshalJSON - deserialize the header, keeping the unknown members
+func (h *SJWTHeader) UnmarshalJSON(data []byte) error {
+	type header SJWTHeader
+	return unmarshalClaims(data, (*header)(h), &h.Extra)
+}
+
+// MarshalJSON - serialize the dest claim with the extra members, without tn
+// if there are only uri values
+func (d SJWTDest) MarshalJSON() ([]byte, error) {
+	if len(d.TN) == 0 && len(d.URI) > 0 {
+		return marshalClaims(struct {
+			URI []string `json:"uri"`
+		}{d.URI}, d.Extra)
+	}
+	type dest SJWTDest
+	return marshalClaims(dest(d), d.Extra)
+}
+
+// UnmarshalJSON - deserialize the dest claim, keeping the unknown members
+func (d *SJWTDest) UnmarshalJSON(data []byte) error {
+	type dest SJWTDest
+	return unmarshalClaims(data, (*dest)(d), &d.Extra)
+}
+
+// MarshalJSON - serialize the orig claim with the extra members, without tn
+// if there is only the uri value
+func (o SJWTOrig) MarshalJSON() ([]byte, error) {
+	if len(o.TN) == 0 && len(o.URI) > 0 {
+		return marshalClaims(struct {
+			URI string `json:"uri"`
+		}{o.URI}, o.Extra)
+	}
+	type orig SJWTOrig
+	return marshalClaims(orig(o), o.Extra)
+}
+
+// UnmarshalJSON - deserialize the orig claim, keeping the unknown members
+func (o *SJWTOrig) UnmarshalJSON(data []byte) error {
+	type orig SJWTOrig
+	return unmarshalClaims(data, (*orig)(o), &o.Extra)
+}
+
+// MarshalJSON - serialize the payload with the extra claims
+func (p SJWTPayload) MarshalJSON() ([]byte, error) {
+	type payload SJWTPayload
+	return marshalClaims(payload(p), p.Extra)
+}
+
+// UnmarshalJSON - deserialize the payload, keeping the unknown claims
+func (p *SJWTPayload) UnmarshalJSON(data []byte) error {
+	type payload SJWTPayload
+	return unmarshalClaims(data, (*payload)(p), &p.Extra)
+}
+
+// MarshalJSON - serialize the payload with the extra claims
+func (p SJWTDivPayload) MarshalJSON() ([]byte, error) {
+	type payload SJWTDivPayload
+	return marshalClaims(payload(p), p.Extra)
+}
+
+// UnmarshalJSON - deserialize the payload, keeping the unknown claims
+func (p *SJWTDivPayload) UnmarshalJSON(data []byte) error {
+	type payload SJWTDivPayload
+	return unmarshalClaims(data, (*payload)(p), &p.Extra)
+}
+
+// MarshalJSON - serialize the payload with the extra claims
+func (p SJWTRCDPayload) MarshalJSON() ([]byte, error) {
+	type payload SJWTRCDPayload
+	return marshalClaims(payload(p), p.Extra)
+}
+
+// UnmarshalJSON - deserialize the payload, keeping the unknown claims
+func (p *SJWTRCDPayload) UnmarshalJSON(data []byte) error {
+	type payload SJWTRCDPayload
+	return unmarshalClaims(data, (*payload)(p), &p.Extra)
+}
+
+// MarshalJSON - serialize the payload with the extra claims
+func (p SJWTRPHPayload) MarshalJSON() ([]byte, error) {
+	type payload SJWTRPHPayload
+	return marshalClaims(payload(p), p.Extra)
+}
+
+// UnmarshalJSON - deserialize the payload, keeping the unknown claims
+func (p *SJWTRPHPayload) UnmarshalJSON(data []byte) error {
+	type payload SJWTRPHPayload
+	return unmarshalClaims(data, (*payload)(p), &p.Extra)
+}
@@ -0,0 +1,125 @@
+package secsipid_test
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestClaimsRoundTrip(t *testing.T) {
+	t.Run("Unknown members are kept in canonical order", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		input := `{"orig":{"tn":"493055555555","xuri":"sip:alice@127.0.0.1"},"iat":1578935880,` +
+			`"dest":{"xuri":["sip:bob@127.0.0.1"],"tn":["493044444444"]},"zz":{"b":1,"a":12345678901234567890},` +
+			`"attest":"A","origid":"origid-1","ext":"value"}`
+
+		payload := secsipid.SJWTPayload{}
+		err := json.Unmarshal([]byte(input), &payload)
+		expect(err).ToBe(nil)
+
+		expect(payload.Orig.TN).ToBe("493055555555")
+		expect(payload.Orig.Extra["xuri"]).ToBe("sip:alice@127.0.0.1")
+		expect(payload.Dest.Extra["xuri"]).ToEqual([]interface{}{"sip:bob@127.0.0.1"})
+		expect(payload.Extra["ext"]).ToBe("value")
+
+		output, _ := json.Marshal(payload)
+		expect(string(output)).ToBe(`{"attest":"A","dest":{"tn":["493044444444"],"xuri":["sip:bob@127.0.0.1"]},` +
+			`"ext":"value","iat":1578935880,"orig":{"tn":"493055555555","xuri":"sip:alice@127.0.0.1"},` +
+			`"origid":"origid-1","zz":{"a":12345678901234567890,"b":1}}`)
+	})
+
+	t.Run("No extra members for known claims", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		header := secsipid.SJWTHeader{}
+		json.Unmarshal([]byte(`{"alg":"ES256","ppt":"shaken","typ":"passport","x5u":"https://127.0.0.1/cert.pem"}`), &header)
+
+		expect(header).ToEqual(secsipid.SJWTHeader{
+			Alg: "ES256",
+			Ppt: "shaken",
+			Typ: "passport",
+			X5u: "https://127.0.0.1/cert.pem",
+		})
+	})
+
+	t.Run("Extra claims are signed and exposed when decoding", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		keyPath := path.Join(t.TempDir(), "ec256-private.pem")
+		prvKey, pubKey := writeDummyECKey(keyPath)
+		ecdsaPubKey, _, _ := secsipid.SJWTParseECPublicKeyFromPEM(pubKey)
+
+		header := secsipid.SJWTHeader{
+			Alg:   "ES256",
+			Ppt:   "shaken",
+			Typ:   "passport",
+			X5u:   "https://127.0.0.1/cert.pem",
+			Extra: map[string]interface{}{"kid": "key-1"},
+		}
+		payload := secsipid.SJWTPayload{
+			ATTest: "A",
+			Dest:   secsipid.SJWTDest{TN: []string{"493044444444"}},
+			IAT:    time.Now().Unix(),
+			Orig: secsipid.SJWTOrig{
+				TN:    "493055555555",
+				Extra: map[string]interface{}{"xuri": "sip:alice@127.0.0.1"},
+			},
+			OrigID: "origid-1",
+			Extra:  map[string]interface{}{"ext": "value"},
+		}
+
+		token := secsipid.SJWTEncode(header, payload, prvKey)
+		decoded, err := secsipid.SJWTDecodeWithPubKey(token, 60, ecdsaPubKey)
+
+		expect(err).ToBe(nil)
+		expect(decoded.Orig.Extra["xuri"]).ToBe("sip:alice@127.0.0.1")
+		expect(decoded.Extra["ext"]).ToBe("value")
+	})
+
+	t.Run("Signed claims without escaped HTML characters", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		keyPath := path.Join(t.TempDir(), "ec256-private.pem")
+		prvKey, _ := writeDummyECKey(keyPath)
+
+		header := secsipid.SJWTHeader{Alg: "ES256", Ppt: "shaken", Typ: "passport", X5u: "https://127.0.0.1/cert.pem?a=1&b=2"}
+		payload := secsipid.SJWTPayload{
+			ATTest: "A",
+			Dest:   secsipid.SJWTDest{TN: []string{"493044444444"}},
+			IAT:    1578935880,
+			Orig:   secsipid.SJWTOrig{TN: "493055555555"},
+			OrigID: "origid-1",
+			RCD:    &secsipid.SJWTRCD{Jcl: "https://127.0.0.1/jcard?a=<1>&b=2", Nam: "Alice & Bob"},
+		}
+
+		token := strings.Split(secsipid.SJWTEncode(header, payload, prvKey), ".")
+		headerJSON, _ := secsipid.SJWTBase64DecodeString(token[0])
+		payloadJSON, _ := secsipid.SJWTBase64DecodeString(token[1])
+
+		expect(headerJSON).ToBe(`{"alg":"ES256","ppt":"shaken","typ":"passport","x5u":"https://127.0.0.1/cert.pem?a=1&b=2"}`)
+		expect(payloadJSON).ToBe(`{"attest":"A","dest":{"tn":["493044444444"]},"iat":1578935880,` +
+			`"orig":{"tn":"493055555555"},"origid":"origid-1",` +
+			`"rcd":{"jcl":"https://127.0.0.1/jcard?a=<1>&b=2","nam":"Alice & Bob"}}`)
+	})
+
+	t.Run("Orig and dest keep tn unless only uri is set", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		output, _ := json.Marshal(secsipid.SJWTPayload{})
+		expect(strings.Contains(string(output), `"dest":{"tn":null},`)).ToBe(true)
+		expect(strings.Contains(string(output), `"orig":{"tn":""},`)).ToBe(true)
+
+		output, _ = json.Marshal(secsipid.SJWTPayload{
+			Dest: secsipid.SJWTDest{URI: []string{"sip:bob@127.0.0.1"}},
+			Orig: secsipid.SJWTOrig{URI: "sip:alice@127.0.0.1"},
+		})
+		expect(strings.Contains(string(output), `"dest":{"uri":["sip:bob@127.0.0.1"]},`)).ToBe(true)
+		expect(strings.Contains(string(output), `"orig":{"uri":"sip:alice@127.0.0.1"},`)).ToBe(true)
+	})
+}
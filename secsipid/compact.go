@@ -0,0 +1,199 @@
+package secsipid
+
+import (
+	"crypto/ecdsa"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sjwtCompactHeader - JSON header of a PASSporT in compact form, the ppt
+// being set only when the Identity header has the ppt parameter
+type sjwtCompactHeader struct {
+	Alg string `json:"alg"`
+	Ppt string `json:"ppt,omitempty"`
+	Typ string `json:"typ"`
+	X5u string `json:"x5u"`
+}
+
+// sjwtCompactPayload - payload of a PASSporT in compact form, with the claims
+// that can be rebuilt from the SIP request (RFC 8225 section 7)
+type sjwtCompactPayload struct {
+	Dest SJWTDest `json:"dest"`
+	IAT  int64    `json:"iat"`
+	Orig SJWTOrig `json:"orig"`
+}
+
+// SJWTIsCompactIdentity - return true if the Identity header value has the
+// PASSporT in compact form (JWT header and payload omitted)
+func SJWTIsCompactIdentity(identityVal string) bool {
+	identityVal = identityHdrNameRE.ReplaceAllString(strings.TrimSpace(identityVal), "")
+	return strings.HasPrefix(strings.TrimSpace(identityVal), "..")
+}
+
+// sjwtGetCompactIdentity - build the Identity header value with the PASSporT
+// in compact form; only the dest, iat and orig claims are signed, the
+// telephone numbers in canonical form, so the verifier can rebuild them
+func sjwtGetCompactIdentity(opts SJWTIdentityOptions, iat int64, prvkey *ecdsa.PrivateKey) (string, int, error) {
+	if len(opts.Ppt) > 0 || opts.RCD != nil || len(opts.CRN) > 0 || len(opts.RPH) > 0 {
+		return "", SJWTRetErrJSONHdrPpt, newError(SJWTRetErrJSONHdrPpt,
+			"compact form only for PASSporTs without extension claims")
+	}
+
+	header := sjwtCompactHeader{
+		Alg: "ES256",
+		Typ: "passport",
+		X5u: opts.X5u,
+	}
+	payload := sjwtCompactPayload{
+		Dest: SJWTDest{
+			TN:  sjwtCanonicalTNs(opts.DestTNs, opts.CountryCode),
+			URI: opts.DestURIs,
+		},
+		IAT: iat,
+		Orig: SJWTOrig{
+			URI: opts.OrigURI,
+		},
+	}
+	if len(opts.OrigTN) > 0 {
+		payload.Orig.TN = SJWTCanonicalizeTN(opts.OrigTN, opts.CountryCode)
+	}
+
+	token, ret, err := sjwtEncode(header, payload, prvkey)
+	if err != nil {
+		return "", ret, err
+	}
+	btoken := strings.Split(token, ".")
+	hdr := IdentityHeader{
+		Token: ".." + btoken[2],
+		Info:  header.X5u,
+		Alg:   header.Alg,
+	}
+	return hdr.String(), SJWTRetOK, nil
+}
+
+// CheckCompactIdentityResult - verify the Identity header with the PASSporT
+// in compact form, rebuilding the JSON header from the header parameters and
+// the payload from the From, To and Date values of the SIP request
+//
+// The orig and dest claims are set to the canonical form of the user part of
+// the From and To URIs if it is a telephone number, otherwise to the URIs.
+func (v *Verifier) CheckCompactIdentityResult(identityVal string, pubkeyPath string, hdrs SJWTSIPHeaders) *VerificationResult {
+	tstart := time.Now()
+	res := &VerificationResult{}
+	res.ErrCode, res.Err = v.checkCompactIdentity(identityVal, pubkeyPath, hdrs, res)
+	res.Elapsed = time.Since(tstart)
+	return res
+}
+
+func (v *Verifier) checkCompactIdentity(identityVal string, pubkeyPath string, hdrs SJWTSIPHeaders, res *VerificationResult) (int, error) {
+	hdr, ret, err := SJWTParseIdentityHeader(identityVal)
+	if err != nil {
+		return ret, err
+	}
+	btoken := strings.Split(hdr.Token, ".")
+	if len(btoken) != 3 || len(btoken[0]) > 0 || len(btoken[1]) > 0 || len(btoken[2]) == 0 {
+		return SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "invalid token - not in compact form")
+	}
+	if !hdr.hasParams() {
+		return SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "missing parameters of the identity header")
+	}
+
+	header := sjwtCompactHeader{
+		Alg: "ES256",
+		Ppt: hdr.Ppt,
+		Typ: "passport",
+	}
+	paramInfo, ret, err := hdr.validInfo(header.Ppt)
+	if err != nil {
+		return ret, err
+	}
+	res.Info = paramInfo
+	header.X5u = paramInfo
+	res.Header = &SJWTHeader{Alg: header.Alg, Ppt: header.Ppt, Typ: header.Typ, X5u: header.X5u}
+
+	payload, ret, err := v.compactPayload(hdrs)
+	if err != nil {
+		return ret, err
+	}
+	res.setPayload(&SJWTPayload{Dest: payload.Dest, IAT: payload.IAT, Orig: payload.Orig})
+
+	if ret, err = v.checkIAT(payload.IAT); err != nil {
+		return ret, err
+	}
+
+	if len(pubkeyPath) == 0 {
+		pubkeyPath = paramInfo
+	}
+	ecdsaPubKey, ret, err := v.getPubKey(pubkeyPath, 0, payload.IAT, payload.Orig.TN, res)
+	if err != nil {
+		return ret, err
+	}
+
+	jsonHeader, _ := marshalJSON(header)
+	jsonPayload, _ := marshalJSON(payload)
+	signingValue := SJWTBase64EncodeString(string(jsonHeader)) + "." + SJWTBase64EncodeString(string(jsonPayload))
+	return SJWTVerifyWithPubKey(signingValue, btoken[2], ecdsaPubKey)
+}
+
+// compactPayload - rebuild the payload of a PASSporT in compact form from the
+// values of the SIP request
+func (v *Verifier) compactPayload(hdrs SJWTSIPHeaders) (*sjwtCompactPayload, int, error) {
+	payload := &sjwtCompactPayload{}
+
+	fromURIs := sjwtSIPHeaderURIs(hdrs.From)
+	if len(fromURIs) == 0 {
+		return nil, SJWTRetErrJSONPayloadOrig, newError(SJWTRetErrJSONPayloadOrig, "no From header to rebuild orig claim")
+	}
+	if tn, ok := v.compactTN(fromURIs[0]); ok {
+		payload.Orig.TN = tn
+	} else {
+		payload.Orig.URI = sjwtSIPURIBase(fromURIs[0])
+	}
+
+	toURIs := sjwtSIPHeaderURIs(hdrs.To)
+	if len(toURIs) == 0 {
+		return nil, SJWTRetErrJSONPayloadDest, newError(SJWTRetErrJSONPayloadDest, "no To header to rebuild dest claim")
+	}
+	if tn, ok := v.compactTN(toURIs[0]); ok {
+		payload.Dest.TN = []string{tn}
+	} else {
+		payload.Dest.URI = []string{sjwtSIPURIBase(toURIs[0])}
+	}
+
+	if len(strings.TrimSpace(hdrs.Date)) == 0 {
+		return nil, SJWTRetErrJSONPayloadDate, newError(SJWTRetErrJSONPayloadDate, "no Date header to rebuild iat claim")
+	}
+	tDate, err := http.ParseTime(strings.TrimSpace(hdrs.Date))
+	if err != nil {
+		return nil, SJWTRetErrJSONPayloadDate, wrapError(SJWTRetErrJSONPayloadDate, "invalid Date header", err)
+	}
+	payload.IAT = tDate.Unix()
+
+	return payload, SJWTRetOK, nil
+}
+
+// compactTN - return the canonical form of the user part of the URI and true
+// if it is a telephone number
+func (v *Verifier) compactTN(uri string) (string, bool) {
+	user := sjwtSIPURIUser(uri)
+	if len(user) == 0 {
+		return "", false
+	}
+	tn := SJWTCanonicalizeTN(user, v.opts.CountryCode)
+	if len(tn) == 0 {
+		return "", false
+	}
+	for _, c := range tn {
+		if (c < '0' || c > '9') && c != '*' && c != '#' {
+			return "", false
+		}
+	}
+	return tn, true
+}
+
+// SJWTCheckCompactIdentityResult - verify the Identity header with the
+// PASSporT in compact form, rebuilt from the values of the SIP request
+func SJWTCheckCompactIdentityResult(identityVal string, expireVal int, pubkeyPath string, timeoutVal int, hdrs SJWTSIPHeaders) *VerificationResult {
+	return defaultVerifier(expireVal, timeoutVal).CheckCompactIdentityResult(identityVal, pubkeyPath, hdrs)
+}
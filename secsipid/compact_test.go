@@ -0,0 +1,138 @@
+package secsipid_test
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestCompactIdentity(t *testing.T) {
+	keyPath := path.Join(t.TempDir(), "ec256-private.pem")
+	_, pubKey := writeDummyECKey(keyPath)
+	pubKeyPath := path.Join(t.TempDir(), "ec256-public.pem")
+	os.WriteFile(pubKeyPath, pubKey, 0600)
+
+	now := time.Now().Truncate(time.Second)
+	signer, _, _ := secsipid.NewSigner(secsipid.SignerOptions{
+		PrvKeyPath: keyPath,
+		X5u:        "https://127.0.0.1/cert.pem",
+		Now:        func() time.Time { return now },
+	})
+	verifier := secsipid.NewVerifier(secsipid.VerifierOptions{Expire: 60, CountryCode: "1"})
+
+	identity, errCode, _ := signer.SignOpts(secsipid.SJWTIdentityOptions{
+		OrigTN:      "+1 (555) 987-6543",
+		DestTNs:     []string{"15551234567"},
+		CountryCode: "1",
+		Compact:     true,
+	})
+	hdrs := secsipid.SJWTSIPHeaders{
+		From: "<sip:+15559876543@127.0.0.1;user=phone>;tag=1",
+		To:   "<tel:555-123-4567>",
+		Date: now.UTC().Format(http.TimeFormat),
+	}
+
+	t.Run("Signer builds the compact form", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		expect(secsipid.SJWTIsCompactIdentity(identity)).ToBe(true)
+		expect(strings.HasSuffix(identity, ";info=<https://127.0.0.1/cert.pem>;alg=ES256")).ToBe(true)
+	})
+
+	t.Run("OK with the values of the SIP request", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		res := verifier.CheckCompactIdentityResult(identity, pubKeyPath, hdrs)
+
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetOK)
+		expect(res.Payload.Orig.TN).ToBe("15559876543")
+		expect(res.Payload.Dest.TN).ToEqual([]string{"15551234567"})
+		expect(res.Payload.IAT).ToBe(now.Unix())
+		expect(res.Header.X5u).ToBe("https://127.0.0.1/cert.pem")
+	})
+
+	t.Run("OK with the SIP message", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		msg := strings.Join([]string{
+			"INVITE sip:+15551234567@127.0.0.1 SIP/2.0",
+			"f: " + hdrs.From,
+			"t: " + hdrs.To,
+			"Date: " + hdrs.Date,
+			"y: " + identity,
+			"", "",
+		}, "\r\n")
+		res := verifier.CheckSIPMessageResult([]byte(msg), pubKeyPath)
+
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetOK)
+		expect(res.SIP.OK()).ToBe(true)
+	})
+
+	t.Run("ErrJSONSignatureInvalid with mismatching From", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		mHdrs := hdrs
+		mHdrs.From = "<sip:+15550000000@127.0.0.1>"
+		res := verifier.CheckCompactIdentityResult(identity, pubKeyPath, mHdrs)
+
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetErrJSONSignatureInvalid)
+	})
+
+	t.Run("ErrJSONSignatureInvalid with mismatching Date", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		mHdrs := hdrs
+		mHdrs.Date = now.Add(-time.Second).UTC().Format(http.TimeFormat)
+		res := verifier.CheckCompactIdentityResult(identity, pubKeyPath, mHdrs)
+
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetErrJSONSignatureInvalid)
+	})
+
+	t.Run("ErrJSONPayloadDate without Date", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		mHdrs := hdrs
+		mHdrs.Date = ""
+		res := verifier.CheckCompactIdentityResult(identity, pubKeyPath, mHdrs)
+
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetErrJSONPayloadDate)
+	})
+
+	t.Run("ErrSIPHdrParse with full form", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		full, _, _ := signer.Sign("15559876543", []string{"15551234567"}, "A", "")
+		res := verifier.CheckCompactIdentityResult(full, pubKeyPath, hdrs)
+
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetErrSIPHdrParse)
+	})
+
+	t.Run("ErrSIPHdrParse with compact form without SIP values", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		errCode, _ := verifier.CheckFullIdentity(identity, pubKeyPath)
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrSIPHdrParse)
+	})
+
+	t.Run("ErrJSONHdrPpt when signing compact form with ppt", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, errCode, _ := signer.SignOpts(secsipid.SJWTIdentityOptions{
+			Ppt:     secsipid.SJWTPptRPH,
+			OrigTN:  "15559876543",
+			DestTNs: []string{"15551234567"},
+			RPH:     []string{"ets.0"},
+			Compact: true,
+		})
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONHdrPpt)
+	})
+}
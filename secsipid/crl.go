@@ -0,0 +1,266 @@
+package secsipid
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SJWTParseCRLs - parse the certificate revocation lists in PEM format (one
+// or more "X509 CRL" blocks) or in DER format (a single CRL)
+func SJWTParseCRLs(data []byte) ([]*x509.RevocationList, int, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		crlVal, err := x509.ParseRevocationList(data)
+		if err != nil {
+			return nil, SJWTRetErrCertCRLParse, wrapError(SJWTRetErrCertCRLParse, "failed to parse CRL", err)
+		}
+		return []*x509.RevocationList{crlVal}, SJWTRetOK, nil
+	}
+
+	var crlList []*x509.RevocationList
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "X509 CRL" && block.Type != "CRL" {
+			continue
+		}
+		crlVal, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, SJWTRetErrCertCRLParse, wrapError(SJWTRetErrCertCRLParse, "failed to parse CRL", err)
+		}
+		crlList = append(crlList, crlVal)
+	}
+	if len(crlList) == 0 {
+		return nil, SJWTRetErrCertCRLParse, newError(SJWTRetErrCertCRLParse, "no CRL in PEM data")
+	}
+	return crlList, SJWTRetOK, nil
+}
+
+// loadCRLFiles - read the CRLs of the comma separated paths, each being a
+// file or a directory whose files are all read
+func loadCRLFiles(crlPaths string) ([]*x509.RevocationList, int, error) {
+	var filePaths []string
+	for _, crlPath := range strings.Split(crlPaths, ",") {
+		crlPath = strings.TrimSpace(crlPath)
+		if len(crlPath) == 0 {
+			continue
+		}
+		fileStat, err := os.Stat(crlPath)
+		if err != nil {
+			return nil, SJWTRetErrCertReadCRLFile, wrapError(SJWTRetErrCertReadCRLFile, "failed to read CRL file", err)
+		}
+		if !fileStat.IsDir() {
+			filePaths = append(filePaths, crlPath)
+			continue
+		}
+		dirEntries, err := ioutil.ReadDir(crlPath)
+		if err != nil {
+			return nil, SJWTRetErrCertReadCRLFile, wrapError(SJWTRetErrCertReadCRLFile, "failed to read CRL directory", err)
+		}
+		for _, dirEntry := range dirEntries {
+			if dirEntry.Mode().IsRegular() && !strings.HasPrefix(dirEntry.Name(), ".") {
+				filePaths = append(filePaths, filepath.Join(crlPath, dirEntry.Name()))
+			}
+		}
+	}
+
+	var crlList []*x509.RevocationList
+	for _, filePath := range filePaths {
+		data, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return nil, SJWTRetErrCertReadCRLFile, wrapError(SJWTRetErrCertReadCRLFile, "failed to read CRL file", err)
+		}
+		fileCRLs, ret, err := SJWTParseCRLs(data)
+		if err != nil {
+			return nil, ret, wrapError(ret, "invalid CRL file "+filePath, err)
+		}
+		crlList = append(crlList, fileCRLs...)
+	}
+	return crlList, SJWTRetOK, nil
+}
+
+// checkCRLList - verify that the certificates of the chain, except the trust
+// anchor, are not revoked by the CRLs issued by their issuers; there must be
+// at least one CRL of the issuer of the signing certificate
+func (v *Verifier) checkCRLList(certChain []*x509.Certificate, crlList []*x509.RevocationList) (int, error) {
+	for i, cert := range certChain {
+		if isSelfSigned(cert) {
+			continue
+		}
+		found := false
+		for _, crlVal := range crlList {
+			if !isCRLIssuer(crlVal, cert) {
+				continue
+			}
+			found = true
+			if ret, err := v.checkCRL(crlVal, chainIssuer(certChain, i)); err != nil {
+				return ret, err
+			}
+			if isRevoked(cert, crlVal) {
+				return SJWTRetErrCertRevoked, newError(SJWTRetErrCertRevoked, "serial number match - certificate is revoked")
+			}
+		}
+		if !found && i == 0 {
+			return SJWTRetErrCertNoCRLFile, newError(SJWTRetErrCertNoCRLFile, "no CRL of the certificate issuer")
+		}
+	}
+	return SJWTRetOK, nil
+}
+
+// checkCRLDP - verify that the certificates of the chain, except the trust
+// anchor, are not revoked by the CRLs of their distribution points, a
+// distribution point serving one or more CRLs; the signing certificate must
+// have at least one http(s) distribution point
+func (v *Verifier) checkCRLDP(certChain []*x509.Certificate) (int, error) {
+	for i, cert := range certChain {
+		if isSelfSigned(cert) {
+			continue
+		}
+		found := false
+		for _, dpURL := range cert.CRLDistributionPoints {
+			if !(strings.HasPrefix(dpURL, "http://") || strings.HasPrefix(dpURL, "https://")) {
+				continue
+			}
+			found = true
+			crlList, ret, err := v.getCRL(dpURL)
+			if err != nil {
+				return ret, err
+			}
+			for _, crlVal := range crlList {
+				if ret, err = v.checkCRL(crlVal, chainIssuer(certChain, i)); err != nil {
+					return ret, err
+				}
+				if isRevoked(cert, crlVal) {
+					return SJWTRetErrCertRevoked, newError(SJWTRetErrCertRevoked, "serial number match - certificate is revoked")
+				}
+			}
+		}
+		if !found && i == 0 {
+			return SJWTRetErrCertCRLDP, newError(SJWTRetErrCertCRLDP, "no http CRL distribution point in the certificate")
+		}
+	}
+	return SJWTRetOK, nil
+}
+
+// checkCRL - verify that the CRL is signed by the issuer of the checked
+// certificate and that it is valid at the current time, accepting it for
+// CRLGrace seconds after its next update; the time of iat is not used, being
+// only for the validity of the certificate (CertTimeIAT), and the time is not
+// checked with SkipCRLTime
+func (v *Verifier) checkCRL(crlVal *x509.RevocationList, issuer *x509.Certificate) (int, error) {
+	if issuer == nil {
+		return SJWTRetErrCertCRLSignature, newError(SJWTRetErrCertCRLSignature, "no issuer certificate to verify the CRL")
+	}
+	if err := crlVal.CheckSignatureFrom(issuer); err != nil {
+		return SJWTRetErrCertCRLSignature, wrapError(SJWTRetErrCertCRLSignature, "CRL not signed by the certificate issuer", err)
+	}
+
+	if v.opts.SkipCRLTime {
+		return SJWTRetOK, nil
+	}
+	tnow := v.opts.Now()
+	grace := time.Duration(v.opts.CRLGrace) * time.Second
+	if tnow.Add(grace).Before(crlVal.ThisUpdate) {
+		return SJWTRetErrCertCRLStale, newError(SJWTRetErrCertCRLStale, "CRL not valid yet")
+	}
+	nextUpdate := crlVal.NextUpdate
+	if !nextUpdate.IsZero() && tnow.After(nextUpdate.Add(grace)) {
+		return SJWTRetErrCertCRLStale, newError(SJWTRetErrCertCRLStale, "stale CRL - after its next update")
+	}
+	return SJWTRetOK, nil
+}
+
+// getCRL - return the CRLs of the distribution point URL, from the cache if
+// it is enabled and the cached CRLs are not after their next update,
+// otherwise downloaded and stored in the cache
+func (v *Verifier) getCRL(dpURL string) ([]*x509.RevocationList, int, error) {
+	if len(v.opts.CacheDirPath) > 0 {
+		if crlList := v.getCachedCRL(dpURL); crlList != nil {
+			return crlList, SJWTRetOK, nil
+		}
+	}
+
+	data, _, err := v.httpGet(dpURL)
+	if err != nil {
+		return nil, SJWTRetErrCertCRLDP, wrapError(SJWTRetErrCertCRLDP, "failed to get CRL from "+dpURL, err)
+	}
+	crlList, ret, err := SJWTParseCRLs(data)
+	if err != nil {
+		return nil, ret, wrapError(ret, "invalid CRL from "+dpURL, err)
+	}
+
+	if len(v.opts.CacheDirPath) > 0 {
+		v.SetURLCachedContent(dpURL, data)
+	}
+	return crlList, SJWTRetOK, nil
+}
+
+// getCachedCRL - return the cached CRLs of the URL, nil if there are none or
+// one of them is after its next update by the wall clock; a CRL without next
+// update expires like the other cached content
+func (v *Verifier) getCachedCRL(dpURL string) []*x509.RevocationList {
+	filePath := v.GetURLCacheFilePath(dpURL)
+
+	fileStat, err := os.Stat(filePath)
+	if err != nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+	crlList, _, err := SJWTParseCRLs(data)
+	if err != nil {
+		return nil
+	}
+	for _, crlVal := range crlList {
+		nextUpdate := crlVal.NextUpdate
+		if nextUpdate.IsZero() {
+			nextUpdate = fileStat.ModTime().Add(time.Duration(v.opts.CacheExpire) * time.Second)
+		}
+		if !time.Now().Before(nextUpdate) {
+			return nil
+		}
+	}
+	return crlList
+}
+
+// isCRLIssuer - return true if the CRL is issued by the issuer of the
+// certificate, comparing the names
+func isCRLIssuer(crlVal *x509.RevocationList, cert *x509.Certificate) bool {
+	return crlVal.Issuer.String() == cert.Issuer.String()
+}
+
+// chainIssuer - return the issuer of the certificate at the index in the
+// chain, nil if it is not in the chain
+func chainIssuer(certChain []*x509.Certificate, i int) *x509.Certificate {
+	if i+1 < len(certChain) && bytes.Equal(certChain[i+1].RawSubject, certChain[i].RawIssuer) {
+		return certChain[i+1]
+	}
+	return nil
+}
+
+// isRevoked - return true if the serial number of the certificate is in the
+// list of revoked certificates
+func isRevoked(cert *x509.Certificate, crlVal *x509.RevocationList) bool {
+	for _, revoked := range crlVal.RevokedCertificateEntries {
+		if cert.SerialNumber.Cmp(revoked.SerialNumber) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isSelfSigned - return true if the certificate is issued by itself, like
+// the root CAs
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil
+}
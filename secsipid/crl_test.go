@@ -0,0 +1,473 @@
+package secsipid_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+// generateCertWithCRLDP - certificate signed by the CA, with the CRL
+// distribution point if not empty; it is a CA certificate if isCA is true
+func (gen DummyCertGenerator) generateCertWithCRLDP(serialNum int64, isCA bool, dpURL string) DummyCertGenerator {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(serialNum),
+		Subject:      pkix.Name{Organization: []string{"CRL DP, Inc."}, SerialNumber: big.NewInt(serialNum).String()},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if len(dpURL) > 0 {
+		cert.CRLDistributionPoints = []string{dpURL}
+	}
+	if isCA {
+		cert.IsCA = true
+		cert.BasicConstraintsValid = true
+		cert.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+	certBytes, _ := x509.CreateCertificate(rand.Reader, cert, gen.ca, &privKey.PublicKey, gen.caPrivKey)
+	cert, _ = x509.ParseCertificate(certBytes)
+
+	certPEM := new(bytes.Buffer)
+	pem.Encode(certPEM, &pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: certBytes,
+	})
+
+	return DummyCertGenerator{
+		ca:         cert,
+		caPrivKey:  privKey,
+		caPEMBytes: certPEM.Bytes(),
+	}
+}
+
+// generateCRL - DER CRL signed by the CA, revoking the serial numbers,
+// issued two hours before its next update
+func (gen DummyCertGenerator) generateCRL(nextUpdate time.Time, serialNums ...int64) []byte {
+	crl := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: nextUpdate.Add(-2 * time.Hour),
+		NextUpdate: nextUpdate,
+	}
+	for _, serialNum := range serialNums {
+		crl.RevokedCertificates = append(crl.RevokedCertificates, pkix.RevokedCertificate{
+			SerialNumber:   big.NewInt(serialNum),
+			RevocationTime: time.Now(),
+		})
+	}
+	crlBytes, _ := x509.CreateRevocationList(rand.Reader, crl, gen.ca, gen.caPrivKey)
+	return crlBytes
+}
+
+// crlTestServer - http server of CRLs, counting the requests
+type crlTestServer struct {
+	mu   sync.Mutex
+	crls map[string][]byte
+	hits map[string]int
+	*httptest.Server
+}
+
+func newCRLTestServer() *crlTestServer {
+	s := &crlTestServer{crls: map[string][]byte{}, hits: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.hits[r.URL.Path]++
+		crl, ok := s.crls[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(crl)
+	}))
+	return s
+}
+
+func (s *crlTestServer) set(path string, crl []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.crls[path] = crl
+	s.hits = map[string]int{}
+}
+
+func (s *crlTestServer) hitCount(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[path]
+}
+
+func TestVerifierCRLDP(t *testing.T) {
+	srv := newCRLTestServer()
+	defer srv.Close()
+
+	ca := NewDummyCA()
+	inter := ca.generateCertWithCRLDP(100, true, srv.URL+"/inter.crl")
+	leaf := inter.generateCertWithCRLDP(200, false, srv.URL+"/leaf.crl")
+	pubKey := append(append([]byte{}, leaf.caPEMBytes...), inter.caPEMBytes...)
+
+	newVerifier := func(cacheDir string, tnow time.Time) *secsipid.Verifier {
+		return secsipid.NewVerifier(secsipid.VerifierOptions{
+			CertVerify:   secsipid.SJWTCertVerifyCAFile | secsipid.SJWTCertVerifyCRLDP,
+			RootCAs:      []*x509.Certificate{parseDummyCA(ca)},
+			CacheDirPath: cacheDir,
+			CacheExpire:  3600,
+			Timeout:      5,
+			Now:          func() time.Time { return tnow },
+		})
+	}
+	nextUpdate := time.Now().Add(time.Hour)
+
+	t.Run("OK with certificates not revoked", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		srv.set("/inter.crl", ca.generateCRL(nextUpdate, 101))
+		srv.set("/leaf.crl", inter.generateCRL(nextUpdate, 201))
+
+		errCode, _ := newVerifier("", time.Now()).PubKeyVerify(pubKey)
+
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		expect(srv.hitCount("/inter.crl")).ToBe(1)
+		expect(srv.hitCount("/leaf.crl")).ToBe(1)
+	})
+
+	t.Run("ErrCertRevoked with revoked leaf certificate", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		srv.set("/inter.crl", ca.generateCRL(nextUpdate))
+		srv.set("/leaf.crl", inter.generateCRL(nextUpdate, 200))
+
+		errCode, _ := newVerifier("", time.Now()).PubKeyVerify(pubKey)
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertRevoked)
+	})
+
+	t.Run("ErrCertRevoked with revoked leaf certificate in second CRL", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		srv.set("/inter.crl", ca.generateCRL(nextUpdate))
+		srv.set("/leaf.crl", append(
+			pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: inter.generateCRL(nextUpdate, 201)}),
+			pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: inter.generateCRL(nextUpdate, 200)})...))
+
+		errCode, _ := newVerifier("", time.Now()).PubKeyVerify(pubKey)
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertRevoked)
+	})
+
+	t.Run("ErrCertRevoked with revoked intermediate certificate", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		srv.set("/inter.crl", ca.generateCRL(nextUpdate, 100))
+		srv.set("/leaf.crl", inter.generateCRL(nextUpdate))
+
+		errCode, _ := newVerifier("", time.Now()).PubKeyVerify(pubKey)
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertRevoked)
+	})
+
+	t.Run("ErrCertCRLDP with unavailable CRL", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		srv.set("/inter.crl", ca.generateCRL(nextUpdate))
+		srv.mu.Lock()
+		delete(srv.crls, "/leaf.crl")
+		srv.mu.Unlock()
+
+		errCode, err := newVerifier("", time.Now()).PubKeyVerify(pubKey)
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertCRLDP)
+		expect(secsipid.SJWTErrorCode(err)).ToBe(secsipid.SJWTRetErrCertCRLDP)
+	})
+
+	t.Run("ErrCertCRLDP without http distribution point", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		srv.set("/inter.crl", ca.generateCRL(nextUpdate))
+		for _, dpURL := range []string{"", "ldap://127.0.0.1/leaf.crl"} {
+			leafNoDP := inter.generateCertWithCRLDP(202, false, dpURL)
+			pubKeyNoDP := append(append([]byte{}, leafNoDP.caPEMBytes...), inter.caPEMBytes...)
+
+			errCode, err := newVerifier("", time.Now()).PubKeyVerify(pubKeyNoDP)
+
+			expect(errCode).ToBe(secsipid.SJWTRetErrCertCRLDP)
+			expect(getMsgFromErr(err)).ToBe("no http CRL distribution point in the certificate")
+		}
+	})
+
+	t.Run("CRL cached until next update", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		cacheDir := t.TempDir()
+		srv.set("/inter.crl", ca.generateCRL(nextUpdate))
+		srv.set("/leaf.crl", inter.generateCRL(nextUpdate))
+
+		errCode, _ := newVerifier(cacheDir, time.Now()).PubKeyVerify(pubKey)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		errCode, _ = newVerifier(cacheDir, time.Now().Add(30*time.Minute)).PubKeyVerify(pubKey)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		expect(srv.hitCount("/leaf.crl")).ToBe(1)
+
+		// the clock of the verifier does not expire the cached CRL
+		errCode, _ = newVerifier(cacheDir, nextUpdate.Add(time.Minute)).PubKeyVerify(pubKey)
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertCRLStale)
+		expect(srv.hitCount("/leaf.crl")).ToBe(1)
+	})
+
+	t.Run("CRL downloaded again after next update", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		graceVerifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+			CertVerify:   secsipid.SJWTCertVerifyCAFile | secsipid.SJWTCertVerifyCRLDP,
+			RootCAs:      []*x509.Certificate{parseDummyCA(ca)},
+			CacheDirPath: t.TempDir(),
+			CacheExpire:  3600,
+			CRLGrace:     3600,
+			Timeout:      5,
+		})
+		srv.set("/inter.crl", ca.generateCRL(nextUpdate))
+		srv.set("/leaf.crl", inter.generateCRL(time.Now().Add(-time.Minute)))
+
+		errCode, _ := graceVerifier.PubKeyVerify(pubKey)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+
+		// the revocation is seen, the cached CRL being after its next update
+		srv.mu.Lock()
+		srv.crls["/leaf.crl"] = inter.generateCRL(nextUpdate, 200)
+		srv.mu.Unlock()
+		errCode, _ = graceVerifier.PubKeyVerify(pubKey)
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertRevoked)
+		expect(srv.hitCount("/leaf.crl")).ToBe(2)
+	})
+
+	t.Run("OK with SkipCRLTime and stale CRL", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		srv.set("/inter.crl", ca.generateCRL(time.Now().Add(-24*time.Hour)))
+		srv.set("/leaf.crl", inter.generateCRL(time.Now().Add(-24*time.Hour)))
+		verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+			CertVerify:  secsipid.SJWTCertVerifyCAFile | secsipid.SJWTCertVerifyCRLDP,
+			RootCAs:     []*x509.Certificate{parseDummyCA(ca)},
+			SkipCRLTime: true,
+			Timeout:     5,
+		})
+
+		errCode, _ := verifier.PubKeyVerify(pubKey)
+
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+	})
+}
+
+type ParseCRLsTest struct {
+	data []byte
+
+	expectedErrCode int
+	expectedCount   int
+}
+
+func TestParseCRLs(t *testing.T) {
+	ca := NewDummyCA()
+	crlOne := ca.generateCRL(time.Now().Add(time.Hour), 1)
+	crlTwo := ca.generateCRL(time.Now().Add(time.Hour), 2)
+	pemCRLs := append(pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crlOne}),
+		pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crlTwo})...)
+
+	testCases := map[string]ParseCRLsTest{
+		"OK with DER": {
+			data:            crlOne,
+			expectedErrCode: secsipid.SJWTRetOK,
+			expectedCount:   1,
+		},
+		"OK with several PEM blocks": {
+			data:            pemCRLs,
+			expectedErrCode: secsipid.SJWTRetOK,
+			expectedCount:   2,
+		},
+		"ErrCertCRLParse with invalid DER": {
+			data:            []byte{0x30, 0x03, 0x01},
+			expectedErrCode: secsipid.SJWTRetErrCertCRLParse,
+		},
+		"ErrCertCRLParse with PEM without CRL": {
+			data:            ca.caPEMBytes,
+			expectedErrCode: secsipid.SJWTRetErrCertCRLParse,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			crlList, errCode, err := secsipid.SJWTParseCRLs(testCase.data)
+
+			expect(errCode).ToBe(testCase.expectedErrCode)
+			expect(secsipid.SJWTErrorCode(err)).ToBe(testCase.expectedErrCode)
+			expect(len(crlList)).ToBe(testCase.expectedCount)
+		})
+	}
+}
+
+type CRLFilesTest struct {
+	crlFiles map[string][]byte
+	crlGrace int
+
+	expectedErrCode int
+}
+
+func TestVerifierCRLFiles(t *testing.T) {
+	ca := NewDummyCA()
+	// same subject as the CA, but another key
+	otherCA := NewDummyCA()
+	otherIssuer := ca.generateCertWithCRLDP(400, true, "https://127.0.0.1/other.crl")
+	leaf := ca.generateCertWithCRLDP(300, false, "https://127.0.0.1/leaf.crl")
+	nextUpdate := time.Now().Add(time.Hour)
+	pemCRL := func(crl []byte) []byte {
+		return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl})
+	}
+
+	testCases := map[string]CRLFilesTest{
+		"OK with PEM and DER files": {
+			crlFiles: map[string][]byte{
+				"one.crl": ca.generateCRL(nextUpdate, 301),
+				"two.pem": pemCRL(ca.generateCRL(nextUpdate, 302)),
+			},
+			expectedErrCode: secsipid.SJWTRetOK,
+		},
+		"ErrCertRevoked with certificate in second file": {
+			crlFiles: map[string][]byte{
+				"one.crl": ca.generateCRL(nextUpdate, 301),
+				"two.pem": pemCRL(ca.generateCRL(nextUpdate, 300)),
+			},
+			expectedErrCode: secsipid.SJWTRetErrCertRevoked,
+		},
+		"ErrCertCRLSignature with CRL not signed by the issuer": {
+			crlFiles: map[string][]byte{
+				"one.crl": otherCA.generateCRL(nextUpdate, 301),
+			},
+			expectedErrCode: secsipid.SJWTRetErrCertCRLSignature,
+		},
+		"ErrCertNoCRLFile with CRL of another issuer": {
+			crlFiles: map[string][]byte{
+				"one.crl": otherIssuer.generateCRL(nextUpdate, 300),
+			},
+			expectedErrCode: secsipid.SJWTRetErrCertNoCRLFile,
+		},
+		"ErrCertCRLStale with CRL after next update": {
+			crlFiles: map[string][]byte{
+				"one.crl": ca.generateCRL(time.Now().Add(-time.Hour)),
+			},
+			expectedErrCode: secsipid.SJWTRetErrCertCRLStale,
+		},
+		"OK with CRL after next update within grace": {
+			crlFiles: map[string][]byte{
+				"one.crl": ca.generateCRL(time.Now().Add(-time.Hour)),
+			},
+			crlGrace:        2 * 3600,
+			expectedErrCode: secsipid.SJWTRetOK,
+		},
+		"ErrCertCRLParse with invalid file": {
+			crlFiles: map[string][]byte{
+				"one.crl": []byte("not a CRL"),
+			},
+			expectedErrCode: secsipid.SJWTRetErrCertCRLParse,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			crlDir := t.TempDir()
+			for fileName, data := range testCase.crlFiles {
+				os.WriteFile(path.Join(crlDir, fileName), data, 0600)
+			}
+			verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+				CertVerify:  secsipid.SJWTCertVerifyCAFile | secsipid.SJWTCertVerifyCRL,
+				RootCAs:     []*x509.Certificate{parseDummyCA(ca)},
+				CertCRLFile: crlDir,
+				CRLGrace:    testCase.crlGrace,
+			})
+
+			errCode, err := verifier.PubKeyVerify(leaf.caPEMBytes)
+
+			expect(errCode).ToBe(testCase.expectedErrCode)
+			expect(secsipid.SJWTErrorCode(err)).ToBe(testCase.expectedErrCode)
+		})
+	}
+
+	t.Run("OK with CertTimeIAT and CRL issued after iat", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		// the token is signed now, checked in three hours with a CRL issued
+		// in one hour and a half
+		tnow := time.Now()
+		prvKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		certTmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(500),
+			Subject:      pkix.Name{Organization: []string{"CRL IAT, Inc."}},
+			NotBefore:    tnow.AddDate(0, 0, -1),
+			NotAfter:     tnow.AddDate(1, 0, 0),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+		}
+		certBytes, _ := x509.CreateCertificate(rand.Reader, certTmpl, ca.ca, &prvKey.PublicKey, ca.caPrivKey)
+		certPath := path.Join(t.TempDir(), "cert.pem")
+		os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}), 0600)
+
+		crlDir := t.TempDir()
+		os.WriteFile(path.Join(crlDir, "one.crl"), ca.generateCRL(tnow.Add(210*time.Minute), 301), 0600)
+
+		header := secsipid.SJWTHeader{Alg: "ES256", Ppt: "shaken", Typ: "passport", X5u: "https://127.0.0.1/cert.pem"}
+		payload := secsipid.SJWTPayload{
+			ATTest: "A",
+			Dest:   secsipid.SJWTDest{TN: []string{"15551234567"}},
+			IAT:    tnow.Add(time.Minute).Unix(),
+			Orig:   secsipid.SJWTOrig{TN: "15559876543"},
+			OrigID: "32c7e392-33fc-11ea-840b-784f435c76a8",
+		}
+		identity := secsipid.SJWTEncode(header, payload, prvKey) + ";info=<https://127.0.0.1/cert.pem>;alg=ES256;ppt=shaken"
+
+		verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+			CertVerify:  secsipid.SJWTCertVerifyCAFile | secsipid.SJWTCertVerifyCRL,
+			RootCAs:     []*x509.Certificate{parseDummyCA(ca)},
+			CertCRLFile: crlDir,
+			CertTimeIAT: true,
+			Expire:      4 * 3600,
+			Now:         func() time.Time { return tnow.Add(3 * time.Hour) },
+		})
+
+		errCode, _ := verifier.CheckFullIdentity(identity, certPath)
+
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("ErrCertRevoked with list of files", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		crlDir := t.TempDir()
+		os.WriteFile(path.Join(crlDir, "one.crl"), ca.generateCRL(nextUpdate, 301), 0600)
+		os.WriteFile(path.Join(crlDir, "two.crl"), ca.generateCRL(nextUpdate, 300), 0600)
+		verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+			CertVerify:  secsipid.SJWTCertVerifyCAFile | secsipid.SJWTCertVerifyCRL,
+			RootCAs:     []*x509.Certificate{parseDummyCA(ca)},
+			CertCRLFile: path.Join(crlDir, "one.crl") + ", " + path.Join(crlDir, "two.crl"),
+		})
+
+		errCode, _ := verifier.PubKeyVerify(leaf.caPEMBytes)
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertRevoked)
+	})
+}
@@ -0,0 +1,168 @@
+package secsipid
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"strings"
+)
+
+// SJWTDiv - diverting party of the div claim (RFC 8946)
+type SJWTDiv struct {
+	TN string `json:"tn"`
+}
+
+// SJWTDivPayload - payload of div PASSporT (RFC 8946)
+type SJWTDivPayload struct {
+	Dest SJWTDest `json:"dest"`
+	Div  SJWTDiv  `json:"div"`
+	IAT  int64    `json:"iat"`
+	Orig SJWTOrig `json:"orig"`
+	// members not known by the library, preserved when decoding and encoding
+	Extra map[string]interface{} `json:"-"`
+}
+
+// SignDiv - return the Identity header value of a div PASSporT for a call
+// from origTN retargeted from divTN to destTNs
+func (s *Signer) SignDiv(origTN string, destTNs []string, divTN string) (string, int, error) {
+	return s.SignOpts(SJWTIdentityOptions{
+		Ppt:     SJWTPptDiv,
+		OrigTN:  origTN,
+		DestTNs: destTNs,
+		DivTN:   divTN,
+	})
+}
+
+// SJWTGetDivIdentityPrvKey - build the Identity header value of a div
+// PASSporT with the content of the private key
+func SJWTGetDivIdentityPrvKey(origTN string, destTN string, divTN string, x5uVal string, prvkeyData []byte) (string, int, error) {
+	var ret int
+	var err error
+
+	var ecdsaPrvKey *ecdsa.PrivateKey
+	if ecdsaPrvKey, ret, err = SJWTParseECPrivateKeyFromPEM(prvkeyData); err != nil {
+		return "", ret, wrapError(ret, "Unable to parse ECDSA private key", err)
+	}
+	return sjwtGetDivIdentity(origTN, destTN, divTN, x5uVal, ecdsaPrvKey)
+}
+
+// SJWTGetDivIdentity - build the Identity header value of a div PASSporT with
+// the private key from the file
+func SJWTGetDivIdentity(origTN string, destTN string, divTN string, x5uVal string, prvkeyPath string) (string, int, error) {
+	var ret int
+	var err error
+
+	var ecdsaPrvKey *ecdsa.PrivateKey
+	if ecdsaPrvKey, ret, err = getPrvKeyFile(prvkeyPath).key(); err != nil {
+		return "", ret, err
+	}
+	return sjwtGetDivIdentity(origTN, destTN, divTN, x5uVal, ecdsaPrvKey)
+}
+
+// sjwtGetDivIdentity - build the Identity header value of a div PASSporT with
+// the parsed private key
+func sjwtGetDivIdentity(origTN string, destTN string, divTN string, x5uVal string, prvkey *ecdsa.PrivateKey) (string, int, error) {
+	return sjwtGetIdentityOpts(SJWTIdentityOptions{
+		Ppt:     SJWTPptDiv,
+		OrigTN:  origTN,
+		DestTNs: []string{destTN},
+		DivTN:   divTN,
+		X5u:     x5uVal,
+	}, prvkey)
+}
+
+// CheckDivIdentity - implements the verify of the Identity header with a div
+// PASSporT, returning its payload; pubkeyPath is the file path or URL of the
+// public key, if empty the value of the info parameter is used
+func (v *Verifier) CheckDivIdentity(identityVal string, pubkeyPath string) (*SJWTDivPayload, int, error) {
+	return v.checkDivIdentity(identityVal, pubkeyPath, 0)
+}
+
+// CheckDivIdentityPubKey - implements the verify of the Identity header with
+// a div PASSporT using the public key value, returning its payload
+func (v *Verifier) CheckDivIdentityPubKey(identityVal string, pubkeyVal string) (*SJWTDivPayload, int, error) {
+	return v.checkDivIdentity(identityVal, pubkeyVal, 1)
+}
+
+func (v *Verifier) checkDivIdentity(identityVal string, pubkeyVal string, pubkeyMode int) (*SJWTDivPayload, int, error) {
+	payload := SJWTDivPayload{}
+
+	if ret, err := v.checkPASSporT(identityVal, pubkeyVal, pubkeyMode, SJWTPptDiv, &payload); err != nil {
+		return nil, ret, err
+	}
+	if len(payload.Div.TN) == 0 {
+		return nil, SJWTRetErrJSONPayloadDiv, newError(SJWTRetErrJSONPayloadDiv, "missing div claim")
+	}
+	return &payload, SJWTRetOK, nil
+}
+
+// SJWTCheckDivIdentity - implements the verify of the Identity header with a
+// div PASSporT, returning its payload
+func SJWTCheckDivIdentity(identityVal string, expireVal int, pubkeyPath string, timeoutVal int) (*SJWTDivPayload, int, error) {
+	return defaultVerifier(expireVal, timeoutVal).CheckDivIdentity(identityVal, pubkeyPath)
+}
+
+// SJWTCheckDivChain - check that the div PASSporTs are linked to the shaken
+// PASSporT of the call
+func SJWTCheckDivChain(payload *SJWTPayload, divPayloads []*SJWTDivPayload) (int, error) {
+	return defaultVerifier(0, 0).CheckDivChain(payload, divPayloads)
+}
+
+// CheckDivChain - check that the div PASSporTs are linked to the shaken
+// PASSporT of the call
+//
+// All the div PASSporTs must have the orig of the shaken PASSporT (same tn and
+// uri, at least one being set) and each div claim must match a dest of the
+// shaken PASSporT or of another div PASSporT in the chain. The div PASSporTs
+// can be given in any order. The telephone numbers are compared with
+// CompareTN(), the URIs without parameters and ignoring the case.
+func (v *Verifier) CheckDivChain(payload *SJWTPayload, divPayloads []*SJWTDivPayload) (int, error) {
+	if payload == nil {
+		return SJWTRetErrJSONPayloadParse, newError(SJWTRetErrJSONPayloadParse, "no shaken payload")
+	}
+	if len(payload.Orig.TN) == 0 && len(payload.Orig.URI) == 0 {
+		return SJWTRetErrJSONPayloadDivChain, newError(SJWTRetErrJSONPayloadDivChain, "no orig in shaken PASSporT")
+	}
+
+	destTNs := append([]string{}, payload.Dest.TN...)
+	pending := append([]*SJWTDivPayload{}, divPayloads...)
+	for len(pending) > 0 {
+		linked := -1
+		for i, divPayload := range pending {
+			if !v.sameOrig(divPayload.Orig, payload.Orig) {
+				return SJWTRetErrJSONPayloadDivChain, newError(SJWTRetErrJSONPayloadDivChain,
+					fmt.Sprintf("mismatching orig in div PASSporT (%s)", divPayload.Orig.TN+divPayload.Orig.URI))
+			}
+			if v.containsTN(destTNs, divPayload.Div.TN) {
+				linked = i
+				break
+			}
+		}
+		if linked < 0 {
+			return SJWTRetErrJSONPayloadDivChain, newError(SJWTRetErrJSONPayloadDivChain,
+				fmt.Sprintf("div claim not matching a dest in the chain (%s)", pending[0].Div.TN))
+		}
+		destTNs = append(destTNs, pending[linked].Dest.TN...)
+		pending = append(pending[:linked], pending[linked+1:]...)
+	}
+	return SJWTRetOK, nil
+}
+
+// sameOrig - return true if the orig claims have the same telephone number
+// and URI, the first one having at least one of them
+func (v *Verifier) sameOrig(orig1 SJWTOrig, orig2 SJWTOrig) bool {
+	if len(orig1.TN) == 0 && len(orig1.URI) == 0 {
+		return false
+	}
+	return v.CompareTN(orig1.TN, orig2.TN) &&
+		strings.EqualFold(sjwtSIPURIBase(orig1.URI), sjwtSIPURIBase(orig2.URI))
+}
+
+// containsTN - return true if tn is in the list
+func (v *Verifier) containsTN(tnList []string, tn string) bool {
+	for _, vTN := range tnList {
+		if v.CompareTN(vTN, tn) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package secsipid_test
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestDivPASSporT(t *testing.T) {
+	keyPath := path.Join(t.TempDir(), "ec256-private.pem")
+	_, pubKey := writeDummyECKey(keyPath)
+
+	signer, _, _ := secsipid.NewSigner(secsipid.SignerOptions{
+		PrvKeyPath: keyPath,
+		X5u:        "https://127.0.0.1/cert.pem",
+	})
+	verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+		Expire: 60,
+	})
+
+	t.Run("OK with signed div PASSporT", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identity, errCode, _ := signer.SignDiv("493055555555", []string{"493066666666"}, "493044444444")
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		expect(strings.HasSuffix(identity, ";info=<https://127.0.0.1/cert.pem>;alg=ES256;ppt=div")).ToBe(true)
+
+		payload, errCode, _ := verifier.CheckDivIdentityPubKey(identity, string(pubKey))
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		expect(payload.Orig.TN).ToBe("493055555555")
+		expect(payload.Dest.TN).ToEqual([]string{"493066666666"})
+		expect(payload.Div.TN).ToBe("493044444444")
+	})
+
+	t.Run("ErrSIPHdrPpt with shaken PASSporT", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identity, _, _ := signer.Sign("493055555555", []string{"493044444444"}, "A", "")
+
+		_, errCode, _ := verifier.CheckDivIdentityPubKey(identity, string(pubKey))
+		expect(errCode).ToBe(secsipid.SJWTRetErrSIPHdrPpt)
+	})
+
+	t.Run("ErrSIPHdrPpt when checking div PASSporT as shaken", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identity, _, _ := signer.SignDiv("493055555555", []string{"493066666666"}, "493044444444")
+
+		errCode, _ := verifier.CheckFullIdentityPubKey(identity, string(pubKey))
+		expect(errCode).ToBe(secsipid.SJWTRetErrSIPHdrPpt)
+	})
+
+	t.Run("ErrJSONPayloadDiv with empty div claim", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identity, _, _ := signer.SignDiv("493055555555", []string{"493066666666"}, "")
+
+		_, errCode, _ := verifier.CheckDivIdentityPubKey(identity, string(pubKey))
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadDiv)
+	})
+}
+
+type DivChainTest struct {
+	payload     *secsipid.SJWTPayload
+	divPayloads []*secsipid.SJWTDivPayload
+
+	expectedErrCode int
+}
+
+func TestCheckDivChain(t *testing.T) {
+	payload := &secsipid.SJWTPayload{
+		ATTest: "A",
+		Dest:   secsipid.SJWTDest{TN: []string{"493044444444"}},
+		IAT:    1,
+		Orig:   secsipid.SJWTOrig{TN: "493055555555"},
+	}
+	newDivPayload := func(origTN string, destTN string, divTN string) *secsipid.SJWTDivPayload {
+		return &secsipid.SJWTDivPayload{
+			Dest: secsipid.SJWTDest{TN: []string{destTN}},
+			Div:  secsipid.SJWTDiv{TN: divTN},
+			IAT:  1,
+			Orig: secsipid.SJWTOrig{TN: origTN},
+		}
+	}
+
+	runTest := func(t *testing.T, testCase DivChainTest) {
+		expect := expectate.Expect(t)
+
+		shakenPayload := payload
+		if testCase.payload != nil {
+			shakenPayload = testCase.payload
+		}
+		errCode, _ := secsipid.SJWTCheckDivChain(shakenPayload, testCase.divPayloads)
+
+		expect(errCode).ToBe(testCase.expectedErrCode)
+	}
+
+	testCases := map[string]DivChainTest{
+		"OK with single diversion": {
+			divPayloads: []*secsipid.SJWTDivPayload{
+				newDivPayload("493055555555", "493066666666", "493044444444"),
+			},
+			expectedErrCode: secsipid.SJWTRetOK,
+		},
+		"OK with diversions out of order": {
+			divPayloads: []*secsipid.SJWTDivPayload{
+				newDivPayload("493055555555", "493077777777", "493066666666"),
+				newDivPayload("493055555555", "493066666666", "493044444444"),
+			},
+			expectedErrCode: secsipid.SJWTRetOK,
+		},
+		"ErrJSONPayloadDivChain with mismatching orig": {
+			divPayloads: []*secsipid.SJWTDivPayload{
+				newDivPayload("493011111111", "493066666666", "493044444444"),
+			},
+			expectedErrCode: secsipid.SJWTRetErrJSONPayloadDivChain,
+		},
+		"OK with uri orig": {
+			payload: &secsipid.SJWTPayload{
+				Dest: secsipid.SJWTDest{TN: []string{"493044444444"}},
+				Orig: secsipid.SJWTOrig{URI: "sip:alice@127.0.0.1"},
+			},
+			divPayloads: []*secsipid.SJWTDivPayload{{
+				Dest: secsipid.SJWTDest{TN: []string{"493066666666"}},
+				Div:  secsipid.SJWTDiv{TN: "493044444444"},
+				Orig: secsipid.SJWTOrig{URI: "sip:Alice@127.0.0.1;transport=tcp"},
+			}},
+			expectedErrCode: secsipid.SJWTRetOK,
+		},
+		"ErrJSONPayloadDivChain with mismatching uri orig": {
+			payload: &secsipid.SJWTPayload{
+				Dest: secsipid.SJWTDest{TN: []string{"493044444444"}},
+				Orig: secsipid.SJWTOrig{URI: "sip:alice@127.0.0.1"},
+			},
+			divPayloads: []*secsipid.SJWTDivPayload{{
+				Dest: secsipid.SJWTDest{TN: []string{"493066666666"}},
+				Div:  secsipid.SJWTDiv{TN: "493044444444"},
+				Orig: secsipid.SJWTOrig{URI: "sip:mallory@127.0.0.1"},
+			}},
+			expectedErrCode: secsipid.SJWTRetErrJSONPayloadDivChain,
+		},
+		"ErrJSONPayloadDivChain with div orig without tn and uri": {
+			divPayloads: []*secsipid.SJWTDivPayload{
+				newDivPayload("", "493066666666", "493044444444"),
+			},
+			expectedErrCode: secsipid.SJWTRetErrJSONPayloadDivChain,
+		},
+		"ErrJSONPayloadDivChain with shaken orig without tn and uri": {
+			payload: &secsipid.SJWTPayload{
+				Dest: secsipid.SJWTDest{TN: []string{"493044444444"}},
+			},
+			divPayloads: []*secsipid.SJWTDivPayload{
+				newDivPayload("", "493066666666", "493044444444"),
+			},
+			expectedErrCode: secsipid.SJWTRetErrJSONPayloadDivChain,
+		},
+		"ErrJSONPayloadDivChain with div not matching any dest": {
+			divPayloads: []*secsipid.SJWTDivPayload{
+				newDivPayload("493055555555", "493066666666", "493044444444"),
+				newDivPayload("493055555555", "493088888888", "493077777777"),
+			},
+			expectedErrCode: secsipid.SJWTRetErrJSONPayloadDivChain,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			runTest(t, testCase)
+		})
+	}
+}
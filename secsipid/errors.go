@@ -0,0 +1,202 @@
+package secsipid
+
+import (
+	"errors"
+)
+
+// ErrorCategory - class of failures, derived from the range of the error code
+type ErrorCategory int
+
+// error categories
+const (
+	// generic errors: -1..-99
+	ErrCategoryGeneric ErrorCategory = iota
+	// public certificate and private key errors: -100..-199
+	ErrCategoryCert
+	// identity JSON header errors: -200..-229
+	ErrCategoryJSONHeader
+	// identity payload errors: -230..-249
+	ErrCategoryPayload
+	// identity signature errors: -250..-299
+	ErrCategorySignature
+	// identity SIP header errors: -300..-399
+	ErrCategorySIPHeader
+	// http and file operations errors: -400..-499
+	ErrCategoryHTTP
+)
+
+// String - return the name of the category
+func (c ErrorCategory) String() string {
+	switch c {
+	case ErrCategoryCert:
+		return "cert"
+	case ErrCategoryJSONHeader:
+		return "json-header"
+	case ErrCategoryPayload:
+		return "payload"
+	case ErrCategorySignature:
+		return "signature"
+	case ErrCategorySIPHeader:
+		return "sip-header"
+	case ErrCategoryHTTP:
+		return "http"
+	}
+	return "generic"
+}
+
+// SJWTErrorCategory - return the category for a SJWTRet* error code
+func SJWTErrorCategory(code int) ErrorCategory {
+	switch {
+	case code <= -100 && code > -200:
+		return ErrCategoryCert
+	case code <= -200 && code > -230:
+		return ErrCategoryJSONHeader
+	case code <= -230 && code > -250:
+		return ErrCategoryPayload
+	case code <= -250 && code > -300:
+		return ErrCategorySignature
+	case code <= -300 && code > -400:
+		return ErrCategorySIPHeader
+	case code <= -400 && code > -500:
+		return ErrCategoryHTTP
+	}
+	return ErrCategoryGeneric
+}
+
+// Error - error returned by the library, carrying the SJWTRet* code
+//
+// The sentinel Err* values can be used with errors.Is() to test the code of
+// an error, errors.As() gives access to the code, category and cause.
+type Error struct {
+	// SJWTRet* error code
+	Code int
+	// category of the error code
+	Category ErrorCategory
+	// description of the failure
+	Msg string
+	// wrapped cause of the failure (it can be nil)
+	Err error
+}
+
+// newError - create an Error for the code
+func newError(code int, msg string) *Error {
+	return &Error{
+		Code:     code,
+		Category: SJWTErrorCategory(code),
+		Msg:      msg,
+	}
+}
+
+// wrapError - create an Error for the code, wrapping the cause
+func wrapError(code int, msg string, err error) *Error {
+	return &Error{
+		Code:     code,
+		Category: SJWTErrorCategory(code),
+		Msg:      msg,
+		Err:      err,
+	}
+}
+
+// Error - return the description, followed by the one of the cause
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Msg
+	}
+	if len(e.Msg) == 0 {
+		return e.Err.Error()
+	}
+	return e.Msg + ": " + e.Err.Error()
+}
+
+// Unwrap - return the cause of the error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is - errors with the same code are considered a match
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// SJWTErrorCode - return the SJWTRet* code of the error, SJWTRetOK for nil
+// and SJWTRetErr for errors not created by the library
+func SJWTErrorCode(err error) int {
+	if err == nil {
+		return SJWTRetOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return SJWTRetErr
+}
+
+// sentinel errors, one for each SJWTRet* error code
+var (
+	ErrGeneric = newError(SJWTRetErr, "generic error")
+
+	ErrCertInvalid         = newError(SJWTRetErrCertInvalid, "invalid certificate")
+	ErrCertInvalidFormat   = newError(SJWTRetErrCertInvalidFormat, "invalid certificate format")
+	ErrCertExpired         = newError(SJWTRetErrCertExpired, "certificate expired")
+	ErrCertBeforeValidity  = newError(SJWTRetErrCertBeforeValidity, "certificate not valid yet")
+	ErrCertProcessing      = newError(SJWTRetErrCertProcessing, "certificate processing failure")
+	ErrCertNoCAFile        = newError(SJWTRetErrCertNoCAFile, "no CA file")
+	ErrCertReadCAFile      = newError(SJWTRetErrCertReadCAFile, "failed to read CA file")
+	ErrCertNoCAInter       = newError(SJWTRetErrCertNoCAInter, "no intermediate CA file")
+	ErrCertReadCAInter     = newError(SJWTRetErrCertReadCAInter, "failed to read intermediate CA file")
+	ErrCertNoCRLFile       = newError(SJWTRetErrCertNoCRLFile, "no CRL file")
+	ErrCertReadCRLFile     = newError(SJWTRetErrCertReadCRLFile, "failed to read CRL file")
+	ErrCertRevoked         = newError(SJWTRetErrCertRevoked, "certificate is revoked")
+	ErrCertInvalidEC       = newError(SJWTRetErrCertInvalidEC, "not EC public key")
+	ErrCertTNAuthList      = newError(SJWTRetErrCertTNAuthList, "missing or invalid TNAuthList extension")
+	ErrCertTNNotAuthorized = newError(SJWTRetErrCertTNNotAuthorized, "telephone number not authorized by the certificate")
+	ErrCertDelegateScope   = newError(SJWTRetErrCertDelegateScope, "delegate certificate not in the scope of its issuer")
+	ErrCertProfilePolicy   = newError(SJWTRetErrCertProfilePolicy, "no SHAKEN certificate policy")
+	ErrCertProfileKeyUsage = newError(SJWTRetErrCertProfileKeyUsage, "key usage not only digital signature")
+	ErrCertProfileKey      = newError(SJWTRetErrCertProfileKey, "public key not EC P-256")
+	ErrCertProfileCRLDP    = newError(SJWTRetErrCertProfileCRLDP, "no CRL distribution point")
+	ErrCertProfileSubject  = newError(SJWTRetErrCertProfileSubject, "subject common name without SHAKEN")
+	ErrCertCRLDP           = newError(SJWTRetErrCertCRLDP, "failed to get CRL from distribution point")
+	ErrCertCRLParse        = newError(SJWTRetErrCertCRLParse, "failed to parse CRL")
+	ErrCertCRLSignature    = newError(SJWTRetErrCertCRLSignature, "CRL not signed by the certificate issuer")
+	ErrCertCRLStale        = newError(SJWTRetErrCertCRLStale, "CRL not valid at the verification time")
+	ErrPrvKeyInvalid       = newError(SJWTRetErrPrvKeyInvalid, "invalid private key")
+	ErrPrvKeyInvalidFormat = newError(SJWTRetErrPrvKeyInvalidFormat, "invalid private key format")
+	ErrPrvKeyInvalidEC     = newError(SJWTRetErrPrvKeyInvalidEC, "not EC private key")
+
+	ErrJSONHdrParse          = newError(SJWTRetErrJSONHdrParse, "invalid json header")
+	ErrJSONHdrAlg            = newError(SJWTRetErrJSONHdrAlg, "invalid value for alg in json header")
+	ErrJSONHdrPpt            = newError(SJWTRetErrJSONHdrPpt, "invalid value for ppt in json header")
+	ErrJSONHdrTyp            = newError(SJWTRetErrJSONHdrTyp, "invalid value for typ in json header")
+	ErrJSONHdrX5u            = newError(SJWTRetErrJSONHdrX5u, "mismatching value for x5u and info attributes")
+	ErrJSONPayloadParse      = newError(SJWTRetErrJSONPayloadParse, "invalid payload")
+	ErrJSONPayloadIATExpired = newError(SJWTRetErrJSONPayloadIATExpired, "expired token")
+	ErrJSONPayloadDiv        = newError(SJWTRetErrJSONPayloadDiv, "invalid div claim")
+	ErrJSONPayloadDivChain   = newError(SJWTRetErrJSONPayloadDivChain, "div PASSporT not linked to the call")
+	ErrJSONPayloadRCD        = newError(SJWTRetErrJSONPayloadRCD, "invalid rcd claim")
+	ErrJSONPayloadRCDI       = newError(SJWTRetErrJSONPayloadRCDI, "rcd integrity check failed")
+	ErrJSONPayloadRPH        = newError(SJWTRetErrJSONPayloadRPH, "invalid rph claim")
+	ErrJSONPayloadOrig       = newError(SJWTRetErrJSONPayloadOrig, "orig claim not matching the SIP request")
+	ErrJSONPayloadDest       = newError(SJWTRetErrJSONPayloadDest, "dest claim not matching the SIP request")
+	ErrJSONPayloadDate       = newError(SJWTRetErrJSONPayloadDate, "iat claim not matching the Date header")
+	ErrJSONPayloadIATFuture  = newError(SJWTRetErrJSONPayloadIATFuture, "token issued in the future")
+	ErrJSONSignatureInvalid  = newError(SJWTRetErrJSONSignatureInvalid, "invalid signature")
+	ErrJSONSignatureHashing  = newError(SJWTRetErrJSONSignatureHashing, "hashing function unavailable")
+	ErrJSONSignatureSize     = newError(SJWTRetErrJSONSignatureSize, "invalid signature size")
+	ErrJSONSignatureFailure  = newError(SJWTRetErrJSONSignatureFailure, "failed to build signature")
+
+	ErrSIPHdrParse  = newError(SJWTRetErrSIPHdrParse, "invalid identity header")
+	ErrSIPHdrAlg    = newError(SJWTRetErrSIPHdrAlg, "invalid value for alg header parameter")
+	ErrSIPHdrPpt    = newError(SJWTRetErrSIPHdrPpt, "invalid value for ppt header parameter")
+	ErrSIPHdrEmpty  = newError(SJWTRetErrSIPHdrEmpty, "empty identity header")
+	ErrSIPHdrInfo   = newError(SJWTRetErrSIPHdrInfo, "invalid value info header parameter")
+	ErrSIPMsgParse  = newError(SJWTRetErrSIPMsgParse, "invalid SIP message")
+	ErrSIPHdrPolicy = newError(SJWTRetErrSIPHdrPolicy, "identity headers not satisfying the policy")
+
+	ErrHTTPInvalidURL = newError(SJWTRetErrHTTPInvalidURL, "invalid URL value")
+	ErrHTTPGet        = newError(SJWTRetErrHTTPGet, "http get failure")
+	ErrHTTPStatusCode = newError(SJWTRetErrHTTPStatusCode, "http status error")
+	ErrHTTPReadBody   = newError(SJWTRetErrHTTPReadBody, "read http body failure")
+	ErrFileRead       = newError(SJWTRetErrFileRead, "failed to read file")
+)
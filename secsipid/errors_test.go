@@ -0,0 +1,133 @@
+package secsipid_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestErrors(t *testing.T) {
+	t.Run("Error codes are unique", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		codes := []int{
+			secsipid.SJWTRetErr,
+			secsipid.SJWTRetErrCertInvalid,
+			secsipid.SJWTRetErrCertInvalidFormat,
+			secsipid.SJWTRetErrCertExpired,
+			secsipid.SJWTRetErrCertBeforeValidity,
+			secsipid.SJWTRetErrCertProcessing,
+			secsipid.SJWTRetErrCertNoCAFile,
+			secsipid.SJWTRetErrCertReadCAFile,
+			secsipid.SJWTRetErrCertNoCAInter,
+			secsipid.SJWTRetErrCertReadCAInter,
+			secsipid.SJWTRetErrCertNoCRLFile,
+			secsipid.SJWTRetErrCertReadCRLFile,
+			secsipid.SJWTRetErrCertRevoked,
+			secsipid.SJWTRetErrCertInvalidEC,
+			secsipid.SJWTRetErrCertTNAuthList,
+			secsipid.SJWTRetErrCertTNNotAuthorized,
+			secsipid.SJWTRetErrCertDelegateScope,
+			secsipid.SJWTRetErrCertProfilePolicy,
+			secsipid.SJWTRetErrCertProfileKeyUsage,
+			secsipid.SJWTRetErrCertProfileKey,
+			secsipid.SJWTRetErrCertProfileCRLDP,
+			secsipid.SJWTRetErrCertProfileSubject,
+			secsipid.SJWTRetErrCertCRLDP,
+			secsipid.SJWTRetErrCertCRLParse,
+			secsipid.SJWTRetErrCertCRLSignature,
+			secsipid.SJWTRetErrCertCRLStale,
+			secsipid.SJWTRetErrPrvKeyInvalid,
+			secsipid.SJWTRetErrPrvKeyInvalidFormat,
+			secsipid.SJWTRetErrPrvKeyInvalidEC,
+			secsipid.SJWTRetErrJSONHdrParse,
+			secsipid.SJWTRetErrJSONHdrAlg,
+			secsipid.SJWTRetErrJSONHdrPpt,
+			secsipid.SJWTRetErrJSONHdrTyp,
+			secsipid.SJWTRetErrJSONHdrX5u,
+			secsipid.SJWTRetErrJSONPayloadParse,
+			secsipid.SJWTRetErrJSONPayloadIATExpired,
+			secsipid.SJWTRetErrJSONPayloadDiv,
+			secsipid.SJWTRetErrJSONPayloadDivChain,
+			secsipid.SJWTRetErrJSONPayloadRCD,
+			secsipid.SJWTRetErrJSONPayloadRCDI,
+			secsipid.SJWTRetErrJSONPayloadRPH,
+			secsipid.SJWTRetErrJSONPayloadOrig,
+			secsipid.SJWTRetErrJSONPayloadDest,
+			secsipid.SJWTRetErrJSONPayloadDate,
+			secsipid.SJWTRetErrJSONPayloadIATFuture,
+			secsipid.SJWTRetErrJSONSignatureInvalid,
+			secsipid.SJWTRetErrJSONSignatureHashing,
+			secsipid.SJWTRetErrJSONSignatureSize,
+			secsipid.SJWTRetErrJSONSignatureFailure,
+			secsipid.SJWTRetErrSIPHdrParse,
+			secsipid.SJWTRetErrSIPHdrAlg,
+			secsipid.SJWTRetErrSIPHdrPpt,
+			secsipid.SJWTRetErrSIPHdrEmpty,
+			secsipid.SJWTRetErrSIPHdrInfo,
+			secsipid.SJWTRetErrSIPMsgParse,
+			secsipid.SJWTRetErrSIPHdrPolicy,
+			secsipid.SJWTRetErrHTTPInvalidURL,
+			secsipid.SJWTRetErrHTTPGet,
+			secsipid.SJWTRetErrHTTPStatusCode,
+			secsipid.SJWTRetErrHTTPReadBody,
+			secsipid.SJWTRetErrFileRead,
+		}
+		seen := map[int]bool{}
+		for _, code := range codes {
+			expect(seen[code]).ToBe(false)
+			seen[code] = true
+		}
+	})
+
+	t.Run("Categories of the error codes", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(secsipid.SJWTErrorCategory(secsipid.SJWTRetErrCertExpired)).ToBe(secsipid.ErrCategoryCert)
+		expect(secsipid.SJWTErrorCategory(secsipid.SJWTRetErrPrvKeyInvalidEC)).ToBe(secsipid.ErrCategoryCert)
+		expect(secsipid.SJWTErrorCategory(secsipid.SJWTRetErrJSONHdrAlg)).ToBe(secsipid.ErrCategoryJSONHeader)
+		expect(secsipid.SJWTErrorCategory(secsipid.SJWTRetErrJSONPayloadIATExpired)).ToBe(secsipid.ErrCategoryPayload)
+		expect(secsipid.SJWTErrorCategory(secsipid.SJWTRetErrJSONSignatureInvalid)).ToBe(secsipid.ErrCategorySignature)
+		expect(secsipid.SJWTErrorCategory(secsipid.SJWTRetErrSIPHdrInfo)).ToBe(secsipid.ErrCategorySIPHeader)
+		expect(secsipid.SJWTErrorCategory(secsipid.SJWTRetErrHTTPGet)).ToBe(secsipid.ErrCategoryHTTP)
+		expect(secsipid.SJWTErrorCategory(secsipid.SJWTRetErrFileRead)).ToBe(secsipid.ErrCategoryHTTP)
+		expect(secsipid.SJWTErrorCategory(secsipid.SJWTRetErr)).ToBe(secsipid.ErrCategoryGeneric)
+	})
+
+	t.Run("errors.Is matches the sentinel with the same code", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, errCode, err := secsipid.SJWTParseECPrivateKeyFromPEM([]byte("bad key format"))
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrPrvKeyInvalidFormat)
+		expect(errors.Is(err, secsipid.ErrPrvKeyInvalidFormat)).ToBe(true)
+		expect(errors.Is(err, secsipid.ErrPrvKeyInvalidEC)).ToBe(false)
+		expect(secsipid.SJWTErrorCode(err)).ToBe(secsipid.SJWTRetErrPrvKeyInvalidFormat)
+	})
+
+	t.Run("errors.As gives access to code, category and cause", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, pubKey := writeDummyECKey(t.TempDir() + "/ec256-private.pem")
+		verifier := secsipid.NewVerifier(secsipid.VerifierOptions{Expire: 60})
+
+		errCode, err := verifier.CheckFullIdentityPubKey("a.b.c;info=<https://127.0.0.1/cert.pem>", string(pubKey))
+
+		var sErr *secsipid.Error
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadParse)
+		expect(errors.As(err, &sErr)).ToBe(true)
+		expect(sErr.Code).ToBe(secsipid.SJWTRetErrJSONPayloadParse)
+		expect(sErr.Category).ToBe(secsipid.ErrCategoryPayload)
+		expect(sErr.Unwrap() != nil).ToBe(true)
+		expect(errors.Is(err, secsipid.ErrJSONPayloadParse)).ToBe(true)
+	})
+
+	t.Run("SJWTErrorCode for nil and foreign errors", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(secsipid.SJWTErrorCode(nil)).ToBe(secsipid.SJWTRetOK)
+		expect(secsipid.SJWTErrorCode(errors.New("foreign"))).ToBe(secsipid.SJWTRetErr)
+	})
+}
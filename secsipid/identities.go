@@ -0,0 +1,410 @@
+package secsipid
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// IdentityPolicy - conditions for the Identity headers of a call to be
+// accepted
+type IdentityPolicy struct {
+	// PASSporT extension types with at least one valid Identity header
+	Require []string
+	// all Identity headers must be valid
+	AllValid bool
+}
+
+// SJWTIdentityPolicyDefault - at least one valid shaken PASSporT
+var SJWTIdentityPolicyDefault = IdentityPolicy{Require: []string{SJWTPptShaken}}
+
+// SJWTParseIdentityPolicy - parse the policy in text format: "all" (all
+// Identity headers valid), "any" (at least one valid Identity header) or a
+// comma separated list of PASSporT extension types, each one with at least
+// one valid Identity header (e.g., "shaken,rph"), which can be prefixed by
+// "all:" to require also all Identity headers valid; the empty value gives
+// the default policy (at least one valid shaken PASSporT)
+func SJWTParseIdentityPolicy(policyVal string) (IdentityPolicy, int, error) {
+	policyVal = strings.ToLower(strings.TrimSpace(policyVal))
+
+	policy := IdentityPolicy{}
+	if strings.HasPrefix(policyVal, "all:") {
+		policy.AllValid = true
+		policyVal = strings.TrimSpace(policyVal[4:])
+	}
+	switch policyVal {
+	case "":
+		if policy.AllValid {
+			break
+		}
+		return SJWTIdentityPolicyDefault, SJWTRetOK, nil
+	case "all":
+		policy.AllValid = true
+		return policy, SJWTRetOK, nil
+	case "any":
+		return policy, SJWTRetOK, nil
+	}
+	for _, ppt := range strings.Split(policyVal, ",") {
+		ppt = strings.TrimSpace(ppt)
+		switch ppt {
+		case SJWTPptShaken, SJWTPptDiv, SJWTPptRCD, SJWTPptRPH:
+			policy.Require = append(policy.Require, ppt)
+		case "":
+		default:
+			return policy, SJWTRetErr, newError(SJWTRetErr, fmt.Sprintf("invalid PASSporT type in policy (%s)", ppt))
+		}
+	}
+	return policy, SJWTRetOK, nil
+}
+
+// String - return the policy in the text format of SJWTParseIdentityPolicy()
+func (p IdentityPolicy) String() string {
+	switch {
+	case len(p.Require) == 0 && p.AllValid:
+		return "all"
+	case len(p.Require) == 0:
+		return "any"
+	case p.AllValid:
+		return "all:" + strings.Join(p.Require, ",")
+	}
+	return strings.Join(p.Require, ",")
+}
+
+// IdentityResult - result of the verification of one of the Identity headers
+// of a call
+type IdentityResult struct {
+	// position of the Identity header in the list
+	Index int
+	// PASSporT extension type, from the ppt parameter or the JSON header
+	Ppt string
+	// value of the info parameter
+	Info string
+	// details of the verification of a shaken PASSporT (nil for the other
+	// types)
+	Result *VerificationResult
+	// decoded payload: *SJWTPayload, *SJWTDivPayload, *SJWTRCDPayload or
+	// *SJWTRPHPayload (nil if the verification failed before decoding it)
+	Payload interface{}
+	// SJWTRet* code of the verification (SJWTRetOK on success)
+	ErrCode int
+	// error of the verification
+	Err error
+}
+
+// identityResultJSON - JSON representation of IdentityResult
+type identityResultJSON struct {
+	Index   int                 `json:"index"`
+	Ppt     string              `json:"ppt"`
+	Info    string              `json:"info,omitempty"`
+	Result  *VerificationResult `json:"result,omitempty"`
+	Payload interface{}         `json:"payload,omitempty"`
+	ErrCode int                 `json:"errCode"`
+	ErrMsg  string              `json:"errMsg,omitempty"`
+}
+
+// MarshalJSON - return the JSON representation of the result
+func (r *IdentityResult) MarshalJSON() ([]byte, error) {
+	jr := identityResultJSON{
+		Index:   r.Index,
+		Ppt:     r.Ppt,
+		Info:    r.Info,
+		Result:  r.Result,
+		ErrCode: r.ErrCode,
+	}
+	if r.Result == nil {
+		jr.Payload = r.Payload
+	}
+	if r.Err != nil {
+		jr.ErrMsg = r.Err.Error()
+	}
+	return json.Marshal(jr)
+}
+
+// IdentitiesResult - results of the verification of the Identity headers of
+// a call, with the verdict of the policy
+type IdentitiesResult struct {
+	// policy used for the verdict
+	Policy IdentityPolicy
+	// result for each Identity header, in the order of the list
+	Results []*IdentityResult
+	// SJWTRet* code of the verdict (SJWTRetOK if the policy is satisfied)
+	ErrCode int
+	// error of the verdict
+	Err error
+	// duration of the verification
+	Elapsed time.Duration
+}
+
+// identitiesResultJSON - JSON representation of IdentitiesResult
+type identitiesResultJSON struct {
+	Policy    string            `json:"policy"`
+	Results   []*IdentityResult `json:"results"`
+	Verstat   string            `json:"verstat"`
+	ErrCode   int               `json:"errCode"`
+	ErrMsg    string            `json:"errMsg,omitempty"`
+	ElapsedUs int64             `json:"elapsedUs"`
+}
+
+// OK - return true if the policy is satisfied
+func (r *IdentitiesResult) OK() bool {
+	return r.ErrCode == SJWTRetOK
+}
+
+// Shaken - return the result of the first valid shaken PASSporT, nil if
+// there is none
+func (r *IdentitiesResult) Shaken() *VerificationResult {
+	for _, ir := range r.Results {
+		if ir.Ppt == SJWTPptShaken && ir.ErrCode == SJWTRetOK {
+			return ir.Result
+		}
+	}
+	return nil
+}
+
+// Verstat - return the verstat value for the verdict, giving the attestation
+// of the first valid shaken PASSporT
+func (r *IdentitiesResult) Verstat() string {
+	attest := ""
+	if res := r.Shaken(); res != nil {
+		attest = res.Attest
+	}
+	return SJWTGetVerstat(r.ErrCode, attest)
+}
+
+// MarshalJSON - return the JSON representation of the results
+func (r *IdentitiesResult) MarshalJSON() ([]byte, error) {
+	jr := identitiesResultJSON{
+		Policy:    r.Policy.String(),
+		Results:   r.Results,
+		Verstat:   r.Verstat(),
+		ErrCode:   r.ErrCode,
+		ElapsedUs: r.Elapsed.Microseconds(),
+	}
+	if jr.Results == nil {
+		jr.Results = []*IdentityResult{}
+	}
+	if r.Err != nil {
+		jr.ErrMsg = r.Err.Error()
+	}
+	return json.Marshal(jr)
+}
+
+// String - return the results in text format, a line for the verdict and
+// one for each Identity header
+func (r *IdentitiesResult) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "policy: %s\n", r.Policy.String())
+	fmt.Fprintf(&sb, "verstat: %s\n", r.Verstat())
+	fmt.Fprintf(&sb, "result: %d\n", r.ErrCode)
+	if r.Err != nil {
+		fmt.Fprintf(&sb, "error: %v\n", r.Err)
+	}
+	for _, ir := range r.Results {
+		if ir.ErrCode == SJWTRetOK {
+			fmt.Fprintf(&sb, "identity[%d]: %s ok\n", ir.Index, ir.Ppt)
+		} else {
+			fmt.Fprintf(&sb, "identity[%d]: %s failed (%d) - %v\n", ir.Index, ir.Ppt, ir.ErrCode, ir.Err)
+		}
+	}
+	return sb.String()
+}
+
+// CheckIdentitiesResult - verify all the Identity headers of a call, each one
+// with the public key from its info parameter if pubkeyPath is empty, and
+// give the verdict of the policy
+//
+// The shaken PASSporTs are verified with CheckFullIdentitySIPResult(), the
+// div, rcd and rph ones with CheckDivIdentity(), CheckRCDIdentity() and
+// CheckRPHIdentity() (with the Resource-Priority value of hdrs). The values of
+// hdrs are optional, the empty ones being skipped.
+//
+// If the policy is not satisfied, the code of the verdict is the one of the
+// first failed Identity header which makes it fail, or
+// SJWTRetErrSIPHdrPolicy if a required PASSporT type has no Identity header
+// (SJWTRetErrSIPHdrEmpty if there is no Identity header at all). When it is
+// satisfied, the valid div PASSporTs must be linked to the first valid
+// shaken PASSporT with CheckDivChain(), otherwise the code of the verdict is
+// SJWTRetErrJSONPayloadDivChain.
+func (v *Verifier) CheckIdentitiesResult(identityVals []string, pubkeyPath string, hdrs SJWTSIPHeaders, policy IdentityPolicy) *IdentitiesResult {
+	tstart := time.Now()
+	res := &IdentitiesResult{Policy: policy}
+
+	for i, identityVal := range identityVals {
+		res.Results = append(res.Results, v.checkIdentityOfCall(i, identityVal, pubkeyPath, hdrs))
+	}
+	res.ErrCode, res.Err = res.verdict()
+	if res.ErrCode == SJWTRetOK {
+		res.ErrCode, res.Err = v.checkDivChain(res)
+	}
+	res.Elapsed = time.Since(tstart)
+	return res
+}
+
+// checkDivChain - check that the valid div PASSporTs are linked to the first
+// valid shaken PASSporT
+func (v *Verifier) checkDivChain(res *IdentitiesResult) (int, error) {
+	var payload *SJWTPayload
+	var divPayloads []*SJWTDivPayload
+	for _, ir := range res.Results {
+		if ir.ErrCode != SJWTRetOK {
+			continue
+		}
+		switch p := ir.Payload.(type) {
+		case *SJWTPayload:
+			if payload == nil {
+				payload = p
+			}
+		case *SJWTDivPayload:
+			divPayloads = append(divPayloads, p)
+		}
+	}
+	if len(divPayloads) == 0 {
+		return SJWTRetOK, nil
+	}
+	if payload == nil {
+		return SJWTRetErrJSONPayloadDivChain, newError(SJWTRetErrJSONPayloadDivChain, "no valid shaken PASSporT for the div PASSporTs")
+	}
+	return v.CheckDivChain(payload, divPayloads)
+}
+
+// checkIdentityOfCall - verify an Identity header according to its PASSporT
+// extension type
+func (v *Verifier) checkIdentityOfCall(index int, identityVal string, pubkeyPath string, hdrs SJWTSIPHeaders) *IdentityResult {
+	ir := &IdentityResult{
+		Index: index,
+		Ppt:   SJWTPptShaken,
+	}
+
+	hdr, ret, err := SJWTParseIdentityHeader(identityVal)
+	if err != nil {
+		ir.ErrCode, ir.Err = ret, err
+		return ir
+	}
+	ir.Info = hdr.Info
+	if len(hdr.Ppt) > 0 {
+		ir.Ppt = hdr.Ppt
+	} else if ppt := identityTokenPpt(hdr.Token); len(ppt) > 0 {
+		ir.Ppt = ppt
+	}
+
+	switch ir.Ppt {
+	case SJWTPptShaken:
+		ir.Result = v.CheckFullIdentitySIPResult(identityVal, pubkeyPath, hdrs)
+		ir.ErrCode, ir.Err = ir.Result.ErrCode, ir.Result.Err
+		if ir.Result.Payload != nil {
+			ir.Payload = ir.Result.Payload
+		}
+	case SJWTPptDiv:
+		payload, ret, err := v.CheckDivIdentity(identityVal, pubkeyPath)
+		ir.ErrCode, ir.Err = ret, err
+		if payload != nil {
+			ir.Payload = payload
+		}
+	case SJWTPptRCD:
+		payload, ret, err := v.CheckRCDIdentity(identityVal, pubkeyPath)
+		ir.ErrCode, ir.Err = ret, err
+		if payload != nil {
+			ir.Payload = payload
+		}
+	case SJWTPptRPH:
+		payload, ret, err := v.CheckRPHIdentity(identityVal, pubkeyPath, hdrs.ResourcePriority)
+		ir.ErrCode, ir.Err = ret, err
+		if payload != nil {
+			ir.Payload = payload
+		}
+	default:
+		ir.ErrCode = SJWTRetErrSIPHdrPpt
+		ir.Err = newError(SJWTRetErrSIPHdrPpt, fmt.Sprintf("unsupported PASSporT type (%s)", ir.Ppt))
+	}
+	return ir
+}
+
+// identityTokenPpt - return the ppt of the JSON header of the token, empty if
+// it cannot be decoded or it has no ppt
+func identityTokenPpt(token string) string {
+	btoken := strings.Split(token, ".")
+	if len(btoken) != 3 || len(btoken[0]) == 0 {
+		return ""
+	}
+	jsonHeader, err := SJWTBase64DecodeBytes(btoken[0])
+	if err != nil {
+		return ""
+	}
+	header := SJWTHeader{}
+	if json.Unmarshal(jsonHeader, &header) != nil {
+		return ""
+	}
+	return header.Ppt
+}
+
+// verdict - return the code and error of the policy verdict for the results
+func (r *IdentitiesResult) verdict() (int, error) {
+	if len(r.Results) == 0 {
+		return SJWTRetErrSIPHdrEmpty, ErrSIPHdrEmpty
+	}
+
+	if r.Policy.AllValid {
+		for _, ir := range r.Results {
+			if ir.ErrCode != SJWTRetOK {
+				return ir.ErrCode, wrapError(ir.ErrCode, fmt.Sprintf("identity[%d] (%s) not valid", ir.Index, ir.Ppt), ir.Err)
+			}
+		}
+	} else if len(r.Policy.Require) == 0 {
+		for _, ir := range r.Results {
+			if ir.ErrCode == SJWTRetOK {
+				return SJWTRetOK, nil
+			}
+		}
+		ir := r.Results[0]
+		return ir.ErrCode, wrapError(ir.ErrCode, "no valid identity", ir.Err)
+	}
+
+	for _, ppt := range r.Policy.Require {
+		var failed *IdentityResult
+		found := false
+		for _, ir := range r.Results {
+			if ir.Ppt != ppt {
+				continue
+			}
+			if ir.ErrCode == SJWTRetOK {
+				found = true
+				break
+			}
+			if failed == nil {
+				failed = ir
+			}
+		}
+		if found {
+			continue
+		}
+		if failed == nil {
+			return SJWTRetErrSIPHdrPolicy, newError(SJWTRetErrSIPHdrPolicy, fmt.Sprintf("no identity with %s PASSporT", ppt))
+		}
+		return failed.ErrCode, wrapError(failed.ErrCode, fmt.Sprintf("no valid identity with %s PASSporT", ppt), failed.Err)
+	}
+	return SJWTRetOK, nil
+}
+
+// CheckSIPMessageIdentities - verify all the Identity headers of the SIP
+// message with CheckIdentitiesResult(), using its headers
+func (v *Verifier) CheckSIPMessageIdentities(msgData []byte, pubkeyPath string, policy IdentityPolicy) *IdentitiesResult {
+	msg, ret, err := SJWTParseSIPMessage(msgData)
+	if err != nil {
+		return &IdentitiesResult{Policy: policy, ErrCode: ret, Err: err}
+	}
+	return v.CheckIdentitiesResult(msg.IdentityValues(), pubkeyPath, msg.SIPHeaders(), policy)
+}
+
+// SJWTCheckIdentitiesResult - verify all the Identity headers of a call and
+// give the verdict of the policy
+func SJWTCheckIdentitiesResult(identityVals []string, expireVal int, pubkeyPath string, timeoutVal int, hdrs SJWTSIPHeaders, policy IdentityPolicy) *IdentitiesResult {
+	return defaultVerifier(expireVal, timeoutVal).CheckIdentitiesResult(identityVals, pubkeyPath, hdrs, policy)
+}
+
+// SJWTCheckSIPMessageIdentities - verify all the Identity headers of the SIP
+// message and give the verdict of the policy
+func SJWTCheckSIPMessageIdentities(msgData []byte, expireVal int, pubkeyPath string, timeoutVal int, policy IdentityPolicy) *IdentitiesResult {
+	return defaultVerifier(expireVal, timeoutVal).CheckSIPMessageIdentities(msgData, pubkeyPath, policy)
+}
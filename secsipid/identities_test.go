@@ -0,0 +1,176 @@
+package secsipid_test
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+type ParseIdentityPolicyTest struct {
+	policyVal string
+
+	expectedErrCode int
+	expectedPolicy  secsipid.IdentityPolicy
+}
+
+func TestParseIdentityPolicy(t *testing.T) {
+	testCases := map[string]ParseIdentityPolicyTest{
+		"OK with default policy": {
+			policyVal:       "",
+			expectedErrCode: secsipid.SJWTRetOK,
+			expectedPolicy:  secsipid.IdentityPolicy{Require: []string{"shaken"}},
+		},
+		"OK with all": {
+			policyVal:       "all",
+			expectedErrCode: secsipid.SJWTRetOK,
+			expectedPolicy:  secsipid.IdentityPolicy{AllValid: true},
+		},
+		"OK with any": {
+			policyVal:       "any",
+			expectedErrCode: secsipid.SJWTRetOK,
+			expectedPolicy:  secsipid.IdentityPolicy{},
+		},
+		"OK with required types and all valid": {
+			policyVal:       "all: shaken, rph",
+			expectedErrCode: secsipid.SJWTRetOK,
+			expectedPolicy:  secsipid.IdentityPolicy{Require: []string{"shaken", "rph"}, AllValid: true},
+		},
+		"Err with unknown type": {
+			policyVal:       "shaken,foo",
+			expectedErrCode: secsipid.SJWTRetErr,
+			expectedPolicy:  secsipid.IdentityPolicy{Require: []string{"shaken"}},
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			policy, errCode, _ := secsipid.SJWTParseIdentityPolicy(testCase.policyVal)
+
+			expect(errCode).ToBe(testCase.expectedErrCode)
+			expect(policy).ToEqual(testCase.expectedPolicy)
+		})
+	}
+}
+
+type CheckIdentitiesTest struct {
+	identities []string
+	policy     string
+
+	expectedErrCode  int
+	expectedErrCodes []int
+}
+
+func TestCheckIdentitiesResult(t *testing.T) {
+	keyPath := path.Join(t.TempDir(), "ec256-private.pem")
+	_, pubKey := writeDummyECKey(keyPath)
+	pubKeyPath := path.Join(t.TempDir(), "ec256-public.pem")
+	os.WriteFile(pubKeyPath, pubKey, 0600)
+
+	signer, _, _ := secsipid.NewSigner(secsipid.SignerOptions{
+		PrvKeyPath: keyPath,
+		X5u:        "https://127.0.0.1/cert.pem",
+	})
+	verifier := secsipid.NewVerifier(secsipid.VerifierOptions{Expire: 60})
+
+	shaken, _, _ := signer.Sign("15559876543", []string{"15551234567"}, "A", "")
+	div, _, _ := signer.SignDiv("15559876543", []string{"15550000000"}, "15551234567")
+	divUnlinked, _, _ := signer.SignDiv("15559876543", []string{"15550000000"}, "15557777777")
+	rph, _, _ := signer.SignRPH("15559876543", []string{"15551234567"}, "ets.0")
+	invalid := strings.Replace(shaken, ".", ".x", 1)
+	hdrs := secsipid.SJWTSIPHeaders{ResourcePriority: "ets.0"}
+
+	testCases := map[string]CheckIdentitiesTest{
+		"OK with valid shaken, div and rph PASSporTs": {
+			identities:       []string{shaken, div, rph},
+			policy:           "all:shaken",
+			expectedErrCode:  secsipid.SJWTRetOK,
+			expectedErrCodes: []int{secsipid.SJWTRetOK, secsipid.SJWTRetOK, secsipid.SJWTRetOK},
+		},
+		"OK with one invalid shaken PASSporT and default policy": {
+			identities:       []string{invalid, shaken},
+			policy:           "",
+			expectedErrCode:  secsipid.SJWTRetOK,
+			expectedErrCodes: []int{secsipid.SJWTRetErrJSONPayloadParse, secsipid.SJWTRetOK},
+		},
+		"OK with any valid identity": {
+			identities:       []string{rph},
+			policy:           "any",
+			expectedErrCode:  secsipid.SJWTRetOK,
+			expectedErrCodes: []int{secsipid.SJWTRetOK},
+		},
+		"ErrSIPHdrPolicy without shaken PASSporT": {
+			identities:       []string{div, rph},
+			policy:           "shaken",
+			expectedErrCode:  secsipid.SJWTRetErrSIPHdrPolicy,
+			expectedErrCodes: []int{secsipid.SJWTRetOK, secsipid.SJWTRetOK},
+		},
+		"ErrJSONPayloadParse without valid shaken PASSporT": {
+			identities:       []string{invalid, rph},
+			policy:           "shaken,rph",
+			expectedErrCode:  secsipid.SJWTRetErrJSONPayloadParse,
+			expectedErrCodes: []int{secsipid.SJWTRetErrJSONPayloadParse, secsipid.SJWTRetOK},
+		},
+		"ErrJSONPayloadParse with all valid policy": {
+			identities:       []string{shaken, invalid},
+			policy:           "all",
+			expectedErrCode:  secsipid.SJWTRetErrJSONPayloadParse,
+			expectedErrCodes: []int{secsipid.SJWTRetOK, secsipid.SJWTRetErrJSONPayloadParse},
+		},
+		"ErrJSONPayloadDivChain with div not linked to shaken": {
+			identities:       []string{shaken, divUnlinked},
+			policy:           "shaken",
+			expectedErrCode:  secsipid.SJWTRetErrJSONPayloadDivChain,
+			expectedErrCodes: []int{secsipid.SJWTRetOK, secsipid.SJWTRetOK},
+		},
+		"ErrJSONPayloadDivChain with div without shaken": {
+			identities:       []string{div, rph},
+			policy:           "any",
+			expectedErrCode:  secsipid.SJWTRetErrJSONPayloadDivChain,
+			expectedErrCodes: []int{secsipid.SJWTRetOK, secsipid.SJWTRetOK},
+		},
+		"ErrSIPHdrEmpty without identities": {
+			identities:       []string{},
+			policy:           "any",
+			expectedErrCode:  secsipid.SJWTRetErrSIPHdrEmpty,
+			expectedErrCodes: []int{},
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			policy, _, _ := secsipid.SJWTParseIdentityPolicy(testCase.policy)
+			res := verifier.CheckIdentitiesResult(testCase.identities, pubKeyPath, hdrs, policy)
+
+			errCodes := []int{}
+			for _, ir := range res.Results {
+				errCodes = append(errCodes, ir.ErrCode)
+			}
+			expect(res.ErrCode).ToBe(testCase.expectedErrCode)
+			expect(secsipid.SJWTErrorCode(res.Err)).ToBe(testCase.expectedErrCode)
+			expect(errCodes).ToEqual(testCase.expectedErrCodes)
+		})
+	}
+
+	t.Run("OK with PASSporT types and JSON output", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		res := verifier.CheckIdentitiesResult([]string{shaken, div, rph}, pubKeyPath, hdrs, secsipid.SJWTIdentityPolicyDefault)
+		jsonRes, _ := json.Marshal(res)
+
+		expect(res.Results[0].Ppt).ToBe("shaken")
+		expect(res.Results[1].Ppt).ToBe("div")
+		expect(res.Results[2].Ppt).ToBe("rph")
+		expect(res.Shaken().Attest).ToBe("A")
+		expect(res.Verstat()).ToBe(secsipid.SJWTVerstatPassed)
+		expect(strings.Contains(string(jsonRes), `"policy":"shaken"`)).ToBe(true)
+	})
+}
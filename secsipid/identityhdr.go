@@ -0,0 +1,314 @@
+package secsipid
+
+import (
+	"regexp"
+	"strings"
+)
+
+// IdentityParam - generic parameter of the Identity header
+type IdentityParam struct {
+	// parameter name
+	Name string
+	// parameter value as in the header (quoted strings keep the quotes),
+	// empty if the parameter has no value
+	Value string
+}
+
+// IdentityHeader - value of the Identity header (RFC 8224 section 4.1)
+type IdentityHeader struct {
+	// signed identity digest (the PASSporT token)
+	Token string
+	// URI of the info parameter, without the angle brackets
+	Info string
+	// value of the alg parameter
+	Alg string
+	// value of the ppt parameter, without the quotes
+	Ppt string
+	// the other parameters, in the order of the header
+	Params []IdentityParam
+}
+
+var identityHdrNameRE = regexp.MustCompile(`(?i)^(identity|y)[ \t]*:`)
+
+// SJWTParseIdentityHeader - parse the value of an Identity header, which can
+// be prefixed by the header name and can have folded lines; the value must
+// have a single identity, see SJWTParseIdentityHeaders() for the header values
+// with several comma separated identities
+func SJWTParseIdentityHeader(hdrVal string) (*IdentityHeader, int, error) {
+	hdrs, ret, err := SJWTParseIdentityHeaders(hdrVal)
+	if err != nil {
+		return nil, ret, err
+	}
+	if len(hdrs) > 1 {
+		return nil, SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "several identities in the header value")
+	}
+	return hdrs[0], SJWTRetOK, nil
+}
+
+// SJWTParseIdentityHeaders - parse the value of an Identity header with one
+// or more comma separated identities
+func SJWTParseIdentityHeaders(hdrVal string) ([]*IdentityHeader, int, error) {
+	p := &identityHdrParser{
+		s: identityHdrNameRE.ReplaceAllString(strings.TrimSpace(hdrVal), ""),
+	}
+
+	var hdrs []*IdentityHeader
+	for {
+		hdr, ret, err := p.parseIdentity()
+		if err != nil {
+			return nil, ret, err
+		}
+		hdrs = append(hdrs, hdr)
+		p.skipLWS()
+		if p.eof() {
+			return hdrs, SJWTRetOK, nil
+		}
+		// the parser stops only at the end or at a comma
+		p.pos++
+	}
+}
+
+// String - return the Identity header value
+func (h *IdentityHeader) String() string {
+	var sb strings.Builder
+
+	sb.WriteString(h.Token)
+	if len(h.Info) > 0 {
+		sb.WriteString(";info=<" + h.Info + ">")
+	}
+	if len(h.Alg) > 0 {
+		sb.WriteString(";alg=" + h.Alg)
+	}
+	if len(h.Ppt) > 0 {
+		sb.WriteString(";ppt=" + h.Ppt)
+	}
+	for _, param := range h.Params {
+		sb.WriteString(";" + param.Name)
+		if len(param.Value) > 0 {
+			sb.WriteString("=" + param.Value)
+		}
+	}
+	return sb.String()
+}
+
+// Param - return the value of the parameter and true if the header has it;
+// for info, alg and ppt the value is the one of the related field
+func (h *IdentityHeader) Param(name string) (string, bool) {
+	switch strings.ToLower(name) {
+	case "info":
+		return h.Info, len(h.Info) > 0
+	case "alg":
+		return h.Alg, len(h.Alg) > 0
+	case "ppt":
+		return h.Ppt, len(h.Ppt) > 0
+	}
+	for _, param := range h.Params {
+		if strings.EqualFold(param.Name, name) {
+			return param.Value, true
+		}
+	}
+	return "", false
+}
+
+// hasParams - return true if the header has parameters
+func (h *IdentityHeader) hasParams() bool {
+	return len(h.Info) > 0 || len(h.Alg) > 0 || len(h.Ppt) > 0 || len(h.Params) > 0
+}
+
+// tokenParts - return the header, payload and signature parts of the token
+func (h *IdentityHeader) tokenParts() ([]string, int, error) {
+	btoken := strings.Split(h.Token, ".")
+	if len(btoken) != 3 {
+		return nil, SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "invalid token - must contain header, payload and signature")
+	}
+	return btoken, SJWTRetOK, nil
+}
+
+// validInfo - return info parameter value if alg and ppt are valid for the
+// PASSporT extension type ppt
+func (h *IdentityHeader) validInfo(ppt string) (string, int, error) {
+	if len(h.Alg) > 0 && h.Alg != "ES256" {
+		return "", SJWTRetErrSIPHdrAlg, newError(SJWTRetErrSIPHdrAlg, "invalid value for alg header parameter")
+	}
+	if len(h.Ppt) > 0 && h.Ppt != ppt {
+		return "", SJWTRetErrSIPHdrPpt, newError(SJWTRetErrSIPHdrPpt, "invalid value for ppt header parameter")
+	}
+	if len(h.Info) == 0 {
+		return "", SJWTRetErrSIPHdrInfo, newError(SJWTRetErrSIPHdrInfo, "invalid value info header parameter")
+	}
+	return h.Info, SJWTRetOK, nil
+}
+
+// identityHdrParser - parser of the Identity header value, following the
+// grammar of RFC 8224 section 4.1 and RFC 3261 section 25.1
+type identityHdrParser struct {
+	s   string
+	pos int
+}
+
+func (p *identityHdrParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+// skipLWS - skip the white spaces, including the line folding
+func (p *identityHdrParser) skipLWS() {
+	for !p.eof() {
+		switch p.s[p.pos] {
+		case ' ', '\t', '\r', '\n':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// parseIdentity - parse an identity, until the end or a comma
+func (p *identityHdrParser) parseIdentity() (*IdentityHeader, int, error) {
+	hdr := &IdentityHeader{}
+
+	// signed-identity-digest, white spaces from line folding are removed
+	var token strings.Builder
+	for ; !p.eof() && p.s[p.pos] != ';' && p.s[p.pos] != ','; p.pos++ {
+		c := p.s[p.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+		case isIdentityTokenChar(c):
+			token.WriteByte(c)
+		default:
+			return nil, SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "invalid character in token")
+		}
+	}
+	hdr.Token = token.String()
+	if len(hdr.Token) == 0 {
+		return nil, SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "no token in identity header")
+	}
+
+	seen := map[string]bool{}
+	for !p.eof() && p.s[p.pos] == ';' {
+		p.pos++
+		p.skipLWS()
+		name := p.readWhile(isSIPTokenChar)
+		if len(name) == 0 {
+			return nil, SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "invalid parameter name")
+		}
+		p.skipLWS()
+		value := ""
+		if !p.eof() && p.s[p.pos] == '=' {
+			p.pos++
+			p.skipLWS()
+			var ret int
+			var err error
+			if value, ret, err = p.parseParamValue(); err != nil {
+				return nil, ret, err
+			}
+			p.skipLWS()
+		}
+		if !p.eof() && p.s[p.pos] != ';' && p.s[p.pos] != ',' {
+			return nil, SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "invalid value of parameter "+name)
+		}
+
+		lname := strings.ToLower(name)
+		switch lname {
+		case "info", "alg", "ppt":
+			if seen[lname] {
+				return nil, SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "duplicated parameter "+lname)
+			}
+			seen[lname] = true
+		}
+		switch lname {
+		case "info":
+			if len(value) <= 2 {
+				return nil, SJWTRetErrSIPHdrInfo, newError(SJWTRetErrSIPHdrInfo, "invalid value info header parameter")
+			}
+			if value[0] == '<' && value[len(value)-1] == '>' {
+				value = strings.TrimSpace(value[1 : len(value)-1])
+			}
+			hdr.Info = value
+		case "alg":
+			hdr.Alg = value
+		case "ppt":
+			hdr.Ppt = sipUnquote(value)
+		default:
+			hdr.Params = append(hdr.Params, IdentityParam{Name: name, Value: value})
+		}
+	}
+	if !p.eof() && p.s[p.pos] != ',' {
+		return nil, SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "invalid identity header")
+	}
+	return hdr, SJWTRetOK, nil
+}
+
+// parseParamValue - parse a parameter value: URI in angle brackets, quoted
+// string or token
+func (p *identityHdrParser) parseParamValue() (string, int, error) {
+	start := p.pos
+	if p.eof() {
+		return "", SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "missing parameter value")
+	}
+	switch p.s[p.pos] {
+	case '<':
+		end := strings.IndexByte(p.s[p.pos:], '>')
+		if end < 0 {
+			return "", SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "missing '>' in parameter value")
+		}
+		p.pos += end + 1
+	case '"':
+		for p.pos++; ; p.pos++ {
+			if p.eof() {
+				return "", SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "unterminated quoted string")
+			}
+			if p.s[p.pos] == '\\' {
+				p.pos++
+			} else if p.s[p.pos] == '"' {
+				p.pos++
+				break
+			}
+		}
+	default:
+		if len(p.readWhile(isSIPParamValueChar)) == 0 {
+			return "", SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "invalid parameter value")
+		}
+	}
+	return p.s[start:p.pos], SJWTRetOK, nil
+}
+
+// readWhile - return the next characters accepted by the function
+func (p *identityHdrParser) readWhile(accept func(c byte) bool) string {
+	start := p.pos
+	for !p.eof() && accept(p.s[p.pos]) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// isIdentityTokenChar - base64 (standard and URL alphabet) or '.'
+func isIdentityTokenChar(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+		strings.IndexByte("+/-_=.", c) >= 0
+}
+
+// isSIPTokenChar - token character (RFC 3261 section 25.1)
+func isSIPTokenChar(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+		strings.IndexByte("-.!%*_+`'~", c) >= 0
+}
+
+// isSIPParamValueChar - token character or the ones allowed in host values
+func isSIPParamValueChar(c byte) bool {
+	return isSIPTokenChar(c) || c == ':' || c == '[' || c == ']'
+}
+
+// sipUnquote - return the value without the quotes and escaping backslashes
+func sipUnquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	var sb strings.Builder
+	for i := 1; i < len(value)-1; i++ {
+		if value[i] == '\\' && i+1 < len(value)-1 {
+			i++
+		}
+		sb.WriteByte(value[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,158 @@
+package secsipid_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+type ParseIdentityHeaderTest struct {
+	hdrVal string
+
+	expectedErrCode int
+	expectedHdr     *secsipid.IdentityHeader
+}
+
+func TestParseIdentityHeader(t *testing.T) {
+	runTest := func(t *testing.T, testCase ParseIdentityHeaderTest) {
+		expect := expectate.Expect(t)
+
+		hdr, errCode, err := secsipid.SJWTParseIdentityHeader(testCase.hdrVal)
+
+		expect(errCode).ToBe(testCase.expectedErrCode)
+		expect(secsipid.SJWTErrorCode(err)).ToBe(testCase.expectedErrCode)
+		expect(hdr).ToEqual(testCase.expectedHdr)
+	}
+
+	testCases := map[string]ParseIdentityHeaderTest{
+		"OK with info, alg and ppt": {
+			hdrVal:          "a.b.c;info=<https://127.0.0.1/cert.pem>;alg=ES256;ppt=shaken",
+			expectedErrCode: secsipid.SJWTRetOK,
+			expectedHdr: &secsipid.IdentityHeader{
+				Token: "a.b.c",
+				Info:  "https://127.0.0.1/cert.pem",
+				Alg:   "ES256",
+				Ppt:   "shaken",
+			},
+		},
+		"OK with header name, folding and quoted ppt": {
+			hdrVal:          "Identity: a.b.c ;\r\n info=<https://127.0.0.1/cert.pem> ; alg = ES256;ppt=\"shaken\"",
+			expectedErrCode: secsipid.SJWTRetOK,
+			expectedHdr: &secsipid.IdentityHeader{
+				Token: "a.b.c",
+				Info:  "https://127.0.0.1/cert.pem",
+				Alg:   "ES256",
+				Ppt:   "shaken",
+			},
+		},
+		"OK with generic parameters": {
+			hdrVal:          `a.b.c;info=<https://127.0.0.1/cert.pem?a=1;b=2>;x-note="k=v; x";flag`,
+			expectedErrCode: secsipid.SJWTRetOK,
+			expectedHdr: &secsipid.IdentityHeader{
+				Token: "a.b.c",
+				Info:  "https://127.0.0.1/cert.pem?a=1;b=2",
+				Params: []secsipid.IdentityParam{
+					{Name: "x-note", Value: `"k=v; x"`},
+					{Name: "flag"},
+				},
+			},
+		},
+		"OK with only token": {
+			hdrVal:          "a.b.c",
+			expectedErrCode: secsipid.SJWTRetOK,
+			expectedHdr: &secsipid.IdentityHeader{
+				Token: "a.b.c",
+			},
+		},
+		"ErrSIPHdrParse with several identities": {
+			hdrVal:          "a.b.c;info=<https://127.0.0.1/1.pem>, d.e.f;info=<https://127.0.0.1/2.pem>",
+			expectedErrCode: secsipid.SJWTRetErrSIPHdrParse,
+		},
+		"ErrSIPHdrParse with invalid token": {
+			hdrVal:          "a.b!c;info=<https://127.0.0.1/cert.pem>",
+			expectedErrCode: secsipid.SJWTRetErrSIPHdrParse,
+		},
+		"ErrSIPHdrParse with unterminated quoted string": {
+			hdrVal:          `a.b.c;info=<https://127.0.0.1/cert.pem>;x="abc`,
+			expectedErrCode: secsipid.SJWTRetErrSIPHdrParse,
+		},
+		"ErrSIPHdrParse with duplicated info": {
+			hdrVal:          "a.b.c;info=<https://127.0.0.1/1.pem>;info=<https://127.0.0.1/2.pem>",
+			expectedErrCode: secsipid.SJWTRetErrSIPHdrParse,
+		},
+		"ErrSIPHdrInfo with empty info": {
+			hdrVal:          "a.b.c;info=<>",
+			expectedErrCode: secsipid.SJWTRetErrSIPHdrInfo,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			runTest(t, testCase)
+		})
+	}
+}
+
+func TestParseIdentityHeaders(t *testing.T) {
+	expect := expectate.Expect(t)
+
+	hdrs, errCode, _ := secsipid.SJWTParseIdentityHeaders(
+		`a.b.c;info=<https://127.0.0.1/1.pem>;x="1,2", d.e.f;info=<https://127.0.0.1/2.pem>;ppt=div`)
+
+	expect(errCode).ToBe(secsipid.SJWTRetOK)
+	expect(len(hdrs)).ToBe(2)
+	expect(hdrs[0].String()).ToBe(`a.b.c;info=<https://127.0.0.1/1.pem>;x="1,2"`)
+	expect(hdrs[1].String()).ToBe("d.e.f;info=<https://127.0.0.1/2.pem>;ppt=div")
+}
+
+func TestIdentityHeaderString(t *testing.T) {
+	expect := expectate.Expect(t)
+
+	hdr := secsipid.IdentityHeader{
+		Token: "a.b.c",
+		Info:  "https://127.0.0.1/cert.pem",
+		Alg:   "ES256",
+		Ppt:   "shaken",
+	}
+
+	expect(hdr.String()).ToBe("a.b.c;info=<https://127.0.0.1/cert.pem>;alg=ES256;ppt=shaken")
+}
+
+func TestCheckFullIdentityHeaderForms(t *testing.T) {
+	keyPath := path.Join(t.TempDir(), "ec256-private.pem")
+	_, pubKey := writeDummyECKey(keyPath)
+	pubKeyPath := path.Join(t.TempDir(), "ec256-public.pem")
+	os.WriteFile(pubKeyPath, pubKey, 0600)
+
+	identity, _, _ := secsipid.SJWTGetIdentity("15559876543", "15551234567", "A", "", "https://127.0.0.1/cert.pem", keyPath)
+	hdr, _, _ := secsipid.SJWTParseIdentityHeader(identity)
+
+	t.Run("OK with generic parameter containing '='", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		errCode, _ := secsipid.SJWTCheckFullIdentity(identity+`;x-note="a=b"`, 60, pubKeyPath, 5)
+
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("OK with header name and folded line", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		errCode, _ := secsipid.SJWTCheckFullIdentity("Identity: "+hdr.Token+";\r\n\tinfo=<"+hdr.Info+">;alg=ES256", 60, pubKeyPath, 5)
+
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("ErrSIPHdrAlg with other alg", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		mHdr := *hdr
+		mHdr.Alg = "RS256"
+		errCode, _ := secsipid.SJWTCheckFullIdentity(mHdr.String(), 60, pubKeyPath, 5)
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrSIPHdrAlg)
+	})
+}
@@ -300,7 +300,7 @@ func TestPubKeyVerify(t *testing.T) {
 			inputKey:   cert,
 
 			expectedErrCode: secsipid.SJWTRetErrCertReadCRLFile,
-			expectedErrMsg:  "failed to read CRL file",
+			expectedErrMsg:  "failed to read CRL file: stat dummyCRLFile.crl: no such file or directory",
 		})
 
 		os.Remove("dummyCA.pem")
@@ -0,0 +1,295 @@
+package secsipid
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SJWTRCD - rich call data of the rcd claim
+type SJWTRCD struct {
+	// application name
+	Apn string `json:"apn,omitempty"`
+	// URL of the icon (logo)
+	Icn string `json:"icn,omitempty"`
+	// jCard content
+	Jcd []interface{} `json:"jcd,omitempty"`
+	// URL of the jCard
+	Jcl string `json:"jcl,omitempty"`
+	// display name
+	Nam string `json:"nam"`
+}
+
+// SJWTRCDPayload - payload of rcd PASSporT
+type SJWTRCDPayload struct {
+	CRN  string            `json:"crn,omitempty"`
+	Dest SJWTDest          `json:"dest"`
+	IAT  int64             `json:"iat"`
+	Orig SJWTOrig          `json:"orig"`
+	RCD  SJWTRCD           `json:"rcd"`
+	RCDI map[string]string `json:"rcdi,omitempty"`
+	// members not known by the library, preserved when decoding and encoding
+	Extra map[string]interface{} `json:"-"`
+}
+
+// GetRCDI - return the rcdi claim for the rcd claim, with the digests of the
+// content referenced by URL (icn, jcl, the URIs inside jcd and inside the
+// jCard referenced by jcl), fetched with GetURLContent()
+func (v *Verifier) GetRCDI(rcd *SJWTRCD) (map[string]string, int, error) {
+	ptrs, ret, err := v.rcdURLPointers(rcd)
+	if err != nil {
+		return nil, ret, err
+	}
+	rcdi := map[string]string{}
+	for _, ptr := range ptrs {
+		digest, ret, err := v.rcdDigest(rcd, ptr, "sha256")
+		if err != nil {
+			return nil, ret, err
+		}
+		rcdi[ptr] = digest
+	}
+	return rcdi, SJWTRetOK, nil
+}
+
+// SJWTGetRCDI - return the rcdi claim for the rcd claim, with the digests of
+// the content referenced by URL
+func SJWTGetRCDI(rcd *SJWTRCD, timeoutVal int) (map[string]string, int, error) {
+	return defaultVerifier(0, timeoutVal).GetRCDI(rcd)
+}
+
+// CheckRCD - check the rcd claim and the integrity digests of the rcdi claim
+// for the content it references; each content referenced by URL must have a
+// digest in the rcdi claim
+func (v *Verifier) CheckRCD(rcd *SJWTRCD, rcdi map[string]string) (int, error) {
+	if rcd == nil {
+		if len(rcdi) > 0 {
+			return SJWTRetErrJSONPayloadRCD, newError(SJWTRetErrJSONPayloadRCD, "rcdi claim without rcd claim")
+		}
+		return SJWTRetOK, nil
+	}
+	if len(rcd.Nam) == 0 {
+		return SJWTRetErrJSONPayloadRCD, newError(SJWTRetErrJSONPayloadRCD, "missing nam in rcd claim")
+	}
+	urlPtrs, ret, err := v.rcdURLPointers(rcd)
+	if err != nil {
+		return ret, err
+	}
+	for _, ptr := range urlPtrs {
+		if _, ok := rcdi[ptr]; !ok {
+			return SJWTRetErrJSONPayloadRCDI, newError(SJWTRetErrJSONPayloadRCDI,
+				fmt.Sprintf("missing digest for %s", ptr))
+		}
+	}
+
+	ptrs := make([]string, 0, len(rcdi))
+	for ptr := range rcdi {
+		ptrs = append(ptrs, ptr)
+	}
+	sort.Strings(ptrs)
+	for _, ptr := range ptrs {
+		alg := strings.SplitN(rcdi[ptr], "-", 2)[0]
+		digest, ret, err := v.rcdDigest(rcd, ptr, alg)
+		if err != nil {
+			return ret, err
+		}
+		if digest != rcdi[ptr] {
+			return SJWTRetErrJSONPayloadRCDI, newError(SJWTRetErrJSONPayloadRCDI,
+				fmt.Sprintf("mismatching digest for %s", ptr))
+		}
+	}
+	return SJWTRetOK, nil
+}
+
+// rcdDigest - return the digest with the algorithm alg of the content at the
+// URL referenced by the JSON pointer ptr inside the rcd claim, or inside the
+// jCard referenced by jcl for the pointers starting with "/jcl/"
+func (v *Verifier) rcdDigest(rcd *SJWTRCD, ptr string, alg string) (string, int, error) {
+	var h hash.Hash
+
+	switch alg {
+	case "sha256":
+		h = sha256.New()
+	case "sha384":
+		h = sha512.New384()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return "", SJWTRetErrJSONPayloadRCDI, newError(SJWTRetErrJSONPayloadRCDI,
+			fmt.Sprintf("unsupported digest algorithm for %s", ptr))
+	}
+
+	var val interface{}
+	var ok bool
+	if strings.HasPrefix(ptr, "/jcl/") {
+		jcard, ret, err := v.rcdJCard(rcd)
+		if err != nil {
+			return "", ret, err
+		}
+		val, ok = jsonPointerGet(jcard, ptr[len("/jcl"):])
+	} else {
+		// resolve the pointer on the generic JSON representation of the claim
+		val, ok = jsonPointerGet(rcdJSONDoc(rcd), ptr)
+	}
+	if !ok {
+		return "", SJWTRetErrJSONPayloadRCDI, newError(SJWTRetErrJSONPayloadRCDI,
+			fmt.Sprintf("invalid rcdi pointer %s", ptr))
+	}
+	urlVal, isStr := val.(string)
+	if !isStr || !isRCDURL(urlVal) {
+		return "", SJWTRetErrJSONPayloadRCDI, newError(SJWTRetErrJSONPayloadRCDI,
+			fmt.Sprintf("rcdi pointer %s not referencing a URL", ptr))
+	}
+
+	content, ret, err := v.GetURLContent(urlVal)
+	if err != nil {
+		return "", ret, err
+	}
+	h.Write(content)
+
+	return alg + "-" + base64.StdEncoding.EncodeToString(h.Sum(nil)), SJWTRetOK, nil
+}
+
+// rcdURLPointers - return the JSON pointers of the URLs in the rcd claim:
+// icn, jcl, the URIs inside jcd and the URIs inside the jCard referenced by
+// jcl (RFC 8862 section 6), in sorted order
+func (v *Verifier) rcdURLPointers(rcd *SJWTRCD) ([]string, int, error) {
+	var ptrs []string
+	if rcd == nil {
+		return ptrs, SJWTRetOK, nil
+	}
+	doc, _ := rcdJSONDoc(rcd).(map[string]interface{})
+	for _, name := range []string{"icn", "jcl"} {
+		if sVal, ok := doc[name].(string); ok && isRCDURL(sVal) {
+			ptrs = append(ptrs, "/"+name)
+		}
+	}
+	ptrs = appendURLPointers(ptrs, "/jcd", doc["jcd"])
+	if isRCDURL(rcd.Jcl) {
+		jcard, ret, err := v.rcdJCard(rcd)
+		if err != nil {
+			return nil, ret, err
+		}
+		ptrs = appendURLPointers(ptrs, "/jcl", jcard)
+	}
+	sort.Strings(ptrs)
+	return ptrs, SJWTRetOK, nil
+}
+
+// rcdJCard - return the generic JSON representation of the jCard referenced
+// by the jcl URL of the rcd claim
+func (v *Verifier) rcdJCard(rcd *SJWTRCD) (interface{}, int, error) {
+	if !isRCDURL(rcd.Jcl) {
+		return nil, SJWTRetErrJSONPayloadRCDI, newError(SJWTRetErrJSONPayloadRCDI, "no jcl URL in rcd claim")
+	}
+	content, ret, err := v.GetURLContent(rcd.Jcl)
+	if err != nil {
+		return nil, ret, err
+	}
+	var jcard interface{}
+	if err = json.Unmarshal(content, &jcard); err != nil {
+		return nil, SJWTRetErrJSONPayloadRCDI, wrapError(SJWTRetErrJSONPayloadRCDI, "invalid jCard of jcl", err)
+	}
+	return jcard, SJWTRetOK, nil
+}
+
+// appendURLPointers - append the JSON pointers of the URL string values
+// inside val, which is referenced by the pointer ptr
+func appendURLPointers(ptrs []string, ptr string, val interface{}) []string {
+	switch node := val.(type) {
+	case string:
+		if isRCDURL(node) {
+			ptrs = append(ptrs, ptr)
+		}
+	case []interface{}:
+		for i, item := range node {
+			ptrs = appendURLPointers(ptrs, ptr+"/"+strconv.Itoa(i), item)
+		}
+	case map[string]interface{}:
+		for key, item := range node {
+			token := strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+			ptrs = appendURLPointers(ptrs, ptr+"/"+token, item)
+		}
+	}
+	return ptrs
+}
+
+// rcdJSONDoc - return the generic JSON representation of the rcd claim
+func rcdJSONDoc(rcd *SJWTRCD) interface{} {
+	var doc interface{}
+	rcdJSON, _ := json.Marshal(rcd)
+	json.Unmarshal(rcdJSON, &doc)
+	return doc
+}
+
+// isRCDURL - return true if the value is a http or https URL
+func isRCDURL(val string) bool {
+	return strings.HasPrefix(val, "http://") || strings.HasPrefix(val, "https://")
+}
+
+// jsonPointerGet - return the value referenced by the JSON pointer (RFC 6901)
+func jsonPointerGet(doc interface{}, ptr string) (interface{}, bool) {
+	if ptr == "" {
+		return doc, true
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, false
+	}
+	val := doc
+	for _, token := range strings.Split(ptr[1:], "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		switch node := val.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if val, ok = node[token]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, false
+			}
+			val = node[idx]
+		default:
+			return nil, false
+		}
+	}
+	return val, true
+}
+
+// CheckRCDIdentity - implements the verify of the Identity header with a rcd
+// PASSporT, including the rcdi digests, returning its payload; pubkeyPath is
+// the file path or URL of the public key, if empty the value of the info
+// parameter is used
+func (v *Verifier) CheckRCDIdentity(identityVal string, pubkeyPath string) (*SJWTRCDPayload, int, error) {
+	return v.checkRCDIdentity(identityVal, pubkeyPath, 0)
+}
+
+// CheckRCDIdentityPubKey - implements the verify of the Identity header with
+// a rcd PASSporT using the public key value, returning its payload
+func (v *Verifier) CheckRCDIdentityPubKey(identityVal string, pubkeyVal string) (*SJWTRCDPayload, int, error) {
+	return v.checkRCDIdentity(identityVal, pubkeyVal, 1)
+}
+
+func (v *Verifier) checkRCDIdentity(identityVal string, pubkeyVal string, pubkeyMode int) (*SJWTRCDPayload, int, error) {
+	payload := SJWTRCDPayload{}
+
+	if ret, err := v.checkPASSporT(identityVal, pubkeyVal, pubkeyMode, SJWTPptRCD, &payload); err != nil {
+		return nil, ret, err
+	}
+	if ret, err := v.CheckRCD(&payload.RCD, payload.RCDI); err != nil {
+		return nil, ret, err
+	}
+	return &payload, SJWTRetOK, nil
+}
+
+// SJWTCheckRCDIdentity - implements the verify of the Identity header with a
+// rcd PASSporT, returning its payload
+func SJWTCheckRCDIdentity(identityVal string, expireVal int, pubkeyPath string, timeoutVal int) (*SJWTRCDPayload, int, error) {
+	return defaultVerifier(expireVal, timeoutVal).CheckRCDIdentity(identityVal, pubkeyPath)
+}
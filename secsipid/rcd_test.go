@@ -0,0 +1,257 @@
+package secsipid_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestRCDPASSporT(t *testing.T) {
+	keyPath := path.Join(t.TempDir(), "ec256-private.pem")
+	_, pubKey := writeDummyECKey(keyPath)
+
+	logo := []byte("dummy logo content")
+	logoDigest := sha256.Sum256(logo)
+	jcard := []byte(`["vcard",[["version",{},"text","4.0"],["fn",{},"text","Example Company"],` +
+		`["logo",{},"uri","http://localhost:5555/logo.png"]]]`)
+	jcardDigest := sha256.Sum256(jcard)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/jcard.json" {
+			w.Write(jcard)
+			return
+		}
+		w.Write(logo)
+	})
+	stopTestServer := startTestServer(handler)
+	defer stopTestServer()
+
+	signer, _, _ := secsipid.NewSigner(secsipid.SignerOptions{
+		PrvKeyPath: keyPath,
+		X5u:        "https://127.0.0.1/cert.pem",
+	})
+	verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+		Expire:   60,
+		Timeout:  5,
+		CheckRCD: true,
+	})
+	rcd := &secsipid.SJWTRCD{
+		Icn: "http://localhost:5555/logo.png",
+		Nam: "Example Company",
+	}
+
+	t.Run("OK with rcdi digest of the icon", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		rcdi, errCode, _ := verifier.GetRCDI(rcd)
+
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		expect(rcdi).ToEqual(map[string]string{
+			"/icn": "sha256-" + base64.StdEncoding.EncodeToString(logoDigest[:]),
+		})
+	})
+
+	t.Run("OK with rcd claims in shaken PASSporT", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		rcdi, _, _ := verifier.GetRCDI(rcd)
+		identity, errCode, _ := signer.SignOpts(secsipid.SJWTIdentityOptions{
+			OrigTN:  "493055555555",
+			DestTNs: []string{"493044444444"},
+			Attest:  "A",
+			CRN:     "Appointment reminder",
+			RCD:     rcd,
+			RCDI:    rcdi,
+		})
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		expect(strings.HasSuffix(identity, ";ppt=shaken")).ToBe(true)
+
+		res := verifier.CheckFullIdentityPubKeyResult(identity, string(pubKey))
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetOK)
+		expect(res.Payload.CRN).ToBe("Appointment reminder")
+		expect(*res.Payload.RCD).ToEqual(*rcd)
+	})
+
+	t.Run("ErrJSONPayloadRCDI with mismatching digest", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identity, _, _ := signer.SignOpts(secsipid.SJWTIdentityOptions{
+			OrigTN:  "493055555555",
+			DestTNs: []string{"493044444444"},
+			Attest:  "A",
+			RCD:     rcd,
+			RCDI: map[string]string{
+				"/icn": "sha256-" + base64.StdEncoding.EncodeToString(make([]byte, 32)),
+			},
+		})
+
+		errCode, _ := verifier.CheckFullIdentityPubKey(identity, string(pubKey))
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadRCDI)
+	})
+
+	t.Run("OK with rcdi digests of the URIs in the jCard", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		rcdJcd := &secsipid.SJWTRCD{
+			Jcd: []interface{}{"vcard", []interface{}{
+				[]interface{}{"fn", map[string]interface{}{}, "text", "Example Company"},
+				[]interface{}{"logo", map[string]interface{}{}, "uri", "http://localhost:5555/logo.png"},
+			}},
+			Nam: "Example Company",
+		}
+		rcdi, errCode, _ := verifier.GetRCDI(rcdJcd)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		expect(rcdi).ToEqual(map[string]string{
+			"/jcd/1/1/3": "sha256-" + base64.StdEncoding.EncodeToString(logoDigest[:]),
+		})
+
+		identity, _, _ := signer.SignOpts(secsipid.SJWTIdentityOptions{
+			Ppt:     secsipid.SJWTPptRCD,
+			OrigTN:  "493055555555",
+			DestTNs: []string{"493044444444"},
+			RCD:     rcdJcd,
+			RCDI:    rcdi,
+		})
+		_, errCode, _ = verifier.CheckRCDIdentityPubKey(identity, string(pubKey))
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("OK with rcdi digests of the URIs in the jCard of jcl", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		rcdJcl := &secsipid.SJWTRCD{
+			Jcl: "http://localhost:5555/jcard.json",
+			Nam: "Example Company",
+		}
+		rcdi, errCode, _ := verifier.GetRCDI(rcdJcl)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		expect(rcdi).ToEqual(map[string]string{
+			"/jcl":       "sha256-" + base64.StdEncoding.EncodeToString(jcardDigest[:]),
+			"/jcl/1/2/3": "sha256-" + base64.StdEncoding.EncodeToString(logoDigest[:]),
+		})
+
+		identity, _, _ := signer.SignOpts(secsipid.SJWTIdentityOptions{
+			Ppt:     secsipid.SJWTPptRCD,
+			OrigTN:  "493055555555",
+			DestTNs: []string{"493044444444"},
+			RCD:     rcdJcl,
+			RCDI:    rcdi,
+		})
+		_, errCode, _ = verifier.CheckRCDIdentityPubKey(identity, string(pubKey))
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+
+		delete(rcdi, "/jcl/1/2/3")
+		errCode, err := verifier.CheckRCD(rcdJcl, rcdi)
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadRCDI)
+		expect(getMsgFromErr(err)).ToBe("missing digest for /jcl/1/2/3")
+	})
+
+	t.Run("ErrJSONPayloadRCDI with CheckRCD library option", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identity, _, _ := signer.SignOpts(secsipid.SJWTIdentityOptions{
+			OrigTN:  "493055555555",
+			DestTNs: []string{"493044444444"},
+			Attest:  "A",
+			RCD:     rcd,
+		})
+
+		// the public key is not a certificate
+		secsipid.SJWTLibOptSetN("CertVerify", 0)
+		errCode, _ := secsipid.SJWTCheckFullIdentityPubKey(identity, 60, string(pubKey))
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+
+		secsipid.SJWTLibOptSetN("CheckRCD", 1)
+		defer secsipid.SJWTLibOptSetN("CheckRCD", 0)
+		errCode, _ = secsipid.SJWTCheckFullIdentityPubKey(identity, 60, string(pubKey))
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadRCDI)
+	})
+
+	t.Run("OK with inline jCard without rcdi", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		errCode, _ := verifier.CheckRCD(&secsipid.SJWTRCD{
+			Jcd: []interface{}{"vcard", []interface{}{
+				[]interface{}{"fn", map[string]interface{}{}, "text", "Example Company"},
+			}},
+			Nam: "Example Company",
+		}, nil)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("ErrJSONPayloadRCDI without rcdi for the icon URL", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identity, _, _ := signer.SignOpts(secsipid.SJWTIdentityOptions{
+			OrigTN:  "493055555555",
+			DestTNs: []string{"493044444444"},
+			Attest:  "A",
+			RCD:     rcd,
+		})
+
+		errCode, err := verifier.CheckFullIdentityPubKey(identity, string(pubKey))
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadRCDI)
+		expect(getMsgFromErr(err)).ToBe("missing digest for /icn")
+	})
+
+	t.Run("ErrJSONPayloadRCDI with rcdi for inline value", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		rcdi, _, _ := verifier.GetRCDI(rcd)
+		rcdi["/nam"] = rcdi["/icn"]
+
+		errCode, err := verifier.CheckRCD(rcd, rcdi)
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadRCDI)
+		expect(getMsgFromErr(err)).ToBe("rcdi pointer /nam not referencing a URL")
+	})
+
+	t.Run("OK with rcd PASSporT", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		rcdi, _, _ := verifier.GetRCDI(rcd)
+		identity, errCode, _ := signer.SignOpts(secsipid.SJWTIdentityOptions{
+			Ppt:     secsipid.SJWTPptRCD,
+			OrigTN:  "493055555555",
+			DestTNs: []string{"493044444444"},
+			RCD:     rcd,
+			RCDI:    rcdi,
+		})
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		expect(strings.HasSuffix(identity, ";ppt=rcd")).ToBe(true)
+
+		payload, errCode, _ := verifier.CheckRCDIdentityPubKey(identity, string(pubKey))
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		expect(payload.RCD.Nam).ToBe("Example Company")
+		expect(payload.Orig.TN).ToBe("493055555555")
+	})
+
+	t.Run("ErrJSONPayloadRCD with rcd PASSporT without nam", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identity, _, _ := signer.SignOpts(secsipid.SJWTIdentityOptions{
+			Ppt:     secsipid.SJWTPptRCD,
+			OrigTN:  "493055555555",
+			DestTNs: []string{"493044444444"},
+			RCD:     &secsipid.SJWTRCD{Icn: "http://localhost:5555/logo.png"},
+		})
+
+		_, errCode, _ := verifier.CheckRCDIdentityPubKey(identity, string(pubKey))
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadRCD)
+	})
+
+	t.Run("ErrJSONPayloadRCD when signing rcd PASSporT without rcd claim", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, errCode, _ := signer.SignOpts(secsipid.SJWTIdentityOptions{
+			Ppt:     secsipid.SJWTPptRCD,
+			OrigTN:  "493055555555",
+			DestTNs: []string{"493044444444"},
+		})
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadRCD)
+	})
+}
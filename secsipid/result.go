@@ -0,0 +1,172 @@
+package secsipid
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// VerificationResult - details collected while checking an Identity header
+type VerificationResult struct {
+	// JSON header of the PASSporT (nil if it could not be decoded)
+	Header *SJWTHeader
+	// payload of the PASSporT (nil if it could not be decoded)
+	Payload *SJWTPayload
+	// value of the info header parameter (location of the certificate)
+	Info string
+	// subject of the signing certificate
+	CertSubject string
+	// certificate chain, starting with the signing certificate
+	Chain []*x509.Certificate
+	// TNAuthList extension of the signing certificate (nil if it has none)
+	TNAuthList *TNAuthList
+	// service provider code from the TNAuthList of the signing certificate
+	SPC string
+	// attestation level from the payload
+	Attest string
+	// checks of the claims against the SIP request (nil if not done)
+	SIP *SIPCheckResult
+	// SJWTRet* code of the verification (SJWTRetOK on success)
+	ErrCode int
+	// error of the verification (it may be nil for some failure codes)
+	Err error
+	// duration of the verification
+	Elapsed time.Duration
+}
+
+// verificationResultJSON - JSON representation of VerificationResult
+type verificationResultJSON struct {
+	Header      *SJWTHeader     `json:"header,omitempty"`
+	Payload     *SJWTPayload    `json:"payload,omitempty"`
+	Info        string          `json:"info,omitempty"`
+	CertSubject string          `json:"certSubject,omitempty"`
+	Chain       []string        `json:"chain,omitempty"`
+	TNAuthList  *TNAuthList     `json:"tnAuthList,omitempty"`
+	SPC         string          `json:"spc,omitempty"`
+	Attest      string          `json:"attest,omitempty"`
+	SIP         *SIPCheckResult `json:"sip,omitempty"`
+	Verstat     string          `json:"verstat"`
+	ErrCode     int             `json:"errCode"`
+	ErrMsg      string          `json:"errMsg,omitempty"`
+	ElapsedUs   int64           `json:"elapsedUs"`
+}
+
+// OK - return true if the verification was successful
+func (r *VerificationResult) OK() bool {
+	return r.ErrCode == SJWTRetOK
+}
+
+// ChainSubjects - return the subjects of the certificates in the chain
+func (r *VerificationResult) ChainSubjects() []string {
+	var subjects []string
+	for _, cert := range r.Chain {
+		subjects = append(subjects, cert.Subject.String())
+	}
+	return subjects
+}
+
+// MarshalJSON - serialize the result, with chain subjects and error message
+func (r *VerificationResult) MarshalJSON() ([]byte, error) {
+	jr := verificationResultJSON{
+		Header:      r.Header,
+		Payload:     r.Payload,
+		Info:        r.Info,
+		CertSubject: r.CertSubject,
+		Chain:       r.ChainSubjects(),
+		TNAuthList:  r.TNAuthList,
+		SPC:         r.SPC,
+		Attest:      r.Attest,
+		SIP:         r.SIP,
+		Verstat:     r.Verstat(),
+		ErrCode:     r.ErrCode,
+		ElapsedUs:   r.Elapsed.Microseconds(),
+	}
+	if r.Err != nil {
+		jr.ErrMsg = r.Err.Error()
+	}
+	return json.Marshal(jr)
+}
+
+// String - return the result in text format, one attribute per line
+func (r *VerificationResult) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "errcode: %d\n", r.ErrCode)
+	if r.Err != nil {
+		fmt.Fprintf(&sb, "errmsg: %v\n", r.Err)
+	}
+	if r.Header != nil {
+		fmt.Fprintf(&sb, "alg: %s\n", r.Header.Alg)
+		fmt.Fprintf(&sb, "ppt: %s\n", r.Header.Ppt)
+		fmt.Fprintf(&sb, "typ: %s\n", r.Header.Typ)
+		fmt.Fprintf(&sb, "x5u: %s\n", r.Header.X5u)
+	}
+	if r.Payload != nil {
+		fmt.Fprintf(&sb, "attest: %s\n", r.Payload.ATTest)
+		fmt.Fprintf(&sb, "orig: %s\n", r.Payload.Orig.TN)
+		fmt.Fprintf(&sb, "dest: %s\n", strings.Join(r.Payload.Dest.TN, ","))
+		if len(r.Payload.Orig.URI) > 0 {
+			fmt.Fprintf(&sb, "orig-uri: %s\n", r.Payload.Orig.URI)
+		}
+		if len(r.Payload.Dest.URI) > 0 {
+			fmt.Fprintf(&sb, "dest-uri: %s\n", strings.Join(r.Payload.Dest.URI, ","))
+		}
+		fmt.Fprintf(&sb, "iat: %d\n", r.Payload.IAT)
+		fmt.Fprintf(&sb, "origid: %s\n", r.Payload.OrigID)
+		if len(r.Payload.CRN) > 0 {
+			fmt.Fprintf(&sb, "crn: %s\n", r.Payload.CRN)
+		}
+		if r.Payload.RCD != nil {
+			fmt.Fprintf(&sb, "rcd-nam: %s\n", r.Payload.RCD.Nam)
+		}
+	}
+	if len(r.Info) > 0 {
+		fmt.Fprintf(&sb, "info: %s\n", r.Info)
+	}
+	if len(r.CertSubject) > 0 {
+		fmt.Fprintf(&sb, "cert-subject: %s\n", r.CertSubject)
+	}
+	if len(r.SPC) > 0 {
+		fmt.Fprintf(&sb, "spc: %s\n", r.SPC)
+	}
+	for i, subject := range r.ChainSubjects() {
+		fmt.Fprintf(&sb, "chain[%d]: %s\n", i, subject)
+	}
+	if r.SIP != nil {
+		for _, check := range []struct {
+			name  string
+			check SIPClaimCheck
+		}{{"orig", r.SIP.Orig}, {"dest", r.SIP.Dest}, {"date", r.SIP.Date}} {
+			fmt.Fprintf(&sb, "sip-%s: %s\n", check.name, check.check.status())
+		}
+	}
+	fmt.Fprintf(&sb, "verstat: %s\n", r.Verstat())
+	fmt.Fprintf(&sb, "elapsed: %v\n", r.Elapsed)
+
+	return sb.String()
+}
+
+// setPayload - store the payload and the attributes derived from it
+func (r *VerificationResult) setPayload(payload *SJWTPayload) {
+	if payload == nil {
+		return
+	}
+	r.Payload = payload
+	r.Attest = payload.ATTest
+}
+
+// setCertificates - store the signing certificate and the chain
+func (r *VerificationResult) setCertificates(certVal *x509.Certificate, certChain []*x509.Certificate) {
+	if certVal == nil {
+		return
+	}
+	r.CertSubject = certVal.Subject.String()
+	r.Chain = certChain
+	// best effort, the extension is checked with the CertVerify mode
+	if tnAuthList, _, err := SJWTGetTNAuthList(certVal); err == nil && tnAuthList != nil {
+		r.TNAuthList = tnAuthList
+		r.SPC = tnAuthList.SPC()
+	}
+}
@@ -0,0 +1,74 @@
+package secsipid_test
+
+import (
+	"encoding/json"
+	"path"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestCheckFullIdentityResult(t *testing.T) {
+	keyPath := path.Join(t.TempDir(), "ec256-private.pem")
+	_, pubKey := writeDummyECKey(keyPath)
+	_, otherPubKey := writeDummyECKey(path.Join(t.TempDir(), "ec256-other.pem"))
+
+	signer, _, _ := secsipid.NewSigner(secsipid.SignerOptions{
+		PrvKeyPath: keyPath,
+		X5u:        "https://127.0.0.1/cert.pem",
+	})
+	identity, _, _ := signer.Sign("493055555555", []string{"493044444444"}, "A", "origid-1")
+
+	verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+		Expire: 60,
+	})
+
+	t.Run("OK with details of the identity", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		res := verifier.CheckFullIdentityPubKeyResult(identity, string(pubKey))
+
+		expect(res.OK()).ToBe(true)
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetOK)
+		expect(res.Err).ToBe(nil)
+		expect(res.Attest).ToBe("A")
+		expect(res.Info).ToBe("https://127.0.0.1/cert.pem")
+		expect(*res.Header).ToEqual(secsipid.SJWTHeader{
+			Alg: "ES256",
+			Ppt: "shaken",
+			Typ: "passport",
+			X5u: "https://127.0.0.1/cert.pem",
+		})
+		expect(res.Payload.Orig.TN).ToBe("493055555555")
+		expect(res.Payload.Dest.TN).ToEqual([]string{"493044444444"})
+		expect(res.Payload.OrigID).ToBe("origid-1")
+		expect(res.Elapsed > 0).ToBe(true)
+	})
+
+	t.Run("ErrJSONSignatureInvalid keeps the decoded payload", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		res := verifier.CheckFullIdentityPubKeyResult(identity, string(otherPubKey))
+
+		expect(res.OK()).ToBe(false)
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetErrJSONSignatureInvalid)
+		expect(res.Payload.OrigID).ToBe("origid-1")
+		expect(res.Attest).ToBe("A")
+	})
+
+	t.Run("JSON serialization of the result", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		res := verifier.CheckFullIdentityPubKeyResult(identity, string(otherPubKey))
+
+		jsonResult, _ := json.Marshal(res)
+		decoded := map[string]interface{}{}
+		json.Unmarshal(jsonResult, &decoded)
+
+		expect(decoded["errCode"]).ToBe(float64(secsipid.SJWTRetErrJSONSignatureInvalid))
+		expect(decoded["errMsg"]).ToBe("failed to verify - origid (origid-1): ECDSA verification failed")
+		expect(decoded["attest"]).ToBe("A")
+		expect(decoded["verstat"]).ToBe(secsipid.SJWTVerstatFailed)
+	})
+}
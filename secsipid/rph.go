@@ -0,0 +1,128 @@
+package secsipid
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SJWTRPH - resource priority of the rph claim (RFC 8443)
+type SJWTRPH struct {
+	Auth []string `json:"auth"`
+}
+
+// SJWTRPHPayload - payload of rph PASSporT (RFC 8443)
+type SJWTRPHPayload struct {
+	Dest SJWTDest `json:"dest"`
+	IAT  int64    `json:"iat"`
+	Orig SJWTOrig `json:"orig"`
+	RPH  SJWTRPH  `json:"rph"`
+	// members not known by the library, preserved when decoding and encoding
+	Extra map[string]interface{} `json:"-"`
+}
+
+// SJWTParseResourcePriority - return the values of the Resource-Priority
+// header (e.g., "ets.0, wps.0")
+func SJWTParseResourcePriority(hdrVal string) []string {
+	var rpList []string
+	for _, rpVal := range strings.Split(hdrVal, ",") {
+		rpVal = strings.TrimSpace(rpVal)
+		if len(rpVal) > 0 {
+			rpList = append(rpList, rpVal)
+		}
+	}
+	return rpList
+}
+
+// SignRPH - return the Identity header value of a rph PASSporT for the call,
+// with the values of the Resource-Priority header
+func (s *Signer) SignRPH(origTN string, destTNs []string, resourcePriority string) (string, int, error) {
+	return s.SignOpts(SJWTIdentityOptions{
+		Ppt:     SJWTPptRPH,
+		OrigTN:  origTN,
+		DestTNs: destTNs,
+		RPH:     SJWTParseResourcePriority(resourcePriority),
+	})
+}
+
+// SJWTGetRPHIdentity - build the Identity header value of a rph PASSporT with
+// the values of the Resource-Priority header and the private key from the file
+func SJWTGetRPHIdentity(origTN string, destTN string, resourcePriority string, x5uVal string, prvkeyPath string) (string, int, error) {
+	return SJWTGetIdentityOpts(SJWTIdentityOptions{
+		Ppt:     SJWTPptRPH,
+		OrigTN:  origTN,
+		DestTNs: []string{destTN},
+		X5u:     x5uVal,
+		RPH:     SJWTParseResourcePriority(resourcePriority),
+	}, prvkeyPath)
+}
+
+// SJWTGetRPHIdentityPrvKey - build the Identity header value of a rph PASSporT
+// with the values of the Resource-Priority header and the content of the
+// private key
+func SJWTGetRPHIdentityPrvKey(origTN string, destTN string, resourcePriority string, x5uVal string, prvkeyData []byte) (string, int, error) {
+	return SJWTGetIdentityPrvKeyOpts(SJWTIdentityOptions{
+		Ppt:     SJWTPptRPH,
+		OrigTN:  origTN,
+		DestTNs: []string{destTN},
+		X5u:     x5uVal,
+		RPH:     SJWTParseResourcePriority(resourcePriority),
+	}, prvkeyData)
+}
+
+// CheckRPHIdentity - implements the verify of the Identity header with a rph
+// PASSporT, returning its payload; each value of the Resource-Priority header
+// must be authorized by the rph claim; pubkeyPath is the file path or URL of
+// the public key, if empty the value of the info parameter is used
+func (v *Verifier) CheckRPHIdentity(identityVal string, pubkeyPath string, resourcePriority string) (*SJWTRPHPayload, int, error) {
+	return v.checkRPHIdentity(identityVal, pubkeyPath, 0, resourcePriority)
+}
+
+// CheckRPHIdentityPubKey - implements the verify of the Identity header with
+// a rph PASSporT using the public key value, returning its payload
+func (v *Verifier) CheckRPHIdentityPubKey(identityVal string, pubkeyVal string, resourcePriority string) (*SJWTRPHPayload, int, error) {
+	return v.checkRPHIdentity(identityVal, pubkeyVal, 1, resourcePriority)
+}
+
+func (v *Verifier) checkRPHIdentity(identityVal string, pubkeyVal string, pubkeyMode int, resourcePriority string) (*SJWTRPHPayload, int, error) {
+	payload := SJWTRPHPayload{}
+
+	if ret, err := v.checkPASSporT(identityVal, pubkeyVal, pubkeyMode, SJWTPptRPH, &payload); err != nil {
+		return nil, ret, err
+	}
+	if ret, err := SJWTCheckRPH(&payload.RPH, resourcePriority); err != nil {
+		return nil, ret, err
+	}
+	return &payload, SJWTRetOK, nil
+}
+
+// SJWTCheckRPHIdentity - implements the verify of the Identity header with a
+// rph PASSporT, returning its payload
+func SJWTCheckRPHIdentity(identityVal string, expireVal int, pubkeyPath string, timeoutVal int, resourcePriority string) (*SJWTRPHPayload, int, error) {
+	return defaultVerifier(expireVal, timeoutVal).CheckRPHIdentity(identityVal, pubkeyPath, resourcePriority)
+}
+
+// SJWTCheckRPH - check that the values of the Resource-Priority header are
+// authorized by the rph claim (the comparison is case insensitive)
+func SJWTCheckRPH(rph *SJWTRPH, resourcePriority string) (int, error) {
+	if rph == nil || len(rph.Auth) == 0 {
+		return SJWTRetErrJSONPayloadRPH, newError(SJWTRetErrJSONPayloadRPH, "missing rph claim")
+	}
+	rpList := SJWTParseResourcePriority(resourcePriority)
+	if len(rpList) == 0 {
+		return SJWTRetErrJSONPayloadRPH, newError(SJWTRetErrJSONPayloadRPH, "empty Resource-Priority header")
+	}
+	for _, rpVal := range rpList {
+		found := false
+		for _, authVal := range rph.Auth {
+			if strings.EqualFold(rpVal, strings.TrimSpace(authVal)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return SJWTRetErrJSONPayloadRPH, newError(SJWTRetErrJSONPayloadRPH,
+				fmt.Sprintf("Resource-Priority value not in rph claim (%s)", rpVal))
+		}
+	}
+	return SJWTRetOK, nil
+}
@@ -0,0 +1,61 @@
+package secsipid_test
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestRPHPASSporT(t *testing.T) {
+	keyPath := path.Join(t.TempDir(), "ec256-private.pem")
+	_, pubKey := writeDummyECKey(keyPath)
+
+	signer, _, _ := secsipid.NewSigner(secsipid.SignerOptions{
+		PrvKeyPath: keyPath,
+		X5u:        "https://127.0.0.1/cert.pem",
+	})
+	verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+		Expire: 60,
+	})
+
+	identity, errCode, _ := signer.SignRPH("493055555555", []string{"493044444444"}, "ets.0, wps.0")
+	if errCode != secsipid.SJWTRetOK {
+		t.Fatalf("failed to sign rph PASSporT: %d", errCode)
+	}
+
+	t.Run("OK with matching Resource-Priority header", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(strings.HasSuffix(identity, ";ppt=rph")).ToBe(true)
+
+		payload, errCode, _ := verifier.CheckRPHIdentityPubKey(identity, string(pubKey), "wps.0")
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		expect(payload.RPH.Auth).ToEqual([]string{"ets.0", "wps.0"})
+	})
+
+	t.Run("ErrJSONPayloadRPH with not authorized Resource-Priority value", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, errCode, _ := verifier.CheckRPHIdentityPubKey(identity, string(pubKey), "ets.0,dsn.flash")
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadRPH)
+	})
+
+	t.Run("ErrJSONPayloadRPH with empty Resource-Priority header", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, errCode, _ := verifier.CheckRPHIdentityPubKey(identity, string(pubKey), "")
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadRPH)
+	})
+
+	t.Run("ErrSIPHdrPpt with shaken PASSporT", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		shakenIdentity, _, _ := signer.Sign("493055555555", []string{"493044444444"}, "A", "")
+
+		_, errCode, _ := verifier.CheckRPHIdentityPubKey(shakenIdentity, string(pubKey), "ets.0")
+		expect(errCode).ToBe(secsipid.SJWTRetErrSIPHdrPpt)
+	})
+}
@@ -5,19 +5,14 @@ import (
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/x509"
-	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
-	"errors"
 	"fmt"
-	"io/ioutil"
 	"math/big"
-	"net/http"
-	"net/url"
-	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
@@ -43,9 +38,21 @@ const (
 	SJWTRetErrCertReadCRLFile     = -111
 	SJWTRetErrCertRevoked         = -112
 	SJWTRetErrCertInvalidEC       = -114
+	SJWTRetErrCertTNAuthList      = -115
+	SJWTRetErrCertTNNotAuthorized = -116
+	SJWTRetErrCertDelegateScope   = -117
+	SJWTRetErrCertProfilePolicy   = -118
+	SJWTRetErrCertProfileKeyUsage = -119
+	SJWTRetErrCertProfileKey      = -120
+	SJWTRetErrCertProfileCRLDP    = -121
+	SJWTRetErrCertProfileSubject  = -122
+	SJWTRetErrCertCRLDP           = -123
+	SJWTRetErrCertCRLParse        = -124
+	SJWTRetErrCertCRLSignature    = -125
+	SJWTRetErrCertCRLStale        = -126
 	SJWTRetErrPrvKeyInvalid       = -151
 	SJWTRetErrPrvKeyInvalidFormat = -152
-	SJWTRetErrPrvKeyInvalidEC     = -152
+	SJWTRetErrPrvKeyInvalidEC     = -153
 	// identity JSON header, payload and signature errors: -200..-299
 	SJWTRetErrJSONHdrParse          = -201
 	SJWTRetErrJSONHdrAlg            = -202
@@ -54,16 +61,27 @@ const (
 	SJWTRetErrJSONHdrX5u            = -205
 	SJWTRetErrJSONPayloadParse      = -231
 	SJWTRetErrJSONPayloadIATExpired = -232
+	SJWTRetErrJSONPayloadDiv        = -233
+	SJWTRetErrJSONPayloadDivChain   = -234
+	SJWTRetErrJSONPayloadRCD        = -235
+	SJWTRetErrJSONPayloadRCDI       = -236
+	SJWTRetErrJSONPayloadRPH        = -237
+	SJWTRetErrJSONPayloadOrig       = -238
+	SJWTRetErrJSONPayloadDest       = -239
+	SJWTRetErrJSONPayloadDate       = -240
+	SJWTRetErrJSONPayloadIATFuture  = -241
 	SJWTRetErrJSONSignatureInvalid  = -251
 	SJWTRetErrJSONSignatureHashing  = -252
 	SJWTRetErrJSONSignatureSize     = -253
 	SJWTRetErrJSONSignatureFailure  = -254
 	// identity SIP header errors: -300..-399
-	SJWTRetErrSIPHdrParse = -301
-	SJWTRetErrSIPHdrAlg   = -302
-	SJWTRetErrSIPHdrPpt   = -303
-	SJWTRetErrSIPHdrInfo  = -303
-	SJWTRetErrSIPHdrEmpty = -304
+	SJWTRetErrSIPHdrParse  = -301
+	SJWTRetErrSIPHdrAlg    = -302
+	SJWTRetErrSIPHdrPpt    = -303
+	SJWTRetErrSIPHdrEmpty  = -304
+	SJWTRetErrSIPHdrInfo   = -305
+	SJWTRetErrSIPMsgParse  = -306
+	SJWTRetErrSIPHdrPolicy = -307
 	// http and file operations errors: -400..-499
 	SJWTRetErrHTTPInvalidURL = -401
 	SJWTRetErrHTTPGet        = -402
@@ -72,31 +90,80 @@ const (
 	SJWTRetErrFileRead       = -451
 )
 
+// bit flags of the certificate verification mode (CertVerify)
+const (
+	// verify the time validity
+	SJWTCertVerifyTime = 1 << 0
+	// verify against the system root CAs
+	SJWTCertVerifySystemCAs = 1 << 1
+	// verify against the custom root CAs
+	SJWTCertVerifyCAFile = 1 << 2
+	// verify against the custom intermediate CAs
+	SJWTCertVerifyCAInter = 1 << 3
+	// verify against the certificate revocation lists
+	SJWTCertVerifyCRL = 1 << 4
+	// require the TNAuthList extension with at least one entry
+	SJWTCertVerifyTNAuthList = 1 << 5
+	// verify the SHAKEN certificate profile (ATIS-1000080)
+	SJWTCertVerifyProfile = 1 << 6
+	// verify against the CRLs of the CRL distribution points
+	SJWTCertVerifyCRLDP = 1 << 7
+)
+
+// PASSporT extension types (ppt)
+const (
+	SJWTPptShaken = "shaken"
+	SJWTPptDiv    = "div"
+	SJWTPptRCD    = "rcd"
+	SJWTPptRPH    = "rph"
+)
+
+// defaults for the freshness window of the iat claim, in seconds
+const (
+	// SJWTIATMaxAgeDefault - maximum age of iat when no expire value is set
+	SJWTIATMaxAgeDefault = 60
+	// SJWTIATFutureSkewDefault - tolerated clock skew for iat in the future
+	SJWTIATFutureSkewDefault = 60
+)
+
 // SJWTHeader - header for JWT
 type SJWTHeader struct {
 	Alg string `json:"alg"`
 	Ppt string `json:"ppt"`
 	Typ string `json:"typ"`
 	X5u string `json:"x5u"`
+	// members not known by the library, preserved when decoding and encoding
+	Extra map[string]interface{} `json:"-"`
 }
 
 // SJWTDest --
 type SJWTDest struct {
-	TN []string `json:"tn"`
+	TN  []string `json:"tn"`
+	URI []string `json:"uri,omitempty"`
+	// members not known by the library, preserved when decoding and encoding
+	Extra map[string]interface{} `json:"-"`
 }
 
 // SJWTOrig --
 type SJWTOrig struct {
-	TN string `json:"tn"`
+	TN  string `json:"tn"`
+	URI string `json:"uri,omitempty"`
+	// members not known by the library, preserved when decoding and encoding
+	Extra map[string]interface{} `json:"-"`
 }
 
 // SJWTPayload - JWT payload
 type SJWTPayload struct {
-	ATTest string   `json:"attest"`
-	Dest   SJWTDest `json:"dest"`
-	IAT    int64    `json:"iat"`
-	Orig   SJWTOrig `json:"orig"`
-	OrigID string   `json:"origid"`
+	ATTest string            `json:"attest"`
+	CRN    string            `json:"crn,omitempty"`
+	Dest   SJWTDest          `json:"dest"`
+	IAT    int64             `json:"iat"`
+	Orig   SJWTOrig          `json:"orig"`
+	OrigID string            `json:"origid"`
+	RCD    *SJWTRCD          `json:"rcd,omitempty"`
+	RCDI   map[string]string `json:"rcdi,omitempty"`
+	// members not known by the library, preserved when decoding and encoding
+	Extra map[string]interface{} `json:"-"`
 }
 
 type SJWTLibOptions struct {
@@ -107,7 +174,22 @@ type SJWTLibOptions struct {
 	certCRLFile  string
 	certVerify   int
 	x5u          string
-}
+	// canonicalize telephone numbers when signing and verifying (0 - no)
+	tnCanonicalize int
+	// country code for canonicalization of national telephone numbers
+	tnCountryCode string
+	// number of seconds iat can be in the future (negative - default)
+	iatFutureSkew int
+	// verify the certificate validity at the time of iat (0 - no)
+	certTimeIAT int
+	// number of seconds a CRL is accepted after its next update
+	crlGrace int
+	// check the rcd claim and the rcdi digests of shaken PASSporTs (0 - no)
+	checkRCD int
+}
+
+// globalLibOptionsMu - protects globalLibOptions against concurrent updates
+var globalLibOptionsMu sync.RWMutex
 
 var globalLibOptions = SJWTLibOptions{
 	cacheDirPath: "",
@@ -117,6 +199,14 @@ var globalLibOptions = SJWTLibOptions{
 	certCRLFile:  "",
 	certVerify:   0,
 	x5u:          "https://127.0.0.1/cert.pem",
+
+	tnCanonicalize: 0,
+	tnCountryCode:  "",
+
+	iatFutureSkew: -1,
+	certTimeIAT:   0,
+	crlGrace:      0,
+	checkRCD:      0,
 }
 
 var (
@@ -126,12 +216,16 @@ var (
 
 // SetFileCacheOptions --
 func SetURLFileCacheOptions(path string, expire int) {
+	globalLibOptionsMu.Lock()
+	defer globalLibOptionsMu.Unlock()
 	globalLibOptions.cacheDirPath = path
 	globalLibOptions.cacheExpire = expire
 }
 
 // SJWTLibOptSetS --
 func SJWTLibOptSetS(optname string, optval string) int {
+	globalLibOptionsMu.Lock()
+	defer globalLibOptionsMu.Unlock()
 	switch optname {
 	case "CacheDirPath":
 		globalLibOptions.cacheDirPath = optval
@@ -148,12 +242,17 @@ func SJWTLibOptSetS(optname string, optval string) int {
 	case "x5u":
 		globalLibOptions.x5u = optval
 		return SJWTRetOK
+	case "TNCountryCode":
+		globalLibOptions.tnCountryCode = optval
+		return SJWTRetOK
 	}
 	return SJWTRetErr
 }
 
 // SJWTLibOptSetN --
 func SJWTLibOptSetN(optname string, optval int) int {
+	globalLibOptionsMu.Lock()
+	defer globalLibOptionsMu.Unlock()
 	switch optname {
 	case "CacheExpires":
 		globalLibOptions.cacheExpire = optval
@@ -161,6 +260,21 @@ func SJWTLibOptSetN(optname string, optval int) int {
 	case "CertVerify":
 		globalLibOptions.certVerify = optval
 		return SJWTRetOK
+	case "TNCanonicalize":
+		globalLibOptions.tnCanonicalize = optval
+		return SJWTRetOK
+	case "IATFutureSkew":
+		globalLibOptions.iatFutureSkew = optval
+		return SJWTRetOK
+	case "CertTimeIAT":
+		globalLibOptions.certTimeIAT = optval
+		return SJWTRetOK
+	case "CRLGrace":
+		globalLibOptions.crlGrace = optval
+		return SJWTRetOK
+	case "CheckRCD":
+		globalLibOptions.checkRCD = optval
+		return SJWTRetOK
 	}
 	return SJWTRetErr
 }
@@ -171,10 +285,10 @@ func SJWTLibOptSetV(optnameval string) int {
 	optName := optArray[0]
 	optVal := optArray[1]
 	switch optName {
-	case "CacheExpires", "CertVerify":
+	case "CacheExpires", "CertVerify", "TNCanonicalize", "IATFutureSkew", "CertTimeIAT", "CRLGrace", "CheckRCD":
 		intVal, _ := strconv.Atoi(optVal)
 		return SJWTLibOptSetN(optName, intVal)
-	case "CacheDirPath", "CertCAFile", "CertCAInter", "CertCRLFile":
+	case "CacheDirPath", "CertCAFile", "CertCAInter", "CertCRLFile", "TNCountryCode":
 		return SJWTLibOptSetS(optName, optVal)
 	}
 	return SJWTRetErr
@@ -191,165 +305,14 @@ func SJWTRemoveWhiteSpaces(s string) string {
 	return string(rout)
 }
 
-// SJWTRemoveWhiteSpaces --
+// SJWTGetURLCacheFilePath --
 func SJWTGetURLCacheFilePath(urlVal string) string {
-	filePath := strings.Replace(urlVal, "://", "_", -1)
-	filePath = strings.Replace(filePath, "/", "_", -1)
-	if len(globalLibOptions.cacheDirPath) > 0 {
-		filePath = globalLibOptions.cacheDirPath + "/" + filePath
-	}
-	return filePath
+	return defaultVerifier(0, 0).GetURLCacheFilePath(urlVal)
 }
 
 // SJWTPubKeyVerify -
 func SJWTPubKeyVerify(pubKey []byte) (int, error) {
-	if globalLibOptions.certVerify == 0 {
-		return SJWTRetOK, nil
-	}
-
-	var certVal *x509.Certificate
-	var certInter []*x509.Certificate
-	var rootCAs *x509.CertPool
-	var interCAs *x509.CertPool
-	var err error
-
-	// The public key may contain multiple intermediate certificates, we must
-	// parse those out and include them when doing the actual validation.
-	var toDecode = pubKey
-	var block *pem.Block
-	for true {
-		// Decode the next block in the public key. If there are no more blocks then
-		// this will return nil.
-		block, toDecode = pem.Decode(toDecode)
-		if block == nil {
-			break
-		}
-
-		// Parse the block as an x509 certificate.
-		blockCert, err := x509.ParseCertificate(block.Bytes)
-		if blockCert == nil {
-			return SJWTRetErrCertInvalidFormat, err
-		}
-
-		// If this was the first block then it represents the public certificate,
-		// otherwise it is an intermediate certificate.
-		if certVal == nil {
-			certVal = blockCert
-		} else {
-			certInter = append(certInter, blockCert)
-		}
-	}
-
-	if certVal == nil {
-		return SJWTRetErrCertInvalidFormat, errors.New("failed to parse certificate PEM")
-	}
-
-	if (globalLibOptions.certVerify & (1 << 0)) != 0 {
-		if !time.Now().Before(certVal.NotAfter) {
-			return SJWTRetErrCertExpired, errors.New("certificate expired")
-		} else if !time.Now().After(certVal.NotBefore) {
-			return SJWTRetErrCertBeforeValidity, errors.New("certificate not valid yet")
-		}
-	}
-
-	rootCAs = nil
-	interCAs = nil
-	if (globalLibOptions.certVerify & (1 << 1)) != 0 {
-		// Get the SystemCertPool
-		rootCAs, err = SystemCertPool()
-		if rootCAs == nil {
-			return SJWTRetErrCertProcessing, err
-		}
-	}
-	if (globalLibOptions.certVerify & (1 << 2)) != 0 {
-		if len(globalLibOptions.certCAFile) <= 0 {
-			return SJWTRetErrCertNoCAFile, errors.New("no CA file")
-		}
-
-		if rootCAs == nil {
-			rootCAs = x509.NewCertPool()
-			if rootCAs == nil {
-				return SJWTRetErrCertProcessing, errors.New("no new ca cert pool")
-			}
-		}
-		var certsCA []byte
-		// Read in the cert file
-		certsCA, err = ioutil.ReadFile(globalLibOptions.certCAFile)
-		if err != nil {
-			return SJWTRetErrCertReadCAFile, errors.New("failed to read CA file")
-		}
-
-		// Append our cert to the system pool
-		if ok := rootCAs.AppendCertsFromPEM(certsCA); !ok {
-			return SJWTRetErrCertProcessing, errors.New("failed to append CA file")
-		}
-	}
-	if (globalLibOptions.certVerify & (1 << 3)) != 0 {
-		if len(globalLibOptions.certCAInter) <= 0 {
-			return SJWTRetErrCertNoCAInter, errors.New("no intermediate CA file")
-		}
-		interCAs = x509.NewCertPool()
-		if interCAs == nil {
-			return SJWTRetErrCertProcessing, errors.New("no new ca intermediate cert pool")
-		}
-		var certsCA []byte
-		// Read in the cert file
-		certsCA, err = ioutil.ReadFile(globalLibOptions.certCAInter)
-		if err != nil {
-			return SJWTRetErrCertReadCAInter, errors.New("failed to read intermediate CA file")
-		}
-
-		// Append our cert to the system pool
-		if ok := interCAs.AppendCertsFromPEM(certsCA); !ok {
-			return SJWTRetErrCertProcessing, errors.New("failed to append intermediate CA file")
-		}
-	}
-
-	// Append any intermediate certificates included in pubKey.
-	if len(certInter) > 0 {
-		if interCAs == nil {
-			interCAs = x509.NewCertPool()
-		}
-		if interCAs == nil {
-			return SJWTRetErrCertProcessing, errors.New("no new ca intermediate cert pool")
-		}
-		// Append our certs
-		for _, iCert := range certInter {
-			interCAs.AddCert(iCert)
-		}
-	}
-
-	opts := x509.VerifyOptions{
-		Roots:         rootCAs,
-		Intermediates: interCAs,
-		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
-	}
-
-	if _, err = certVal.Verify(opts); err != nil {
-		return SJWTRetErrCertInvalid, err
-	}
-
-	if (globalLibOptions.certVerify & (1 << 4)) != 0 {
-		if len(globalLibOptions.certCRLFile) <= 0 {
-			return SJWTRetErrCertNoCRLFile, errors.New("no CRL file")
-		}
-		var rootCRL *pkix.CertificateList
-		rootCRL = nil
-		var certsCRLData []byte
-		// Read in the cert file
-		certsCRLData, err = ioutil.ReadFile(globalLibOptions.certCRLFile)
-		if err != nil {
-			return SJWTRetErrCertReadCRLFile, errors.New("failed to read CRL file")
-		}
-		rootCRL, err = x509.ParseCRL(certsCRLData)
-		for _, revoked := range rootCRL.TBSCertList.RevokedCertificates {
-			if certVal.SerialNumber.Cmp(revoked.SerialNumber) == 0 {
-				return SJWTRetErrCertRevoked, errors.New("serial number match - certificate is revoked")
-			}
-		}
-	}
-
-	return SJWTRetOK, nil
+	return defaultVerifier(0, 0).PubKeyVerify(pubKey)
 }
 
 // SJWTParseECPrivateKeyFromPEM Parse PEM encoded Elliptic Curve Private Key Structure
@@ -358,20 +321,20 @@ func SJWTParseECPrivateKeyFromPEM(key []byte) (*ecdsa.PrivateKey, int, error) {
 
 	var block *pem.Block
 	if block, _ = pem.Decode(key); block == nil {
-		return nil, SJWTRetErrPrvKeyInvalidFormat, errors.New("key must be PEM encoded")
+		return nil, SJWTRetErrPrvKeyInvalidFormat, newError(SJWTRetErrPrvKeyInvalidFormat, "key must be PEM encoded")
 	}
 
 	var parsedKey interface{}
 	if parsedKey, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
 		if parsedKey, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
-			return nil, SJWTRetErrPrvKeyInvalid, err
+			return nil, SJWTRetErrPrvKeyInvalid, wrapError(SJWTRetErrPrvKeyInvalid, "", err)
 		}
 	}
 
 	var pkey *ecdsa.PrivateKey
 	var ok bool
 	if pkey, ok = parsedKey.(*ecdsa.PrivateKey); !ok {
-		return nil, SJWTRetErrPrvKeyInvalidEC, errors.New("not EC private key")
+		return nil, SJWTRetErrPrvKeyInvalidEC, newError(SJWTRetErrPrvKeyInvalidEC, "not EC private key")
 	}
 
 	return pkey, SJWTRetOK, nil
@@ -383,7 +346,7 @@ func SJWTParseECPublicKeyFromPEM(key []byte) (*ecdsa.PublicKey, int, error) {
 
 	var block *pem.Block
 	if block, _ = pem.Decode(key); block == nil {
-		return nil, SJWTRetErrCertInvalidFormat, errors.New("key must be PEM encoded")
+		return nil, SJWTRetErrCertInvalidFormat, newError(SJWTRetErrCertInvalidFormat, "key must be PEM encoded")
 	}
 
 	var parsedKey interface{}
@@ -391,14 +354,14 @@ func SJWTParseECPublicKeyFromPEM(key []byte) (*ecdsa.PublicKey, int, error) {
 		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
 			parsedKey = cert.PublicKey
 		} else {
-			return nil, SJWTRetErrCertInvalid, err
+			return nil, SJWTRetErrCertInvalid, wrapError(SJWTRetErrCertInvalid, "", err)
 		}
 	}
 
 	var pkey *ecdsa.PublicKey
 	var ok bool
 	if pkey, ok = parsedKey.(*ecdsa.PublicKey); !ok {
-		return nil, SJWTRetErrCertInvalidEC, errors.New("not EC public key")
+		return nil, SJWTRetErrCertInvalidEC, newError(SJWTRetErrCertInvalidEC, "not EC public key")
 	}
 
 	return pkey, SJWTRetOK, nil
@@ -441,89 +404,22 @@ func SJWTBase64DecodeBytes(seg string) ([]byte, error) {
 
 // SJWTGetURLCachedContent --
 func SJWTGetURLCachedContent(urlVal string) ([]byte, error) {
-	filePath := SJWTGetURLCacheFilePath(urlVal)
-
-	fileStat, err := os.Stat(filePath)
-	if err != nil {
-		return nil, err
-	}
-	tnow := time.Now()
-	if int(tnow.Sub(fileStat.ModTime()).Seconds()) > globalLibOptions.cacheExpire {
-		os.Remove(filePath)
-		return nil, nil
-	}
-	return ioutil.ReadFile(filePath)
+	return defaultVerifier(0, 0).GetURLCachedContent(urlVal)
 }
 
 // SJWTSetURLCachedContent --
 func SJWTSetURLCachedContent(urlVal string, data []byte) error {
-	filePath := SJWTGetURLCacheFilePath(urlVal)
-
-	return ioutil.WriteFile(filePath, data, 0640)
+	return defaultVerifier(0, 0).SetURLCachedContent(urlVal, data)
 }
 
 // SJWTGetURLContent --
 func SJWTGetURLContent(urlVal string, timeoutVal int) ([]byte, int, error) {
-	if len(urlVal) == 0 {
-		return nil, SJWTRetErrHTTPInvalidURL, errors.New("no URL value")
-	}
-
-	if !(strings.HasPrefix(urlVal, "http://") || strings.HasPrefix(urlVal, "https://")) {
-		return nil, SJWTRetErrHTTPInvalidURL, errors.New("invalid URL value")
-	}
-
-	if len(globalLibOptions.cacheDirPath) > 0 {
-		cdata, cerr := SJWTGetURLCachedContent(urlVal)
-		if cdata != nil {
-			return cdata, SJWTRetOK, cerr
-		}
-	}
-	httpClient := http.Client{
-		Timeout: time.Duration(timeoutVal) * time.Second,
-	}
-	resp, err := httpClient.Get(urlVal)
-	if err != nil {
-		return nil, SJWTRetErrHTTPGet, fmt.Errorf("http get failure: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, SJWTRetErrHTTPStatusCode, fmt.Errorf("http status error: %v", resp.StatusCode)
-	}
-
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, SJWTRetErrHTTPReadBody, fmt.Errorf("read http body failure: %v", err)
-	}
-
-	if len(globalLibOptions.cacheDirPath) > 0 {
-		SJWTSetURLCachedContent(urlVal, data)
-	}
-
-	return data, SJWTRetOK, nil
+	return defaultVerifier(0, timeoutVal).GetURLContent(urlVal)
 }
 
 // SJWTGetValidPayload --
 func SJWTGetValidPayload(base64Payload string, expireVal int) (*SJWTPayload, int, error) {
-	if len(base64Payload) == 0 {
-		return nil, SJWTRetErrJSONPayloadParse, errors.New("empty payload")
-	}
-	decodedPayload, payloadErr := SJWTBase64DecodeString(base64Payload)
-	if payloadErr != nil {
-		return nil, SJWTRetErrJSONPayloadParse, fmt.Errorf("invalid payload: %s", payloadErr.Error())
-	}
-	payload := SJWTPayload{}
-
-	err := json.Unmarshal([]byte(decodedPayload), &payload)
-	if err != nil {
-		return nil, SJWTRetErrJSONPayloadParse, fmt.Errorf("invalid payload: %s", err.Error())
-	}
-
-	if payload.IAT == 0 || time.Now().Unix() > payload.IAT+int64(expireVal) {
-		return nil, SJWTRetErrJSONPayloadIATExpired, errors.New("expired token")
-	}
-
-	return &payload, SJWTRetOK, nil
+	return defaultVerifier(expireVal, 0).GetValidPayload(base64Payload)
 }
 
 // SJWTVerifyWithPubKey - implements the verify
@@ -533,7 +429,7 @@ func SJWTVerifyWithPubKey(signingString string, signature string, key interface{
 
 	var sig []byte
 	if sig, err = SJWTBase64DecodeBytes(signature); err != nil {
-		return -1, err
+		return SJWTRetErrJSONSignatureInvalid, wrapError(SJWTRetErrJSONSignatureInvalid, "invalid signature encoding", err)
 	}
 
 	var ecdsaKey *ecdsa.PublicKey
@@ -541,18 +437,18 @@ func SJWTVerifyWithPubKey(signingString string, signature string, key interface{
 	case *ecdsa.PublicKey:
 		ecdsaKey = k
 	default:
-		return SJWTRetErrCertInvalidFormat, errors.New("invalid key type")
+		return SJWTRetErrCertInvalidFormat, newError(SJWTRetErrCertInvalidFormat, "invalid key type")
 	}
 
 	if len(sig) != 2*sES256KeySize {
-		return SJWTRetErrJSONSignatureSize, errors.New("ECDSA signature size verification failed")
+		return SJWTRetErrJSONSignatureSize, newError(SJWTRetErrJSONSignatureSize, "ECDSA signature size verification failed")
 	}
 
 	r := big.NewInt(0).SetBytes(sig[:sES256KeySize])
 	s := big.NewInt(0).SetBytes(sig[sES256KeySize:])
 
 	if !crypto.SHA256.Available() {
-		return SJWTRetErrJSONSignatureHashing, errors.New("hashing function unavailable")
+		return SJWTRetErrJSONSignatureHashing, newError(SJWTRetErrJSONSignatureHashing, "hashing function unavailable")
 	}
 	hasher := crypto.SHA256.New()
 	hasher.Write([]byte(signingString))
@@ -560,7 +456,7 @@ func SJWTVerifyWithPubKey(signingString string, signature string, key interface{
 	if verifystatus := ecdsa.Verify(ecdsaKey, hasher.Sum(nil), r, s); verifystatus == true {
 		return SJWTRetOK, nil
 	}
-	return SJWTRetErrJSONSignatureInvalid, errors.New("ECDSA verification failed")
+	return SJWTRetErrJSONSignatureInvalid, newError(SJWTRetErrJSONSignatureInvalid, "ECDSA verification failed")
 }
 
 // SJWTSignWithPrvKey - implements the signing
@@ -571,11 +467,11 @@ func SJWTSignWithPrvKey(signingString string, key interface{}) (string, int, err
 	case *ecdsa.PrivateKey:
 		ecdsaKey = k
 	default:
-		return "", SJWTRetErrPrvKeyInvalidEC, errors.New("invalid key type")
+		return "", SJWTRetErrPrvKeyInvalidEC, newError(SJWTRetErrPrvKeyInvalidEC, "invalid key type")
 	}
 
 	if !crypto.SHA256.Available() {
-		return "", SJWTRetErrJSONSignatureHashing, errors.New("hashing function not available")
+		return "", SJWTRetErrJSONSignatureHashing, newError(SJWTRetErrJSONSignatureHashing, "hashing function not available")
 	}
 
 	hasher := crypto.SHA256.New()
@@ -586,7 +482,7 @@ func SJWTSignWithPrvKey(signingString string, key interface{}) (string, int, err
 		curveBits := ecdsaKey.Curve.Params().BitSize
 
 		if sES256KeyBits != curveBits {
-			return "", SJWTRetErrJSONSignatureSize, errors.New("invalid key size")
+			return "", SJWTRetErrJSONSignatureSize, newError(SJWTRetErrJSONSignatureSize, "invalid key size")
 		}
 
 		keyBytes := curveBits / 8
@@ -606,45 +502,32 @@ func SJWTSignWithPrvKey(signingString string, key interface{}) (string, int, err
 
 		return SJWTBase64EncodeBytes(out), SJWTRetOK, nil
 	}
-	return "", SJWTRetErrJSONSignatureFailure, err
+	return "", SJWTRetErrJSONSignatureFailure, wrapError(SJWTRetErrJSONSignatureFailure, "", err)
 }
 
 // SJWTEncode - encode payload to JWT
 func SJWTEncode(header SJWTHeader, payload SJWTPayload, prvkey interface{}) string {
-	str, _ := json.Marshal(header)
+	token, _, _ := sjwtEncode(header, payload, prvkey)
+	return token
+}
+
+// sjwtEncode - encode payload to JWT, returning the error code on failure
+func sjwtEncode(header interface{}, payload interface{}, prvkey interface{}) (string, int, error) {
+	str, _ := marshalJSON(header)
 	jwthdr := SJWTBase64EncodeString(string(str))
-	encodedPayload, _ := json.Marshal(payload)
+	encodedPayload, _ := marshalJSON(payload)
 	signingValue := jwthdr + "." +
 		SJWTBase64EncodeString(string(encodedPayload))
-	signatureValue, _, _ := SJWTSignWithPrvKey(signingValue, prvkey)
-	return signingValue + "." + signatureValue
+	signatureValue, ret, err := SJWTSignWithPrvKey(signingValue, prvkey)
+	if err != nil {
+		return signingValue + ".", ret, err
+	}
+	return signingValue + "." + signatureValue, SJWTRetOK, nil
 }
 
 // SJWTDecodeWithPubKey - decode JWT string
 func SJWTDecodeWithPubKey(jwt string, expireVal int, pubkey interface{}) (*SJWTPayload, error) {
-	var ret int
-	var err error
-	var payload *SJWTPayload
-
-	token := strings.Split(strings.TrimSpace(jwt), ".")
-
-	if len(token) != 3 {
-		splitErr := errors.New("invalid token - must contain header, payload and signature")
-		return nil, splitErr
-	}
-
-	payload, ret, err = SJWTGetValidPayload(token[1], expireVal)
-	if err != nil {
-		return nil, fmt.Errorf("getting payload failed: (%d) %v", ret, err)
-	}
-
-	signatureValue := token[0] + "." + token[1]
-
-	ret, err = SJWTVerifyWithPubKey(signatureValue, token[2], pubkey)
-	if err != nil {
-		return nil, fmt.Errorf("verify failed: (%d) %v", ret, err)
-	}
-	return payload, nil
+	return defaultVerifier(expireVal, 0).DecodeWithPubKey(jwt, pubkey)
 }
 
 // SJWTEncodeText - encode header and payload to JWT
@@ -654,9 +537,7 @@ func SJWTEncodeText(headerJSON string, payloadJSON string, prvkeyPath string) (s
 	var signatureValue string
 	var ecdsaPrvKey *ecdsa.PrivateKey
 
-	prvkey, _ := ioutil.ReadFile(prvkeyPath)
-
-	if ecdsaPrvKey, ret, err = SJWTParseECPrivateKeyFromPEM(prvkey); err != nil {
+	if ecdsaPrvKey, ret, err = getPrvKeyFile(prvkeyPath).key(); err != nil {
 		return "", ret, err
 	}
 
@@ -664,86 +545,54 @@ func SJWTEncodeText(headerJSON string, payloadJSON string, prvkeyPath string) (s
 		"." + SJWTBase64EncodeString(strings.TrimSpace(payloadJSON))
 	signatureValue, ret, err = SJWTSignWithPrvKey(signingValue, ecdsaPrvKey)
 	if err != nil {
-		return "", ret, fmt.Errorf("failed to build signature: %v", err)
+		return "", ret, wrapError(ret, "failed to build signature", err)
 	}
 	return signingValue + "." + signatureValue, SJWTRetOK, nil
 }
 
 // SJWTCheckAttributes - implements the verify of attributes
 func SJWTCheckAttributes(bToken string, paramInfo string) (int, error) {
+	_, ret, err := sjwtCheckAttributes(bToken, paramInfo)
+	return ret, err
+}
+
+// sjwtCheckAttributes - implements the verify of attributes, returning the
+// decoded JSON header
+func sjwtCheckAttributes(bToken string, paramInfo string) (*SJWTHeader, int, error) {
+	return sjwtCheckAttributesPpt(bToken, paramInfo, SJWTPptShaken)
+}
+
+// sjwtCheckAttributesPpt - implements the verify of attributes for the
+// PASSporT extension type ppt
+func sjwtCheckAttributesPpt(bToken string, paramInfo string, ppt string) (*SJWTHeader, int, error) {
 	vHeader, err := SJWTBase64DecodeString(bToken)
+	if err != nil {
+		return nil, SJWTRetErrJSONHdrParse, wrapError(SJWTRetErrJSONHdrParse, "", err)
+	}
 
 	header := SJWTHeader{}
 	err = json.Unmarshal([]byte(vHeader), &header)
 	if err != nil {
-		return SJWTRetErrJSONHdrParse, err
+		return nil, SJWTRetErrJSONHdrParse, wrapError(SJWTRetErrJSONHdrParse, "", err)
 	}
 	if len(header.Alg) > 0 && header.Alg != "ES256" {
-		return SJWTRetErrJSONHdrAlg, fmt.Errorf("invalid value for alg in json header")
+		return &header, SJWTRetErrJSONHdrAlg, newError(SJWTRetErrJSONHdrAlg, "invalid value for alg in json header")
 	}
-	if len(header.Ppt) > 0 && header.Ppt != "shaken" {
-		return SJWTRetErrJSONHdrPpt, fmt.Errorf("invalid value for ppt in json header")
+	if len(header.Ppt) > 0 && header.Ppt != ppt {
+		return &header, SJWTRetErrJSONHdrPpt, newError(SJWTRetErrJSONHdrPpt, "invalid value for ppt in json header")
 	}
 	if len(header.Typ) > 0 && header.Typ != "passport" {
-		return SJWTRetErrJSONHdrTyp, fmt.Errorf("invalid value for typ in json header")
+		return &header, SJWTRetErrJSONHdrTyp, newError(SJWTRetErrJSONHdrTyp, "invalid value for typ in json header")
 	}
 	if len(header.X5u) > 0 && header.X5u != paramInfo {
-		return SJWTRetErrJSONHdrX5u, fmt.Errorf("mismatching value for x5u and info attributes")
+		return &header, SJWTRetErrJSONHdrX5u, newError(SJWTRetErrJSONHdrX5u, "mismatching value for x5u and info attributes")
 	}
-	return SJWTRetOK, nil
+	return &header, SJWTRetOK, nil
 }
 
 // SJWTCheckIdentityPKMode - implements the verify of identity
 func SJWTCheckIdentityPKMode(identityVal string, expireVal int, pubkeyVal string, pubkeyMode int, timeoutVal int) (int, error) {
-	var err error
-	var ret int
-	var ecdsaPubKey *ecdsa.PublicKey
-	var pubkey []byte
-	var payload *SJWTPayload
-
-	token := strings.Split(strings.TrimSpace(identityVal), ".")
-
-	if len(token) != 3 {
-		return SJWTRetErrSIPHdrParse, fmt.Errorf("invalid token - must contain header, payload and signature")
-	}
-
-	payload, ret, err = SJWTGetValidPayload(token[1], expireVal)
-	if err != nil {
-		return ret, err
-	}
-
-	if pubkeyMode == 1 {
-		pubkey = []byte(pubkeyVal)
-	} else {
-		if strings.HasPrefix(pubkeyVal, "http://") || strings.HasPrefix(pubkeyVal, "https://") {
-			pubkey, ret, err = SJWTGetURLContent(pubkeyVal, timeoutVal)
-		} else if strings.HasPrefix(pubkeyVal, "file://") {
-			fileUrl, _ := url.Parse(pubkeyVal)
-			pubkey, err = ioutil.ReadFile(fileUrl.Path)
-			ret = SJWTRetErrFileRead
-		} else {
-			pubkey, err = ioutil.ReadFile(pubkeyVal)
-			ret = SJWTRetErrFileRead
-		}
-		if err != nil {
-			return ret, err
-		}
-	}
-
-	ret, err = SJWTPubKeyVerify(pubkey)
-	if ret != SJWTRetOK {
-		return ret, err
-	}
-
-	if ecdsaPubKey, ret, err = SJWTParseECPublicKeyFromPEM(pubkey); err != nil {
-		return ret, err
-	}
-	ret, err = SJWTVerifyWithPubKey(token[0]+"."+token[1], token[2], ecdsaPubKey)
-	if err == nil {
-		return SJWTRetOK, nil
-	}
-
-	return ret, fmt.Errorf("failed to verify - origid (%s) (%d) %v", payload.OrigID, ret, err)
+	return defaultVerifier(expireVal, timeoutVal).CheckIdentityPKMode(identityVal, pubkeyVal, pubkeyMode)
 }
 
 // SJWTCheckIdentity - implements the verify of identity
@@ -751,205 +600,310 @@ func SJWTCheckIdentity(identityVal string, expireVal int, pubkeyPath string, tim
 	return SJWTCheckIdentityPKMode(identityVal, expireVal, pubkeyPath, 0, timeoutVal)
 }
 
-// SJWTGetValidInfoAttr - return info param value of alg and ppt are valid
+// SJWTGetValidInfoAttr - return info param value of alg and ppt are valid,
+// hdrtoken being the Identity header value split on ';'
 func SJWTGetValidInfoAttr(hdrtoken []string) (string, int, error) {
-	paramInfo := ""
-	for i := 1; i < len(hdrtoken); i++ {
-		ptoken := strings.Split(hdrtoken[i], "=")
-		if len(ptoken) == 2 {
-			if ptoken[0] == "alg" {
-				if ptoken[1] != "ES256" {
-					return "", SJWTRetErrSIPHdrAlg, fmt.Errorf("invalid value for alg header parameter")
-				}
-			} else if ptoken[0] == "ppt" {
-				if ptoken[1] != "shaken" && ptoken[1] != `"shaken"` {
-					return "", SJWTRetErrSIPHdrPpt, fmt.Errorf("invalid value for ppt header parameter")
-				}
-			} else if ptoken[0] == "info" {
-				paramInfo = ptoken[1]
-			}
-		}
-	}
-	if len(paramInfo) <= 2 {
-		return "", SJWTRetErrSIPHdrInfo, fmt.Errorf("invalid value info header parameter")
-	}
-	if paramInfo[0] == '<' && paramInfo[len(paramInfo)-1] == '>' {
-		paramInfo = paramInfo[1 : len(paramInfo)-1]
+	hdr, ret, err := SJWTParseIdentityHeader(strings.Join(hdrtoken, ";"))
+	if err != nil {
+		return "", ret, err
 	}
-
-	return paramInfo, SJWTRetOK, nil
+	return hdr.validInfo(SJWTPptShaken)
 }
 
 // SJWTCheckFullIdentity - implements the verify of identity
 func SJWTCheckFullIdentity(identityVal string, expireVal int, pubkeyPath string, timeoutVal int) (int, error) {
-	if len(pubkeyPath) == 0 {
-		return SJWTCheckFullIdentityURL(identityVal, expireVal, timeoutVal)
-	}
-
-	hdrtoken := strings.Split(SJWTRemoveWhiteSpaces(identityVal), ";")
+	return defaultVerifier(expireVal, timeoutVal).CheckFullIdentity(identityVal, pubkeyPath)
+}
 
-	ret, err := SJWTCheckIdentity(hdrtoken[0], expireVal, pubkeyPath, timeoutVal)
-	if ret != 0 {
-		return ret, err
-	}
+// SJWTCheckFullIdentityResult - implements the verify of identity, returning
+// the details collected during the verification
+func SJWTCheckFullIdentityResult(identityVal string, expireVal int, pubkeyPath string, timeoutVal int) *VerificationResult {
+	return defaultVerifier(expireVal, timeoutVal).CheckFullIdentityResult(identityVal, pubkeyPath)
+}
 
-	if len(hdrtoken) == 1 {
-		return SJWTRetErrSIPHdrParse, nil
-	}
+// SJWTCheckFullIdentityURL - implements the verify of identity using URL
+func SJWTCheckFullIdentityURL(identityVal string, expireVal int, timeoutVal int) (int, error) {
+	return defaultVerifier(expireVal, timeoutVal).CheckFullIdentityURL(identityVal)
+}
 
-	paramInfo := ""
-	paramInfo, ret, err = SJWTGetValidInfoAttr(hdrtoken)
-	if err != nil {
-		return ret, err
-	}
+// SJWTCheckFullIdentityPubKey - implements the verify of identity using public key
+func SJWTCheckFullIdentityPubKey(identityVal string, expireVal int, pubkeyVal string) (int, error) {
+	return defaultVerifier(expireVal, 5).CheckFullIdentityPubKey(identityVal, pubkeyVal)
+}
 
-	btoken := strings.Split(strings.TrimSpace(hdrtoken[0]), ".")
+// SJWTGetIdentityPrvKey --
+func SJWTGetIdentityPrvKey(origTN string, destTN string, attestVal string, origID string, x5uVal string, prvkeyData []byte) (string, int, error) {
+	var ret int
+	var err error
 
-	if len(btoken[0]) == 0 {
-		return SJWTRetErrJSONHdrParse, nil
+	var ecdsaPrvKey *ecdsa.PrivateKey
+	if ecdsaPrvKey, ret, err = SJWTParseECPrivateKeyFromPEM(prvkeyData); err != nil {
+		return "", ret, wrapError(ret, "Unable to parse ECDSA private key", err)
 	}
-	return SJWTCheckAttributes(btoken[0], paramInfo)
+	return sjwtGetIdentity(origTN, destTN, attestVal, origID, x5uVal, ecdsaPrvKey)
 }
 
-// SJWTCheckFullIdentityURL - implements the verify of identity using URL
-func SJWTCheckFullIdentityURL(identityVal string, expireVal int, timeoutVal int) (int, error) {
-	var ecdsaPubKey *ecdsa.PublicKey
+// SJWTGetIdentity --
+func SJWTGetIdentity(origTN string, destTN string, attestVal string, origID string, x5uVal string, prvkeyPath string) (string, int, error) {
 	var ret int
 	var err error
-	var pubkey []byte
 
-	hdrtoken := strings.Split(SJWTRemoveWhiteSpaces(identityVal), ";")
-
-	if len(hdrtoken) <= 1 {
-		return SJWTRetErrSIPHdrParse, fmt.Errorf("missing parts of the message header")
-	}
-
-	paramInfo := ""
-	paramInfo, ret, err = SJWTGetValidInfoAttr(hdrtoken)
-	if err != nil {
-		return ret, err
+	// the parsed private key is cached and reloaded only when the file changes
+	var ecdsaPrvKey *ecdsa.PrivateKey
+	if ecdsaPrvKey, ret, err = getPrvKeyFile(prvkeyPath).key(); err != nil {
+		return "", ret, err
 	}
+	return sjwtGetIdentity(origTN, destTN, attestVal, origID, x5uVal, ecdsaPrvKey)
+}
 
-	pubkey, ret, err = SJWTGetURLContent(paramInfo, timeoutVal)
+// SJWTGetIdentityMultiPrvKey - build the Identity header value for a call to
+// several destination numbers, with the content of the private key
+func SJWTGetIdentityMultiPrvKey(origTN string, destTNs []string, attestVal string, origID string, x5uVal string, prvkeyData []byte) (string, int, error) {
+	var ret int
+	var err error
 
-	if pubkey == nil {
-		return ret, err
+	var ecdsaPrvKey *ecdsa.PrivateKey
+	if ecdsaPrvKey, ret, err = SJWTParseECPrivateKeyFromPEM(prvkeyData); err != nil {
+		return "", ret, wrapError(ret, "Unable to parse ECDSA private key", err)
 	}
+	return sjwtGetIdentityMulti(origTN, destTNs, attestVal, origID, x5uVal, ecdsaPrvKey)
+}
 
-	ret, err = SJWTPubKeyVerify(pubkey)
-	if ret != SJWTRetOK {
-		return ret, err
-	}
+// SJWTGetIdentityMulti - build the Identity header value for a call to
+// several destination numbers (e.g., forked or group calls), with the private
+// key from the file
+func SJWTGetIdentityMulti(origTN string, destTNs []string, attestVal string, origID string, x5uVal string, prvkeyPath string) (string, int, error) {
+	var ret int
+	var err error
 
-	if ecdsaPubKey, ret, err = SJWTParseECPublicKeyFromPEM(pubkey); err != nil {
-		return ret, err
+	var ecdsaPrvKey *ecdsa.PrivateKey
+	if ecdsaPrvKey, ret, err = getPrvKeyFile(prvkeyPath).key(); err != nil {
+		return "", ret, err
 	}
+	return sjwtGetIdentityMulti(origTN, destTNs, attestVal, origID, x5uVal, ecdsaPrvKey)
+}
 
-	btoken := strings.Split(strings.TrimSpace(hdrtoken[0]), ".")
-
-	if len(btoken) != 3 {
-		return SJWTRetErrSIPHdrParse, fmt.Errorf("invalid token - must contain header, payload and signature")
+// SJWTParseTNList - return the telephone numbers of a list separated by comma
+// or semicolon, skipping the empty items
+func SJWTParseTNList(tnList string) []string {
+	tns := []string{}
+	for _, tn := range strings.FieldsFunc(tnList, func(c rune) bool {
+		return c == ',' || c == ';'
+	}) {
+		if tn = strings.TrimSpace(tn); len(tn) > 0 {
+			tns = append(tns, tn)
+		}
 	}
+	return tns
+}
+
+// sjwtGetIdentity - build the Identity header value with the parsed private key
+func sjwtGetIdentity(origTN string, destTN string, attestVal string, origID string, x5uVal string, prvkey *ecdsa.PrivateKey) (string, int, error) {
+	return sjwtGetIdentityMulti(origTN, []string{destTN}, attestVal, origID, x5uVal, prvkey)
+}
+
+// sjwtGetIdentityMulti - build the Identity header value for several
+// destination numbers with the parsed private key
+func sjwtGetIdentityMulti(origTN string, destTNs []string, attestVal string, origID string, x5uVal string, prvkey *ecdsa.PrivateKey) (string, int, error) {
+	if len(destTNs) == 0 {
+		return "", SJWTRetErr, newError(SJWTRetErr, "no destination number")
+	}
+	return sjwtGetIdentityOpts(SJWTIdentityOptions{
+		OrigTN:  origTN,
+		DestTNs: destTNs,
+		Attest:  attestVal,
+		OrigID:  origID,
+		X5u:     x5uVal,
+	}, prvkey)
+}
+
+// SJWTIdentityOptions - attributes of the PASSporT to be built for the
+// Identity header
+type SJWTIdentityOptions struct {
+	// PASSporT extension type: "shaken" (default), "div", "rcd" or "rph"
+	Ppt string
+	// calling number
+	OrigTN string
+	// calling SIP URI (uri in orig claim)
+	OrigURI string
+	// called numbers
+	DestTNs []string
+	// called SIP URIs (uri in dest claim)
+	DestURIs []string
+	// attestation level (only for "shaken")
+	Attest string
+	// unique ID for tracking purposes, if empty a UUID is generated (only for
+	// "shaken")
+	OrigID string
+	// location of public certificate, if empty the library option is used
+	X5u string
+	// call reason (crn claim)
+	CRN string
+	// rich call data (rcd claim)
+	RCD *SJWTRCD
+	// integrity digests of rich call data (rcdi claim), see SJWTGetRCDI()
+	RCDI map[string]string
+	// resource priority values (auth of rph claim, only for "rph")
+	RPH []string
+	// diverting number (tn of div claim, only for "div")
+	DivTN string
+	// set the telephone numbers in canonical form (RFC 8224 section 8.3), if
+	// false the library option is used
+	CanonicalizeTN bool
+	// country code used to canonicalize national telephone numbers, if empty
+	// the library option is used
+	CountryCode string
+	// build the Identity header with the PASSporT in compact form (only the
+	// dest, iat and orig claims, without ppt), the verifier rebuilding it
+	// from the SIP request
+	Compact bool
+}
+
+// SJWTGetIdentityOpts - build the Identity header value with the attributes
+// from opts and the private key from the file
+func SJWTGetIdentityOpts(opts SJWTIdentityOptions, prvkeyPath string) (string, int, error) {
+	var ret int
+	var err error
 
-	if len(btoken[0]) == 0 {
-		return SJWTRetErrSIPHdrParse, fmt.Errorf("no json header part")
+	var ecdsaPrvKey *ecdsa.PrivateKey
+	if ecdsaPrvKey, ret, err = getPrvKeyFile(prvkeyPath).key(); err != nil {
+		return "", ret, err
 	}
+	return sjwtGetIdentityOpts(opts, ecdsaPrvKey)
+}
 
-	var payload *SJWTPayload
-	payload, ret, err = SJWTGetValidPayload(btoken[1], expireVal)
-	if payload == nil || err != nil {
-		return ret, err
-	}
+// SJWTGetIdentityPrvKeyOpts - build the Identity header value with the
+// attributes from opts and the content of the private key
+func SJWTGetIdentityPrvKeyOpts(opts SJWTIdentityOptions, prvkeyData []byte) (string, int, error) {
+	var ret int
+	var err error
 
-	ret, err = SJWTVerifyWithPubKey(btoken[0]+"."+btoken[1], btoken[2], ecdsaPubKey)
-	if err != nil {
-		return ret, err
+	var ecdsaPrvKey *ecdsa.PrivateKey
+	if ecdsaPrvKey, ret, err = SJWTParseECPrivateKeyFromPEM(prvkeyData); err != nil {
+		return "", ret, wrapError(ret, "Unable to parse ECDSA private key", err)
 	}
-
-	return SJWTCheckAttributes(btoken[0], paramInfo)
+	return sjwtGetIdentityOpts(opts, ecdsaPrvKey)
 }
 
-// SJWTCheckFullIdentityPubKey - implements the verify of identity using public key
-func SJWTCheckFullIdentityPubKey(identityVal string, expireVal int, pubkeyVal string) (int, error) {
-	hdrtoken := strings.Split(SJWTRemoveWhiteSpaces(identityVal), ";")
-
-	ret, err := SJWTCheckIdentityPKMode(hdrtoken[0], expireVal, pubkeyVal, 1, 5)
-	if ret != 0 {
-		return ret, err
+// sjwtGetIdentityOpts - build the Identity header value with the parsed
+// private key, using the library x5u and TN options if they are not set in
+// opts
+func sjwtGetIdentityOpts(opts SJWTIdentityOptions, prvkey *ecdsa.PrivateKey) (string, int, error) {
+	globalLibOptionsMu.RLock()
+	if len(opts.X5u) == 0 {
+		opts.X5u = globalLibOptions.x5u
 	}
-
-	if len(hdrtoken) == 1 {
-		return SJWTRetOK, nil
+	if !opts.CanonicalizeTN {
+		opts.CanonicalizeTN = globalLibOptions.tnCanonicalize != 0
 	}
-
-	paramInfo := ""
-	paramInfo, ret, err = SJWTGetValidInfoAttr(hdrtoken)
-	if err != nil {
-		return ret, err
+	if len(opts.CountryCode) == 0 {
+		opts.CountryCode = globalLibOptions.tnCountryCode
 	}
-
-	btoken := strings.Split(strings.TrimSpace(hdrtoken[0]), ".")
-
-	if len(btoken[0]) == 0 {
-		return SJWTRetOK, nil
+	globalLibOptionsMu.RUnlock()
+	if opts.Compact {
+		return sjwtGetCompactIdentity(opts, time.Now().Unix(), prvkey)
+	}
+	header, payload, ret, err := sjwtBuildPASSporT(opts, time.Now().Unix())
+	if err != nil {
+		return "", ret, err
 	}
-	return SJWTCheckAttributes(btoken[0], paramInfo)
+	return sjwtGetIdentityHeader(header, payload, prvkey)
 }
 
-// SJWTGetIdentityPrvKey --
-func SJWTGetIdentityPrvKey(origTN string, destTN string, attestVal string, origID string, x5uVal string, prvkeyData []byte) (string, int, error) {
-	var ret int
-	var err error
-	var vOrigID string
-
+// sjwtBuildPASSporT - return the JSON header and payload for the attributes
+func sjwtBuildPASSporT(opts SJWTIdentityOptions, iat int64) (SJWTHeader, interface{}, int, error) {
 	header := SJWTHeader{
 		Alg: "ES256",
-		Ppt: "shaken",
+		Ppt: SJWTPptShaken,
 		Typ: "passport",
-		X5u: globalLibOptions.x5u,
-	}
-	if len(x5uVal) > 0 {
-		header.X5u = x5uVal
-	}
-	if len(origID) > 0 {
-		vOrigID = origID
-	} else {
-		vuuid := uuid.New()
-		vOrigID = vuuid.String()
-	}
-
-	payload := SJWTPayload{
-		ATTest: attestVal,
-		Dest: SJWTDest{
-			TN: []string{destTN},
-		},
-		IAT: time.Now().Unix(),
-		Orig: SJWTOrig{
-			TN: origTN,
-		},
-		OrigID: vOrigID,
-	}
-
-	var ecdsaPrvKey *ecdsa.PrivateKey
-	if ecdsaPrvKey, ret, err = SJWTParseECPrivateKeyFromPEM(prvkeyData); err != nil {
-		return "", ret, fmt.Errorf("Unable to parse ECDSA private key: %v", err)
+		X5u: opts.X5u,
 	}
-	token := SJWTEncode(header, payload, ecdsaPrvKey)
-
-	if len(token) > 0 {
-		return token + ";info=<" + header.X5u + ">;alg=ES256;ppt=shaken", SJWTRetOK, nil
+	if opts.CanonicalizeTN {
+		if len(opts.OrigTN) > 0 {
+			opts.OrigTN = SJWTCanonicalizeTN(opts.OrigTN, opts.CountryCode)
+		}
+		opts.DestTNs = sjwtCanonicalTNs(opts.DestTNs, opts.CountryCode)
+		if len(opts.DivTN) > 0 {
+			opts.DivTN = SJWTCanonicalizeTN(opts.DivTN, opts.CountryCode)
+		}
 	}
-	return "", SJWTRetErrSIPHdrEmpty, errors.New("empty result")
-}
 
-// SJWTGetIdentity --
-func SJWTGetIdentity(origTN string, destTN string, attestVal string, origID string, x5uVal string, prvkeyPath string) (string, int, error) {
-	var prvkey []byte
-	var err error
-
-	prvkey, err = ioutil.ReadFile(prvkeyPath)
-	if err != nil {
-		return "", SJWTRetErrFileRead, fmt.Errorf("Unable to read private key file: %v", err)
-	}
-	return SJWTGetIdentityPrvKey(origTN, destTN, attestVal, origID, x5uVal, prvkey)
+	switch opts.Ppt {
+	case "", SJWTPptShaken:
+		origID := opts.OrigID
+		if len(origID) == 0 {
+			origID = uuid.New().String()
+		}
+		return header, SJWTPayload{
+			ATTest: opts.Attest,
+			CRN:    opts.CRN,
+			Dest: SJWTDest{
+				TN:  opts.DestTNs,
+				URI: opts.DestURIs,
+			},
+			IAT: iat,
+			Orig: SJWTOrig{
+				TN:  opts.OrigTN,
+				URI: opts.OrigURI,
+			},
+			OrigID: origID,
+			RCD:    opts.RCD,
+			RCDI:   opts.RCDI,
+		}, SJWTRetOK, nil
+	case SJWTPptDiv:
+		header.Ppt = SJWTPptDiv
+		return header, SJWTDivPayload{
+			Dest: SJWTDest{
+				TN:  opts.DestTNs,
+				URI: opts.DestURIs,
+			},
+			Div: SJWTDiv{
+				TN: opts.DivTN,
+			},
+			IAT: iat,
+			Orig: SJWTOrig{
+				TN:  opts.OrigTN,
+				URI: opts.OrigURI,
+			},
+		}, SJWTRetOK, nil
+	case SJWTPptRCD:
+		if opts.RCD == nil {
+			return header, nil, SJWTRetErrJSONPayloadRCD, newError(SJWTRetErrJSONPayloadRCD, "missing rcd claim")
+		}
+		header.Ppt = SJWTPptRCD
+		return header, SJWTRCDPayload{
+			CRN: opts.CRN,
+			Dest: SJWTDest{
+				TN:  opts.DestTNs,
+				URI: opts.DestURIs,
+			},
+			IAT: iat,
+			Orig: SJWTOrig{
+				TN:  opts.OrigTN,
+				URI: opts.OrigURI,
+			},
+			RCD:  *opts.RCD,
+			RCDI: opts.RCDI,
+		}, SJWTRetOK, nil
+	case SJWTPptRPH:
+		if len(opts.RPH) == 0 {
+			return header, nil, SJWTRetErrJSONPayloadRPH, newError(SJWTRetErrJSONPayloadRPH, "missing rph claim")
+		}
+		header.Ppt = SJWTPptRPH
+		return header, SJWTRPHPayload{
+			Dest: SJWTDest{
+				TN:  opts.DestTNs,
+				URI: opts.DestURIs,
+			},
+			IAT: iat,
+			Orig: SJWTOrig{
+				TN:  opts.OrigTN,
+				URI: opts.OrigURI,
+			},
+			RPH: SJWTRPH{
+				Auth: opts.RPH,
+			},
+		}, SJWTRetOK, nil
+	}
+	return header, nil, SJWTRetErrJSONHdrPpt, newError(SJWTRetErrJSONHdrPpt, "unsupported ppt value: "+opts.Ppt)
 }
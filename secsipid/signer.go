@@ -0,0 +1,200 @@
+package secsipid
+
+import (
+	"crypto/ecdsa"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// SignerOptions - settings used by a Signer instance
+type SignerOptions struct {
+	// path to private key file, reloaded when the file changes
+	PrvKeyPath string
+	// content of private key, used when PrvKeyPath is empty
+	PrvKeyData []byte
+	// location of the public certificate (x5u header and info parameter)
+	X5u string
+	// attestation level used when Sign() is called with an empty value
+	Attest string
+	// set the telephone numbers in canonical form (RFC 8224 section 8.3)
+	CanonicalizeTN bool
+	// country code used to canonicalize national telephone numbers
+	CountryCode string
+	// clock used to set iat ('nil' - time.Now)
+	Now func() time.Time
+}
+
+// Signer - builds Identity headers with a parsed private key
+//
+// A Signer is safe for concurrent use by multiple goroutines.
+type Signer struct {
+	opts    SignerOptions
+	prvKey  *ecdsa.PrivateKey
+	keyFile *prvKeyFile
+}
+
+// prvKeyFile - private key parsed from a file, reloaded when the file changes
+type prvKeyFile struct {
+	path    string
+	mu      sync.Mutex
+	prvKey  *ecdsa.PrivateKey
+	modTime time.Time
+	size    int64
+}
+
+// prvKeyFiles - cache of private keys used by the SJWT* signing functions
+var prvKeyFiles sync.Map
+
+// getPrvKeyFile - return the cached private key file structure for the path
+func getPrvKeyFile(prvkeyPath string) *prvKeyFile {
+	kf, _ := prvKeyFiles.LoadOrStore(prvkeyPath, &prvKeyFile{path: prvkeyPath})
+	return kf.(*prvKeyFile)
+}
+
+// key - return the private key, parsing the file again if it was changed
+func (kf *prvKeyFile) key() (*ecdsa.PrivateKey, int, error) {
+	fileStat, err := os.Stat(kf.path)
+	if err != nil {
+		return nil, SJWTRetErrFileRead, wrapError(SJWTRetErrFileRead, "Unable to read private key file", err)
+	}
+
+	kf.mu.Lock()
+	defer kf.mu.Unlock()
+
+	if kf.prvKey != nil && fileStat.ModTime().Equal(kf.modTime) && fileStat.Size() == kf.size {
+		return kf.prvKey, SJWTRetOK, nil
+	}
+
+	prvkeyData, err := ioutil.ReadFile(kf.path)
+	if err != nil {
+		return nil, SJWTRetErrFileRead, wrapError(SJWTRetErrFileRead, "Unable to read private key file", err)
+	}
+	prvKey, ret, err := SJWTParseECPrivateKeyFromPEM(prvkeyData)
+	if err != nil {
+		return nil, ret, wrapError(ret, "Unable to parse ECDSA private key", err)
+	}
+	kf.prvKey = prvKey
+	kf.modTime = fileStat.ModTime()
+	kf.size = fileStat.Size()
+
+	return kf.prvKey, SJWTRetOK, nil
+}
+
+// NewSigner - create a Signer instance from the options, loading the private key
+func NewSigner(opts SignerOptions) (*Signer, int, error) {
+	var ret int
+	var err error
+
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	s := &Signer{opts: opts}
+	if len(opts.PrvKeyPath) > 0 {
+		s.keyFile = &prvKeyFile{path: opts.PrvKeyPath}
+		if _, ret, err = s.keyFile.key(); err != nil {
+			return nil, ret, err
+		}
+		return s, SJWTRetOK, nil
+	}
+	if len(opts.PrvKeyData) == 0 {
+		return nil, SJWTRetErrPrvKeyInvalid, newError(SJWTRetErrPrvKeyInvalid, "no private key")
+	}
+	if s.prvKey, ret, err = SJWTParseECPrivateKeyFromPEM(opts.PrvKeyData); err != nil {
+		return nil, ret, wrapError(ret, "Unable to parse ECDSA private key", err)
+	}
+	return s, SJWTRetOK, nil
+}
+
+// PrvKey - return the private key, reloaded if the key file was changed
+func (s *Signer) PrvKey() (*ecdsa.PrivateKey, int, error) {
+	if s.keyFile != nil {
+		return s.keyFile.key()
+	}
+	return s.prvKey, SJWTRetOK, nil
+}
+
+// X5u - return the location of the public certificate used by the signer
+func (s *Signer) X5u() string {
+	return s.opts.X5u
+}
+
+// Sign - return the Identity header value for the call attributes, using the
+// signer default attestation level if attestVal is empty and a generated UUID
+// if origID is empty
+func (s *Signer) Sign(origTN string, destTNs []string, attestVal string, origID string) (string, int, error) {
+	return s.SignOpts(SJWTIdentityOptions{
+		OrigTN:  origTN,
+		DestTNs: destTNs,
+		Attest:  attestVal,
+		OrigID:  origID,
+	})
+}
+
+// SignOpts - return the Identity header value for the attributes in opts,
+// using the signer location of the certificate and default attestation level
+// if they are empty
+func (s *Signer) SignOpts(opts SJWTIdentityOptions) (string, int, error) {
+	if len(opts.DestTNs) == 0 && len(opts.DestURIs) == 0 {
+		return "", SJWTRetErr, newError(SJWTRetErr, "no destination number")
+	}
+	if len(opts.Attest) == 0 {
+		opts.Attest = s.opts.Attest
+	}
+	if len(opts.X5u) == 0 {
+		opts.X5u = s.opts.X5u
+	}
+	if !opts.CanonicalizeTN {
+		opts.CanonicalizeTN = s.opts.CanonicalizeTN
+	}
+	if len(opts.CountryCode) == 0 {
+		opts.CountryCode = s.opts.CountryCode
+	}
+	if opts.Compact {
+		ecdsaPrvKey, ret, err := s.PrvKey()
+		if err != nil {
+			return "", ret, err
+		}
+		return sjwtGetCompactIdentity(opts, s.opts.Now().Unix(), ecdsaPrvKey)
+	}
+
+	header, payload, ret, err := sjwtBuildPASSporT(opts, s.opts.Now().Unix())
+	if err != nil {
+		return "", ret, err
+	}
+	return s.signHeaderPayload(header, payload)
+}
+
+// SignHeaderPayload - return the Identity header value for header and payload
+func (s *Signer) SignHeaderPayload(header SJWTHeader, payload SJWTPayload) (string, int, error) {
+	return s.signHeaderPayload(header, payload)
+}
+
+// signHeaderPayload - return the Identity header value for header and any
+// type of PASSporT payload
+func (s *Signer) signHeaderPayload(header SJWTHeader, payload interface{}) (string, int, error) {
+	ecdsaPrvKey, ret, err := s.PrvKey()
+	if err != nil {
+		return "", ret, err
+	}
+	return sjwtGetIdentityHeader(header, payload, ecdsaPrvKey)
+}
+
+// sjwtGetIdentityHeader - sign and build the Identity header value with parameters
+func sjwtGetIdentityHeader(header SJWTHeader, payload interface{}, prvkey *ecdsa.PrivateKey) (string, int, error) {
+	token, ret, err := sjwtEncode(header, payload, prvkey)
+	if err != nil {
+		return "", ret, err
+	}
+	if len(token) > 0 {
+		hdr := IdentityHeader{
+			Token: token,
+			Info:  header.X5u,
+			Alg:   header.Alg,
+			Ppt:   header.Ppt,
+		}
+		return hdr.String(), SJWTRetOK, nil
+	}
+	return "", SJWTRetErrSIPHdrEmpty, newError(SJWTRetErrSIPHdrEmpty, "empty result")
+}
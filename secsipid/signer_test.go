@@ -0,0 +1,243 @@
+package secsipid_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestSigner(t *testing.T) {
+	keyPath := path.Join(t.TempDir(), "ec256-private.pem")
+
+	prvKeyOne, pubKeyOne := writeDummyECKey(keyPath)
+
+	verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+		Expire: 60,
+	})
+
+	t.Run("ErrFileRead with non-existant key file", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		signer, errCode, _ := secsipid.NewSigner(secsipid.SignerOptions{
+			PrvKeyPath: "nonexistant.pem",
+		})
+
+		expect(signer).ToBe((*secsipid.Signer)(nil))
+		expect(errCode).ToBe(secsipid.SJWTRetErrFileRead)
+	})
+
+	t.Run("ErrPrvKeyInvalidFormat with bad key data", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, errCode, _ := secsipid.NewSigner(secsipid.SignerOptions{
+			PrvKeyData: []byte("bad key format"),
+		})
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrPrvKeyInvalidFormat)
+	})
+
+	t.Run("OK with signed identity", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		signer, errCode, _ := secsipid.NewSigner(secsipid.SignerOptions{
+			PrvKeyPath: keyPath,
+			X5u:        "https://127.0.0.1/cert.pem",
+			Attest:     "B",
+		})
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+
+		prvKey, _, _ := signer.PrvKey()
+		expect(prvKey).ToEqual(prvKeyOne)
+
+		identity, errCode, _ := signer.Sign("493055555555", []string{"493044444444", "493044444445"}, "", "")
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		expect(strings.HasSuffix(identity, ";info=<https://127.0.0.1/cert.pem>;alg=ES256;ppt=shaken")).ToBe(true)
+
+		errCode, _ = verifier.CheckFullIdentityPubKey(identity, string(pubKeyOne))
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+
+		token := strings.Split(strings.Split(identity, ";")[0], ".")
+		payload, _, _ := verifier.GetValidPayload(token[1])
+		expect(payload.ATTest).ToBe("B")
+		expect(payload.Dest.TN).ToEqual([]string{"493044444444", "493044444445"})
+		expect(len(payload.OrigID)).ToBe(36)
+	})
+
+	t.Run("OK with SIP URI identities", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		signer, _, _ := secsipid.NewSigner(secsipid.SignerOptions{
+			PrvKeyPath: keyPath,
+			X5u:        "https://127.0.0.1/cert.pem",
+		})
+
+		identity, errCode, _ := signer.SignOpts(secsipid.SJWTIdentityOptions{
+			OrigURI:  "sip:alice@example.com",
+			DestURIs: []string{"sip:bob@example.com"},
+			Attest:   "A",
+		})
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+
+		res := verifier.CheckFullIdentityPubKeyResult(identity, string(pubKeyOne))
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetOK)
+		expect(res.Payload.Orig).ToEqual(secsipid.SJWTOrig{URI: "sip:alice@example.com"})
+		expect(res.Payload.Dest).ToEqual(secsipid.SJWTDest{URI: []string{"sip:bob@example.com"}})
+
+		token := strings.Split(strings.Split(identity, ";")[0], ".")
+		payloadJSON, _ := secsipid.SJWTBase64DecodeString(token[1])
+		expect(strings.Contains(payloadJSON, `"dest":{"uri":["sip:bob@example.com"]}`)).ToBe(true)
+		expect(strings.Contains(payloadJSON, `"orig":{"uri":"sip:alice@example.com"}`)).ToBe(true)
+	})
+
+	t.Run("ErrCode without destination", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		signer, _, _ := secsipid.NewSigner(secsipid.SignerOptions{
+			PrvKeyPath: keyPath,
+			X5u:        "https://127.0.0.1/cert.pem",
+		})
+
+		identity, errCode, err := signer.Sign("493055555555", []string{}, "A", "")
+		expect(identity).ToBe("")
+		expect(errCode).ToBe(secsipid.SJWTRetErr)
+		expect(getMsgFromErr(err)).ToBe("no destination number")
+
+		_, errCode, _ = signer.SignOpts(secsipid.SJWTIdentityOptions{
+			OrigTN: "493055555555",
+			Attest: "A",
+		})
+		expect(errCode).ToBe(secsipid.SJWTRetErr)
+	})
+
+	t.Run("Reloads key when the file changes", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		signer, _, _ := secsipid.NewSigner(secsipid.SignerOptions{
+			PrvKeyPath: keyPath,
+			X5u:        "https://127.0.0.1/cert.pem",
+		})
+
+		prvKeyTwo, pubKeyTwo := writeDummyECKey(keyPath)
+		modTime := time.Now().Add(time.Minute)
+		os.Chtimes(keyPath, modTime, modTime)
+
+		prvKey, _, _ := signer.PrvKey()
+		expect(prvKey).ToEqual(prvKeyTwo)
+
+		identity, _, _ := signer.Sign("493055555555", []string{"493044444444"}, "A", "")
+
+		errCode, _ := verifier.CheckFullIdentityPubKey(identity, string(pubKeyTwo))
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		errCode, _ = verifier.CheckFullIdentityPubKey(identity, string(pubKeyOne))
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONSignatureInvalid)
+	})
+}
+
+func TestGetIdentityReloadsKey(t *testing.T) {
+	expect := expectate.Expect(t)
+
+	secsipid.SJWTLibOptSetN("CertVerify", 0)
+
+	keyPath := path.Join(t.TempDir(), "ec256-private.pem")
+	_, pubKeyOne := writeDummyECKey(keyPath)
+
+	identity, errCode, _ := secsipid.SJWTGetIdentity("493055555555", "493044444444", "A", "", "", keyPath)
+	expect(errCode).ToBe(secsipid.SJWTRetOK)
+	errCode, _ = secsipid.SJWTCheckFullIdentityPubKey(identity, 60, string(pubKeyOne))
+	expect(errCode).ToBe(secsipid.SJWTRetOK)
+
+	_, pubKeyTwo := writeDummyECKey(keyPath)
+	modTime := time.Now().Add(time.Minute)
+	os.Chtimes(keyPath, modTime, modTime)
+
+	identity, errCode, _ = secsipid.SJWTGetIdentity("493055555555", "493044444444", "A", "", "", keyPath)
+	expect(errCode).ToBe(secsipid.SJWTRetOK)
+	errCode, _ = secsipid.SJWTCheckFullIdentityPubKey(identity, 60, string(pubKeyTwo))
+	expect(errCode).ToBe(secsipid.SJWTRetOK)
+}
+
+func TestGetIdentityMulti(t *testing.T) {
+	secsipid.SJWTLibOptSetN("CertVerify", 0)
+
+	keyPath := path.Join(t.TempDir(), "ec256-private.pem")
+	_, pubKey := writeDummyECKey(keyPath)
+	verifier := secsipid.NewVerifier(secsipid.VerifierOptions{Expire: 60})
+
+	t.Run("OK with several destination numbers", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		destTNs := []string{"493044444444", "493044445555", "493044446666"}
+		identity, errCode, _ := secsipid.SJWTGetIdentityMulti("493055555555", destTNs, "A", "", "", keyPath)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+
+		res := verifier.CheckFullIdentityPubKeyResult(identity, string(pubKey))
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetOK)
+		expect(res.Payload.Dest.TN).ToEqual(destTNs)
+	})
+
+	t.Run("OK with the private key content", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		prvKeyData, _ := os.ReadFile(keyPath)
+		identity, errCode, _ := secsipid.SJWTGetIdentityMultiPrvKey("493055555555", []string{"493044444444", "493044445555"}, "A", "", "", prvKeyData)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+
+		res := verifier.CheckFullIdentityPubKeyResult(identity, string(pubKey))
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetOK)
+		expect(res.Payload.Dest.TN).ToEqual([]string{"493044444444", "493044445555"})
+	})
+
+	t.Run("Err with no destination number", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, errCode, err := secsipid.SJWTGetIdentityMulti("493055555555", nil, "A", "", "", keyPath)
+		expect(errCode).ToBe(secsipid.SJWTRetErr)
+		expect(err.Error()).ToBe("no destination number")
+	})
+}
+
+func TestParseTNList(t *testing.T) {
+	testCases := map[string][]string{
+		"493044444444":                               {"493044444444"},
+		"493044444444,493044445555":                  {"493044444444", "493044445555"},
+		" 493044444444 ; 493044445555,,493044446666": {"493044444444", "493044445555", "493044446666"},
+		"": {},
+	}
+
+	for tnList, expected := range testCases {
+		t.Run(tnList, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			expect(secsipid.SJWTParseTNList(tnList)).ToEqual(expected)
+		})
+	}
+}
+
+// writeDummyECKey - write a new EC private key to the file, returning the key
+// and the PEM encoded public key
+func writeDummyECKey(keyPath string) (*ecdsa.PrivateKey, []byte) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	privateKeyBytes, _ := x509.MarshalECPrivateKey(privateKey)
+	privateKeyPEM, _ := pemEncode(&pem.Block{
+		Type:  "EC PRIVATE KEY",
+		Bytes: privateKeyBytes,
+	})
+	os.WriteFile(keyPath, privateKeyPEM, 0600)
+
+	publicKeyBytes, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	publicKeyPEM, _ := pemEncode(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	})
+	return privateKey, publicKeyPEM
+}
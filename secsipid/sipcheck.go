@@ -0,0 +1,316 @@
+package secsipid
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SJWTSIPHeaders - values of the SIP request used to check the claims of the
+// PASSporT (RFC 8224 section 6.2), the empty ones being skipped
+type SJWTSIPHeaders struct {
+	// From header value
+	From string
+	// P-Asserted-Identity header value (comma separated list)
+	PAI string
+	// To header value
+	To string
+	// Request-URI
+	RequestURI string
+	// Date header value
+	Date string
+	// Resource-Priority header value (used for the rph PASSporTs)
+	ResourcePriority string
+}
+
+// SIPClaimCheck - result of the check of a claim against the SIP request
+type SIPClaimCheck struct {
+	// true if the SIP request had the values to check the claim
+	Checked bool `json:"checked"`
+	// value of the claim
+	Claim string `json:"claim,omitempty"`
+	// value of the SIP request that matched, or the first one if none matched
+	SIPValue string `json:"sipValue,omitempty"`
+	// SJWTRet* code of the check (SJWTRetOK if matched or not checked)
+	ErrCode int `json:"errCode"`
+}
+
+// SIPCheckResult - results of the checks of the claims against the SIP
+// request
+type SIPCheckResult struct {
+	// orig claim against P-Asserted-Identity, or From if there is none
+	Orig SIPClaimCheck `json:"orig"`
+	// dest claim against To and Request-URI
+	Dest SIPClaimCheck `json:"dest"`
+	// iat claim against Date
+	Date SIPClaimCheck `json:"date"`
+}
+
+// OK - return true if none of the checks failed
+func (r *SIPCheckResult) OK() bool {
+	return r.Orig.ErrCode == SJWTRetOK && r.Dest.ErrCode == SJWTRetOK && r.Date.ErrCode == SJWTRetOK
+}
+
+// status - return the status of the check in text format
+func (c SIPClaimCheck) status() string {
+	switch {
+	case !c.Checked:
+		return "not-checked"
+	case c.ErrCode != SJWTRetOK:
+		return fmt.Sprintf("failed (%d)", c.ErrCode)
+	}
+	return "ok"
+}
+
+// CheckSIPHeaders - check the orig, dest and iat claims of the payload against
+// the values of the SIP request, returning the result of each check and the
+// code of the first failed one
+//
+// The orig claim is checked against the P-Asserted-Identity header if present,
+// otherwise against the From header (RFC 8224 section 6.2.1). The telephone
+// numbers are compared with CompareTN(), in canonical form (RFC 8224 section
+// 8.3) if CanonicalizeTN is set in the verifier options; the URIs are compared
+// without parameters and ignoring the case. The iat must be within DateSkew seconds of
+// the Date header.
+func (v *Verifier) CheckSIPHeaders(payload *SJWTPayload, hdrs SJWTSIPHeaders) (*SIPCheckResult, int, error) {
+	if payload == nil {
+		return nil, SJWTRetErrJSONPayloadParse, newError(SJWTRetErrJSONPayloadParse, "no payload")
+	}
+
+	origHdr := hdrs.From
+	if len(sjwtSIPHeaderURIs(hdrs.PAI)) > 0 {
+		origHdr = hdrs.PAI
+	}
+
+	res := &SIPCheckResult{
+		Orig: v.checkSIPIdentity([]string{payload.Orig.TN}, []string{payload.Orig.URI},
+			[]string{origHdr}, SJWTRetErrJSONPayloadOrig),
+		Dest: v.checkSIPIdentity(payload.Dest.TN, payload.Dest.URI,
+			[]string{hdrs.To, hdrs.RequestURI}, SJWTRetErrJSONPayloadDest),
+		Date: v.checkSIPDate(payload.IAT, hdrs.Date),
+	}
+
+	switch {
+	case res.Orig.ErrCode != SJWTRetOK:
+		return res, res.Orig.ErrCode, newError(res.Orig.ErrCode,
+			fmt.Sprintf("orig claim (%s) not matching the SIP request (%s)", res.Orig.Claim, res.Orig.SIPValue))
+	case res.Dest.ErrCode != SJWTRetOK:
+		return res, res.Dest.ErrCode, newError(res.Dest.ErrCode,
+			fmt.Sprintf("dest claim (%s) not matching the SIP request (%s)", res.Dest.Claim, res.Dest.SIPValue))
+	case res.Date.ErrCode != SJWTRetOK:
+		return res, res.Date.ErrCode, newError(res.Date.ErrCode,
+			fmt.Sprintf("iat claim (%s) not matching the Date header (%s)", res.Date.Claim, res.Date.SIPValue))
+	}
+	return res, SJWTRetOK, nil
+}
+
+// checkSIPIdentity - check if one of the telephone numbers or URIs of the
+// claim matches one of the URIs in the header values
+func (v *Verifier) checkSIPIdentity(tnList []string, uriList []string, hdrVals []string, errCode int) SIPClaimCheck {
+	var claims []string
+	var sipURIs []string
+
+	for _, tn := range tnList {
+		if len(tn) > 0 {
+			claims = append(claims, tn)
+		}
+	}
+	for _, uri := range uriList {
+		if len(uri) > 0 {
+			claims = append(claims, uri)
+		}
+	}
+	for _, hdrVal := range hdrVals {
+		sipURIs = append(sipURIs, sjwtSIPHeaderURIs(hdrVal)...)
+	}
+
+	check := SIPClaimCheck{
+		Claim: strings.Join(claims, ","),
+	}
+	if len(sipURIs) == 0 {
+		return check
+	}
+	check.Checked = true
+
+	for _, sipURI := range sipURIs {
+		user := sjwtSIPURIUser(sipURI)
+		for _, tn := range tnList {
+			if len(tn) > 0 && len(user) > 0 && v.CompareTN(tn, user) {
+				check.SIPValue = sipURI
+				return check
+			}
+		}
+		for _, uri := range uriList {
+			if len(uri) > 0 && strings.EqualFold(sjwtSIPURIBase(uri), sjwtSIPURIBase(sipURI)) {
+				check.SIPValue = sipURI
+				return check
+			}
+		}
+	}
+	check.SIPValue = sipURIs[0]
+	check.ErrCode = errCode
+	return check
+}
+
+// checkSIPDate - check if iat is within the allowed skew of the Date header
+func (v *Verifier) checkSIPDate(iat int64, dateVal string) SIPClaimCheck {
+	check := SIPClaimCheck{
+		Claim:    fmt.Sprintf("%d", iat),
+		SIPValue: strings.TrimSpace(dateVal),
+	}
+	if len(check.SIPValue) == 0 {
+		return check
+	}
+	check.Checked = true
+
+	tDate, err := http.ParseTime(check.SIPValue)
+	if err != nil {
+		check.ErrCode = SJWTRetErrJSONPayloadDate
+		return check
+	}
+	skew := v.opts.DateSkew
+	if skew <= 0 {
+		skew = 60
+	}
+	diff := time.Unix(iat, 0).Sub(tDate)
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > time.Duration(skew)*time.Second {
+		check.ErrCode = SJWTRetErrJSONPayloadDate
+	}
+	return check
+}
+
+// sjwtSIPHeaderURIs - return the URIs of a header value with a comma separated
+// list of name-addr or addr-spec items, or of a Request-URI
+func sjwtSIPHeaderURIs(hdrVal string) []string {
+	var uris []string
+	var item strings.Builder
+
+	inQuotes := false
+	inBrackets := false
+	items := []string{}
+	for _, c := range hdrVal {
+		switch {
+		case c == '"' && !inBrackets:
+			inQuotes = !inQuotes
+		case c == '<' && !inQuotes:
+			inBrackets = true
+		case c == '>' && !inQuotes:
+			inBrackets = false
+		case c == ',' && !inQuotes && !inBrackets:
+			items = append(items, item.String())
+			item.Reset()
+			continue
+		}
+		item.WriteRune(c)
+	}
+	items = append(items, item.String())
+
+	for _, sItem := range items {
+		sItem = strings.TrimSpace(sItem)
+		if lt := strings.Index(sItem, "<"); lt >= 0 {
+			if gt := strings.Index(sItem[lt:], ">"); gt > 0 {
+				sItem = sItem[lt+1 : lt+gt]
+			}
+		} else if sc := strings.Index(sItem, ";"); sc >= 0 && !strings.HasPrefix(strings.ToLower(sItem), "tel:") {
+			// addr-spec - the parameters are header parameters
+			sItem = sItem[:sc]
+		}
+		if len(sItem) > 0 {
+			uris = append(uris, strings.TrimSpace(sItem))
+		}
+	}
+	return uris
+}
+
+// sjwtSIPURIUser - return the user part of a sip, sips or tel URI, without
+// the user parameters
+func sjwtSIPURIUser(uri string) string {
+	lUri := strings.ToLower(uri)
+	switch {
+	case strings.HasPrefix(lUri, "tel:"):
+		uri = uri[4:]
+	case strings.HasPrefix(lUri, "sip:"):
+		uri = uri[4:]
+	case strings.HasPrefix(lUri, "sips:"):
+		uri = uri[5:]
+	default:
+		return ""
+	}
+	if at := strings.LastIndex(uri, "@"); at >= 0 {
+		uri = uri[:at]
+	} else if !strings.HasPrefix(lUri, "tel:") {
+		return ""
+	}
+	if sc := strings.IndexAny(uri, ";?"); sc >= 0 {
+		uri = uri[:sc]
+	}
+	return uri
+}
+
+// sjwtSIPURIBase - return the URI without the parameters and headers
+func sjwtSIPURIBase(uri string) string {
+	uri = strings.TrimSpace(uri)
+	if at := strings.LastIndex(uri, "@"); at >= 0 {
+		if sc := strings.IndexAny(uri[at:], ";?"); sc >= 0 {
+			return uri[:at+sc]
+		}
+		return uri
+	}
+	if sc := strings.IndexAny(uri, ";?"); sc >= 0 {
+		return uri[:sc]
+	}
+	return uri
+}
+
+// CheckFullIdentitySIPResult - like CheckFullIdentityResult, checking also
+// the claims against the values of the SIP request with CheckSIPHeaders();
+// a PASSporT in compact form is rebuilt from the values of the SIP request
+func (v *Verifier) CheckFullIdentitySIPResult(identityVal string, pubkeyPath string, hdrs SJWTSIPHeaders) *VerificationResult {
+	tstart := time.Now()
+	res := &VerificationResult{}
+	sipVerifier := v
+	if SJWTIsCompactIdentity(identityVal) {
+		res.ErrCode, res.Err = v.checkCompactIdentity(identityVal, pubkeyPath, hdrs, res)
+		// the rebuilt claims are the canonical forms of the SIP values
+		opts := v.opts
+		opts.CanonicalizeTN = true
+		sipVerifier = &Verifier{opts: opts}
+	} else {
+		res.ErrCode, res.Err = v.checkFullIdentity(identityVal, pubkeyPath, res)
+	}
+	if res.ErrCode == SJWTRetOK {
+		res.SIP, res.ErrCode, res.Err = sipVerifier.CheckSIPHeaders(res.Payload, hdrs)
+	}
+	res.Elapsed = time.Since(tstart)
+	return res
+}
+
+// CheckSIPMessageResult - verify the first Identity header of the SIP
+// message and check the claims against its headers
+func (v *Verifier) CheckSIPMessageResult(msgData []byte, pubkeyPath string) *VerificationResult {
+	msg, ret, err := SJWTParseSIPMessage(msgData)
+	if err != nil {
+		return &VerificationResult{ErrCode: ret, Err: err}
+	}
+	identityVals := msg.IdentityValues()
+	if len(identityVals) == 0 {
+		return &VerificationResult{ErrCode: SJWTRetErrSIPHdrEmpty, Err: ErrSIPHdrEmpty}
+	}
+	return v.CheckFullIdentitySIPResult(identityVals[0], pubkeyPath, msg.SIPHeaders())
+}
+
+// SJWTCheckFullIdentitySIPResult - verify the Identity header and check the
+// claims against the values of the SIP request
+func SJWTCheckFullIdentitySIPResult(identityVal string, expireVal int, pubkeyPath string, timeoutVal int, hdrs SJWTSIPHeaders) *VerificationResult {
+	return defaultVerifier(expireVal, timeoutVal).CheckFullIdentitySIPResult(identityVal, pubkeyPath, hdrs)
+}
+
+// SJWTCheckSIPMessageResult - verify the Identity header of the SIP message
+// and check the claims against its headers
+func SJWTCheckSIPMessageResult(msgData []byte, expireVal int, pubkeyPath string, timeoutVal int) *VerificationResult {
+	return defaultVerifier(expireVal, timeoutVal).CheckSIPMessageResult(msgData, pubkeyPath)
+}
@@ -0,0 +1,302 @@
+package secsipid_test
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestParseSIPMessage(t *testing.T) {
+	t.Run("OK with compact names and folded headers", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		msg, errCode, _ := secsipid.SJWTParseSIPMessage([]byte("INVITE sip:+15551234567@127.0.0.1 SIP/2.0\r\n" +
+			"f: <sip:+15559876543@127.0.0.1>;tag=abc\r\n" +
+			"t: <sip:+15551234567@127.0.0.1>\r\n" +
+			"Subject: first\r\n" +
+			"  second\r\n" +
+			"y: a.b.c;info=<https://127.0.0.1/cert.pem>\r\n" +
+			"Identity: d.e.f;info=<https://127.0.0.1/cert.pem>\r\n" +
+			"\r\n" +
+			"v=0\r\n"))
+
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		expect(msg.Method).ToBe("INVITE")
+		expect(msg.RequestURI).ToBe("sip:+15551234567@127.0.0.1")
+		expect(msg.Header("From")).ToBe("<sip:+15559876543@127.0.0.1>;tag=abc")
+		expect(msg.Header("subject")).ToBe("first second")
+		expect(msg.HeaderValues("Identity")).ToEqual([]string{
+			"a.b.c;info=<https://127.0.0.1/cert.pem>",
+			"d.e.f;info=<https://127.0.0.1/cert.pem>",
+		})
+		expect(msg.Body).ToBe("v=0\n")
+	})
+
+	t.Run("OK with only headers", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		msg, errCode, _ := secsipid.SJWTParseSIPMessage([]byte("From: <sip:alice@127.0.0.1>\nTo: <sip:bob@127.0.0.1>\n"))
+
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		expect(msg.Method).ToBe("")
+		expect(msg.Header("To")).ToBe("<sip:bob@127.0.0.1>")
+	})
+
+	t.Run("OK with several identities in one Identity header", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		msg, _, _ := secsipid.SJWTParseSIPMessage([]byte("INVITE sip:bob@127.0.0.1 SIP/2.0\r\n" +
+			"Identity: a.b.c;info=<https://127.0.0.1/1.pem>, d.e.f;info=<https://127.0.0.1/2.pem>\r\n" +
+			"y: g.h.i;info=<https://127.0.0.1/3.pem>\r\n\r\n"))
+
+		expect(msg.IdentityValues()).ToEqual([]string{
+			"a.b.c;info=<https://127.0.0.1/1.pem>",
+			"d.e.f;info=<https://127.0.0.1/2.pem>",
+			"g.h.i;info=<https://127.0.0.1/3.pem>",
+		})
+	})
+
+	t.Run("ErrSIPMsgParse with invalid header line", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, errCode, _ := secsipid.SJWTParseSIPMessage([]byte("INVITE sip:bob@127.0.0.1 SIP/2.0\r\nno header\r\n"))
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrSIPMsgParse)
+	})
+
+	t.Run("ErrSIPMsgParse with empty message", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, errCode, _ := secsipid.SJWTParseSIPMessage([]byte("\r\n"))
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrSIPMsgParse)
+	})
+}
+
+type CheckSIPHeadersTest struct {
+	payload         secsipid.SJWTPayload
+	hdrs            secsipid.SJWTSIPHeaders
+	expectedErrCode int
+	expectedOrig    secsipid.SIPClaimCheck
+}
+
+func TestCheckSIPHeaders(t *testing.T) {
+	iat := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC).Unix()
+	payload := secsipid.SJWTPayload{
+		Dest: secsipid.SJWTDest{TN: []string{"15551234567"}},
+		IAT:  iat,
+		Orig: secsipid.SJWTOrig{TN: "15559876543"},
+	}
+	verifier := secsipid.NewVerifier(secsipid.VerifierOptions{CanonicalizeTN: true, CountryCode: "1"})
+
+	testCases := map[string]CheckSIPHeadersTest{
+		"OK with From and To": {
+			payload: payload,
+			hdrs: secsipid.SJWTSIPHeaders{
+				From: "\"Alice\" <sip:+1-555-987-6543@127.0.0.1;user=phone>;tag=abc",
+				To:   "<tel:+15551234567>",
+				Date: "Tue, 01 Jun 2021 10:00:30 GMT",
+			},
+			expectedErrCode: secsipid.SJWTRetOK,
+			expectedOrig: secsipid.SIPClaimCheck{
+				Checked:  true,
+				Claim:    "15559876543",
+				SIPValue: "sip:+1-555-987-6543@127.0.0.1;user=phone",
+			},
+		},
+		"OK with P-Asserted-Identity and national numbers": {
+			payload: payload,
+			hdrs: secsipid.SJWTSIPHeaders{
+				From:       "<sip:anonymous@anonymous.invalid>",
+				PAI:        "<sip:5559876543@127.0.0.1>, <tel:+15550000000>",
+				RequestURI: "sip:5551234567@127.0.0.1;user=phone",
+			},
+			expectedErrCode: secsipid.SJWTRetOK,
+			expectedOrig: secsipid.SIPClaimCheck{
+				Checked:  true,
+				Claim:    "15559876543",
+				SIPValue: "sip:5559876543@127.0.0.1",
+			},
+		},
+		"ErrJSONPayloadOrig with mismatching P-Asserted-Identity and matching From": {
+			payload: payload,
+			hdrs: secsipid.SJWTSIPHeaders{
+				From: "<sip:+15559876543@127.0.0.1>;tag=abc",
+				PAI:  "<sip:+15550000000@127.0.0.1>",
+				To:   "<tel:+15551234567>",
+			},
+			expectedErrCode: secsipid.SJWTRetErrJSONPayloadOrig,
+			expectedOrig: secsipid.SIPClaimCheck{
+				Checked:  true,
+				Claim:    "15559876543",
+				SIPValue: "sip:+15550000000@127.0.0.1",
+				ErrCode:  secsipid.SJWTRetErrJSONPayloadOrig,
+			},
+		},
+		"OK with no SIP values to check": {
+			payload:         payload,
+			hdrs:            secsipid.SJWTSIPHeaders{},
+			expectedErrCode: secsipid.SJWTRetOK,
+			expectedOrig: secsipid.SIPClaimCheck{
+				Claim: "15559876543",
+			},
+		},
+		"OK with uri claims": {
+			payload: secsipid.SJWTPayload{
+				Dest: secsipid.SJWTDest{URI: []string{"sip:bob@example.com"}},
+				Orig: secsipid.SJWTOrig{URI: "sip:alice@example.com"},
+			},
+			hdrs: secsipid.SJWTSIPHeaders{
+				From: "<sip:Alice@Example.com;transport=tcp>;tag=1",
+				To:   "sip:bob@example.com",
+			},
+			expectedErrCode: secsipid.SJWTRetOK,
+			expectedOrig: secsipid.SIPClaimCheck{
+				Checked:  true,
+				Claim:    "sip:alice@example.com",
+				SIPValue: "sip:Alice@Example.com;transport=tcp",
+			},
+		},
+		"ErrJSONPayloadOrig with mismatching From": {
+			payload: payload,
+			hdrs: secsipid.SJWTSIPHeaders{
+				From: "<sip:+15550000000@127.0.0.1>;tag=abc",
+				To:   "<sip:+15551234567@127.0.0.1>",
+			},
+			expectedErrCode: secsipid.SJWTRetErrJSONPayloadOrig,
+			expectedOrig: secsipid.SIPClaimCheck{
+				Checked:  true,
+				Claim:    "15559876543",
+				SIPValue: "sip:+15550000000@127.0.0.1",
+				ErrCode:  secsipid.SJWTRetErrJSONPayloadOrig,
+			},
+		},
+		"ErrJSONPayloadDest with mismatching To and Request-URI": {
+			payload: payload,
+			hdrs: secsipid.SJWTSIPHeaders{
+				To:         "<sip:+15550000000@127.0.0.1>",
+				RequestURI: "sip:+15550000001@127.0.0.1",
+			},
+			expectedErrCode: secsipid.SJWTRetErrJSONPayloadDest,
+			expectedOrig: secsipid.SIPClaimCheck{
+				Claim: "15559876543",
+			},
+		},
+		"ErrJSONPayloadDate with stale Date": {
+			payload: payload,
+			hdrs: secsipid.SJWTSIPHeaders{
+				Date: "Tue, 01 Jun 2021 10:01:01 GMT",
+			},
+			expectedErrCode: secsipid.SJWTRetErrJSONPayloadDate,
+			expectedOrig: secsipid.SIPClaimCheck{
+				Claim: "15559876543",
+			},
+		},
+		"ErrJSONPayloadDate with invalid Date": {
+			payload: payload,
+			hdrs: secsipid.SJWTSIPHeaders{
+				Date: "yesterday",
+			},
+			expectedErrCode: secsipid.SJWTRetErrJSONPayloadDate,
+			expectedOrig: secsipid.SIPClaimCheck{
+				Claim: "15559876543",
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			res, errCode, err := verifier.CheckSIPHeaders(&testCase.payload, testCase.hdrs)
+
+			expect(errCode).ToBe(testCase.expectedErrCode)
+			expect(secsipid.SJWTErrorCode(err)).ToBe(testCase.expectedErrCode)
+			expect(res.OK()).ToBe(testCase.expectedErrCode == secsipid.SJWTRetOK)
+			expect(res.Orig).ToEqual(testCase.expectedOrig)
+		})
+	}
+
+	t.Run("ErrJSONPayloadOrig with E.164 From without CanonicalizeTN", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		hdrs := secsipid.SJWTSIPHeaders{
+			From: "<sip:+15559876543@127.0.0.1>;tag=abc",
+		}
+		exactVerifier := secsipid.NewVerifier(secsipid.VerifierOptions{CountryCode: "1"})
+
+		_, errCode, _ := exactVerifier.CheckSIPHeaders(&payload, hdrs)
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadOrig)
+
+		hdrs.From = "<sip:15559876543@127.0.0.1>;tag=abc"
+		_, errCode, _ = exactVerifier.CheckSIPHeaders(&payload, hdrs)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+
+		hdrs.From = "<sip:+15559876543@127.0.0.1>;tag=abc"
+		_, errCode, _ = verifier.CheckSIPHeaders(&payload, hdrs)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+	})
+}
+
+func TestCheckSIPMessageResult(t *testing.T) {
+	keyPath := path.Join(t.TempDir(), "ec256-private.pem")
+	_, pubKey := writeDummyECKey(keyPath)
+	pubKeyPath := path.Join(t.TempDir(), "ec256-public.pem")
+	os.WriteFile(pubKeyPath, pubKey, 0600)
+
+	now := time.Now()
+	signer, _, _ := secsipid.NewSigner(secsipid.SignerOptions{
+		PrvKeyPath: keyPath,
+		X5u:        "https://127.0.0.1/cert.pem",
+		Now:        func() time.Time { return now },
+	})
+	identity, _, _ := signer.Sign("15559876543", []string{"15551234567"}, "A", "")
+	verifier := secsipid.NewVerifier(secsipid.VerifierOptions{Expire: 60, CanonicalizeTN: true})
+
+	buildMsg := func(from string) []byte {
+		return []byte(strings.Join([]string{
+			"INVITE sip:+15551234567@127.0.0.1 SIP/2.0",
+			"From: " + from,
+			"To: <sip:+15551234567@127.0.0.1>",
+			"Date: " + now.UTC().Format(http.TimeFormat),
+			"Identity: " + identity,
+			"", "",
+		}, "\r\n"))
+	}
+
+	t.Run("OK with matching headers", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		res := verifier.CheckSIPMessageResult(buildMsg("<sip:+15559876543@127.0.0.1>;tag=1"), pubKeyPath)
+
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetOK)
+		expect(res.SIP.Orig.Checked).ToBe(true)
+		expect(res.SIP.Dest.Checked).ToBe(true)
+		expect(res.SIP.Date.Checked).ToBe(true)
+		expect(strings.Contains(res.String(), "sip-orig: ok\n")).ToBe(true)
+	})
+
+	t.Run("ErrJSONPayloadOrig with mismatching From", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		res := verifier.CheckSIPMessageResult(buildMsg("<sip:+15550000000@127.0.0.1>;tag=1"), pubKeyPath)
+
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetErrJSONPayloadOrig)
+		expect(res.SIP.Orig.ErrCode).ToBe(secsipid.SJWTRetErrJSONPayloadOrig)
+		expect(res.SIP.Dest.ErrCode).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("ErrSIPHdrEmpty without Identity header", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		res := verifier.CheckSIPMessageResult([]byte("INVITE sip:bob@127.0.0.1 SIP/2.0\r\nFrom: <sip:alice@127.0.0.1>\r\n\r\n"), pubKeyPath)
+
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetErrSIPHdrEmpty)
+	})
+}
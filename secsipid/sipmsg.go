@@ -0,0 +1,165 @@
+package secsipid
+
+import (
+	"strings"
+)
+
+// SJWTSIPHeader - header of a SIP message
+type SJWTSIPHeader struct {
+	// header name in full form (e.g., "From" for "f")
+	Name string
+	// header value, with the folded lines joined
+	Value string
+}
+
+// SJWTSIPMessage - SIP message split in first line, headers and body
+type SJWTSIPMessage struct {
+	// request method (empty for replies)
+	Method string
+	// request URI (empty for replies)
+	RequestURI string
+	// headers, in the order of the message
+	Headers []SJWTSIPHeader
+	// message body
+	Body string
+}
+
+// sipCompactHeaders - full names of the compact header names (RFC 3261,
+// RFC 8224 and other SIP extensions)
+var sipCompactHeaders = map[string]string{
+	"a": "Accept-Contact",
+	"b": "Referred-By",
+	"c": "Content-Type",
+	"d": "Request-Disposition",
+	"e": "Content-Encoding",
+	"f": "From",
+	"i": "Call-ID",
+	"j": "Reject-Contact",
+	"k": "Supported",
+	"l": "Content-Length",
+	"m": "Contact",
+	"o": "Event",
+	"r": "Refer-To",
+	"s": "Subject",
+	"t": "To",
+	"u": "Allow-Events",
+	"v": "Via",
+	"x": "Session-Expires",
+	"y": "Identity",
+}
+
+// SJWTParseSIPMessage - parse the SIP message, expanding the compact header
+// names and joining the folded header lines
+//
+// The first line can be missing, the content being then only the headers
+// (and the body). The lines can end with CRLF or LF.
+func SJWTParseSIPMessage(data []byte) (*SJWTSIPMessage, int, error) {
+	msg := &SJWTSIPMessage{}
+
+	sData := strings.Replace(string(data), "\r\n", "\n", -1)
+	sData = strings.TrimLeft(sData, "\n")
+	if len(strings.TrimSpace(sData)) == 0 {
+		return nil, SJWTRetErrSIPMsgParse, newError(SJWTRetErrSIPMsgParse, "empty SIP message")
+	}
+
+	hdrsData := sData
+	if eoh := strings.Index(sData, "\n\n"); eoh >= 0 {
+		hdrsData = sData[:eoh]
+		msg.Body = sData[eoh+2:]
+	}
+	lines := strings.Split(hdrsData, "\n")
+
+	// first line - request or status line
+	tokens := strings.Fields(lines[0])
+	if len(tokens) >= 2 && strings.HasPrefix(tokens[0], "SIP/") {
+		lines = lines[1:]
+	} else if len(tokens) == 3 && strings.HasPrefix(tokens[2], "SIP/") {
+		msg.Method = tokens[0]
+		msg.RequestURI = tokens[1]
+		lines = lines[1:]
+	}
+
+	for _, line := range lines {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			// folded line - continuation of the previous header value
+			if len(msg.Headers) == 0 {
+				return nil, SJWTRetErrSIPMsgParse, newError(SJWTRetErrSIPMsgParse, "folded line without header")
+			}
+			hdr := &msg.Headers[len(msg.Headers)-1]
+			hdr.Value = strings.TrimSpace(hdr.Value + " " + strings.TrimSpace(line))
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			return nil, SJWTRetErrSIPMsgParse, newError(SJWTRetErrSIPMsgParse, "invalid header line: "+line)
+		}
+		name := strings.TrimSpace(line[:colon])
+		if fullName, ok := sipCompactHeaders[strings.ToLower(name)]; ok {
+			name = fullName
+		}
+		msg.Headers = append(msg.Headers, SJWTSIPHeader{
+			Name:  name,
+			Value: strings.TrimSpace(line[colon+1:]),
+		})
+	}
+
+	return msg, SJWTRetOK, nil
+}
+
+// HeaderValues - return the values of the headers with the name (case
+// insensitive, full form)
+func (m *SJWTSIPMessage) HeaderValues(name string) []string {
+	var values []string
+	for _, hdr := range m.Headers {
+		if strings.EqualFold(hdr.Name, name) {
+			values = append(values, hdr.Value)
+		}
+	}
+	return values
+}
+
+// IdentityValues - return the values of the Identity headers, a header
+// with several comma separated identities giving a value for each of them
+func (m *SJWTSIPMessage) IdentityValues() []string {
+	var values []string
+	for _, hdrVal := range m.HeaderValues("Identity") {
+		hdrs, _, err := SJWTParseIdentityHeaders(hdrVal)
+		if err != nil || len(hdrs) == 1 {
+			// invalid values are left to be reported by the checks
+			values = append(values, hdrVal)
+			continue
+		}
+		for _, hdr := range hdrs {
+			values = append(values, hdr.String())
+		}
+	}
+	return values
+}
+
+// Header - return the value of the first header with the name, empty if
+// the message has no such header
+func (m *SJWTSIPMessage) Header(name string) string {
+	for _, hdr := range m.Headers {
+		if strings.EqualFold(hdr.Name, name) {
+			return hdr.Value
+		}
+	}
+	return ""
+}
+
+// SIPHeaders - return the values of the message used to check the claims
+// of the PASSporT
+func (m *SJWTSIPMessage) SIPHeaders() SJWTSIPHeaders {
+	return SJWTSIPHeaders{
+		From:       m.Header("From"),
+		PAI:        strings.Join(m.HeaderValues("P-Asserted-Identity"), ", "),
+		To:         m.Header("To"),
+		RequestURI: m.RequestURI,
+		Date:       m.Header("Date"),
+		// several headers are equivalent to a comma separated list
+		ResourcePriority: strings.Join(m.HeaderValues("Resource-Priority"), ", "),
+	}
+}
@@ -0,0 +1,82 @@
+package secsipid
+
+import (
+	"fmt"
+)
+
+// SIP response codes for verification failures (RFC 8224, ATIS-1000074)
+const (
+	SIPRespStaleDate           = 403
+	SIPRespUseIdentityHeader   = 428
+	SIPRespBadIdentityInfo     = 436
+	SIPRespUnsupportedCred     = 437
+	SIPRespInvalidIdentityHdr  = 438
+	SIPRespServerInternalError = 500
+)
+
+// sipResponseTexts - reason phrases for the SIP response codes
+var sipResponseTexts = map[int]string{
+	SIPRespStaleDate:           "Stale Date",
+	SIPRespUseIdentityHeader:   "Use Identity Header",
+	SIPRespBadIdentityInfo:     "Bad Identity Info",
+	SIPRespUnsupportedCred:     "Unsupported Credential",
+	SIPRespInvalidIdentityHdr:  "Invalid Identity Header",
+	SIPRespServerInternalError: "Server Internal Error",
+}
+
+// SJWTGetSIPResponse - return the SIP response code and reason phrase for the
+// SJWTRet* error code of a verification, 0 and empty reason for SJWTRetOK
+func SJWTGetSIPResponse(errCode int) (int, string) {
+	var code int
+
+	switch errCode {
+	case SJWTRetOK:
+		return 0, ""
+	case SJWTRetErrSIPHdrEmpty, SJWTRetErrSIPHdrPolicy:
+		code = SIPRespUseIdentityHeader
+	case SJWTRetErrSIPHdrInfo, SJWTRetErrJSONHdrX5u, SJWTRetErrFileRead:
+		code = SIPRespBadIdentityInfo
+	case SJWTRetErrJSONPayloadIATExpired, SJWTRetErrJSONPayloadIATFuture, SJWTRetErrJSONPayloadDate:
+		code = SIPRespStaleDate
+	case SJWTRetErrPrvKeyInvalid, SJWTRetErrPrvKeyInvalidFormat,
+		SJWTRetErrPrvKeyInvalidEC, SJWTRetErrJSONSignatureHashing,
+		SJWTRetErrJSONSignatureFailure:
+		// signing side or local failures
+		code = SIPRespServerInternalError
+	default:
+		switch SJWTErrorCategory(errCode) {
+		case ErrCategoryCert:
+			code = SIPRespUnsupportedCred
+		case ErrCategoryHTTP:
+			code = SIPRespBadIdentityInfo
+		default:
+			code = SIPRespInvalidIdentityHdr
+		}
+	}
+	return code, sipResponseTexts[code]
+}
+
+// SJWTGetReasonHeader - return the Reason header for the SJWTRet* error code
+// of a verification, empty string for SJWTRetOK
+func SJWTGetReasonHeader(errCode int) string {
+	code, text := SJWTGetSIPResponse(errCode)
+	if code == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Reason: STIR;cause=%d;text=\"%s\"", code, text)
+}
+
+// SIPResponse - return the SIP response code and reason phrase for the result
+func (r *VerificationResult) SIPResponse() (int, string) {
+	return SJWTGetSIPResponse(r.ErrCode)
+}
+
+// ReasonHeader - return the Reason header for the result
+func (r *VerificationResult) ReasonHeader() string {
+	return SJWTGetReasonHeader(r.ErrCode)
+}
+
+// SIPResponse - return the SIP response code and reason phrase for the error
+func (e *Error) SIPResponse() (int, string) {
+	return SJWTGetSIPResponse(e.Code)
+}
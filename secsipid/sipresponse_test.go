@@ -0,0 +1,94 @@
+package secsipid_test
+
+import (
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+type SIPResponseTest struct {
+	errCode int
+
+	expectedCode   int
+	expectedText   string
+	expectedReason string
+}
+
+func TestGetSIPResponse(t *testing.T) {
+	runTest := func(t *testing.T, testCase SIPResponseTest) {
+		expect := expectate.Expect(t)
+
+		code, text := secsipid.SJWTGetSIPResponse(testCase.errCode)
+
+		expect(code).ToBe(testCase.expectedCode)
+		expect(text).ToBe(testCase.expectedText)
+		expect(secsipid.SJWTGetReasonHeader(testCase.errCode)).ToBe(testCase.expectedReason)
+	}
+
+	testCases := map[string]SIPResponseTest{
+		"No response for OK": {
+			errCode: secsipid.SJWTRetOK,
+		},
+		"428 for empty identity header": {
+			errCode:        secsipid.SJWTRetErrSIPHdrEmpty,
+			expectedCode:   428,
+			expectedText:   "Use Identity Header",
+			expectedReason: `Reason: STIR;cause=428;text="Use Identity Header"`,
+		},
+		"436 for invalid info parameter": {
+			errCode:        secsipid.SJWTRetErrSIPHdrInfo,
+			expectedCode:   436,
+			expectedText:   "Bad Identity Info",
+			expectedReason: `Reason: STIR;cause=436;text="Bad Identity Info"`,
+		},
+		"436 for http failure": {
+			errCode:        secsipid.SJWTRetErrHTTPStatusCode,
+			expectedCode:   436,
+			expectedText:   "Bad Identity Info",
+			expectedReason: `Reason: STIR;cause=436;text="Bad Identity Info"`,
+		},
+		"437 for untrusted certificate": {
+			errCode:        secsipid.SJWTRetErrCertInvalid,
+			expectedCode:   437,
+			expectedText:   "Unsupported Credential",
+			expectedReason: `Reason: STIR;cause=437;text="Unsupported Credential"`,
+		},
+		"437 for revoked certificate": {
+			errCode:        secsipid.SJWTRetErrCertRevoked,
+			expectedCode:   437,
+			expectedText:   "Unsupported Credential",
+			expectedReason: `Reason: STIR;cause=437;text="Unsupported Credential"`,
+		},
+		"438 for invalid signature": {
+			errCode:        secsipid.SJWTRetErrJSONSignatureInvalid,
+			expectedCode:   438,
+			expectedText:   "Invalid Identity Header",
+			expectedReason: `Reason: STIR;cause=438;text="Invalid Identity Header"`,
+		},
+		"438 for invalid ppt parameter": {
+			errCode:        secsipid.SJWTRetErrSIPHdrPpt,
+			expectedCode:   438,
+			expectedText:   "Invalid Identity Header",
+			expectedReason: `Reason: STIR;cause=438;text="Invalid Identity Header"`,
+		},
+		"403 for expired token": {
+			errCode:        secsipid.SJWTRetErrJSONPayloadIATExpired,
+			expectedCode:   403,
+			expectedText:   "Stale Date",
+			expectedReason: `Reason: STIR;cause=403;text="Stale Date"`,
+		},
+		"403 for token issued in the future": {
+			errCode:        secsipid.SJWTRetErrJSONPayloadIATFuture,
+			expectedCode:   403,
+			expectedText:   "Stale Date",
+			expectedReason: `Reason: STIR;cause=403;text="Stale Date"`,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			runTest(t, testCase)
+		})
+	}
+}
@@ -15,10 +15,12 @@ package secsipid
 
 import (
 	"crypto/x509"
+	"encoding/pem"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 const (
@@ -49,29 +51,49 @@ var certDirectories = []string{
 }
 
 var systemCertPool *x509.CertPool = nil
+var systemCertList []*x509.Certificate = nil
+var systemCertPoolMu sync.Mutex
 
 func SystemCertPool() (*x509.CertPool, error) {
-	if systemCertPool != nil {
-		return systemCertPool, nil
-	}
-	systemRoots, err := loadSystemRoots()
-	if err != nil {
-		return nil, err
-	}
-	systemCertPool = systemRoots
-	return systemCertPool, nil
+	pool, _, err := systemRoots()
+	return pool, err
 }
 
 func ResetSystemCertPool() {
+	systemCertPoolMu.Lock()
+	defer systemCertPoolMu.Unlock()
 	systemCertPool = nil
+	systemCertList = nil
+}
+
+// systemRoots returns the shared system pool together with its certificates,
+// the latter being used to build new pools that include custom CAs, because
+// the shared pool must not be modified.
+func systemRoots() (*x509.CertPool, []*x509.Certificate, error) {
+	systemCertPoolMu.Lock()
+	defer systemCertPoolMu.Unlock()
+	if systemCertPool != nil {
+		return systemCertPool, systemCertList, nil
+	}
+	systemCerts, err := loadSystemRoots()
+	if err != nil {
+		return nil, nil, err
+	}
+	roots := x509.NewCertPool()
+	for _, cert := range systemCerts {
+		roots.AddCert(cert)
+	}
+	systemCertPool = roots
+	systemCertList = systemCerts
+	return systemCertPool, systemCertList, nil
 }
 
 // On Unix systems other than macOS the environment variables SSL_CERT_FILE and
 // SSL_CERT_DIR can be used to override the system default locations for the SSL
 // certificate file and SSL certificate files directory, respectively. The
 // latter can be a colon-separated list.
-func loadSystemRoots() (*x509.CertPool, error) {
-	roots := x509.NewCertPool()
+func loadSystemRoots() ([]*x509.Certificate, error) {
+	var roots []*x509.Certificate
 
 	files := certFiles
 	if f := os.Getenv(certFileEnv); f != "" {
@@ -82,7 +104,7 @@ func loadSystemRoots() (*x509.CertPool, error) {
 	for _, file := range files {
 		data, err := os.ReadFile(file)
 		if err == nil {
-			roots.AppendCertsFromPEM(data)
+			roots = appendCertsFromPEM(roots, data)
 			break
 		}
 		if firstErr == nil && !os.IsNotExist(err) {
@@ -110,18 +132,40 @@ func loadSystemRoots() (*x509.CertPool, error) {
 		for _, fi := range fis {
 			data, err := os.ReadFile(directory + "/" + fi.Name())
 			if err == nil {
-				roots.AppendCertsFromPEM(data)
+				roots = appendCertsFromPEM(roots, data)
 			}
 		}
 	}
 
-	if len(roots.Subjects()) > 0 || firstErr == nil {
+	if len(roots) > 0 || firstErr == nil {
 		return roots, nil
 	}
 
 	return nil, firstErr
 }
 
+// appendCertsFromPEM is like CertPool.AppendCertsFromPEM, but collects the
+// parsed certificates in a slice.
+func appendCertsFromPEM(certs []*x509.Certificate, pemCerts []byte) []*x509.Certificate {
+	for len(pemCerts) > 0 {
+		var block *pem.Block
+		block, pemCerts = pem.Decode(pemCerts)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" || len(block.Headers) != 0 {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
 // readUniqueDirectoryEntries is like os.ReadDir but omits
 // symlinks that point within the directory.
 func readUniqueDirectoryEntries(dir string) ([]fs.DirEntry, error) {
@@ -0,0 +1,77 @@
+package secsipid
+
+import (
+	"strings"
+)
+
+// SJWTCanonicalizeTN - return the canonical form of the telephone number,
+// following RFC 8224 section 8.3
+//
+// The visual separators (space, '-', '.', '(', ')') and the leading '+' are
+// removed. When countryCode is set, a number that is not in E.164 form (no
+// leading '+') is converted to it: the international prefix '00' is removed,
+// the national prefix '0' is replaced by the country code and the country
+// code is added if the number does not start with it.
+//
+// A number without prefix starting with the digits of the country code is
+// taken as an E.164 number without '+' (the form used in the PASSporT claims),
+// so a national number whose leading digits are the country code is left
+// unchanged (e.g., "4912345678" with the country code "49"). Such numbers
+// have to be given with the national prefix '0' or in E.164 form with '+'.
+func SJWTCanonicalizeTN(tn string, countryCode string) string {
+	var sb strings.Builder
+
+	for _, c := range strings.TrimSpace(tn) {
+		switch c {
+		case ' ', '\t', '-', '.', '(', ')':
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	ctn := sb.String()
+
+	if strings.HasPrefix(ctn, "+") {
+		return ctn[1:]
+	}
+	countryCode = strings.TrimPrefix(strings.TrimSpace(countryCode), "+")
+	if len(countryCode) == 0 || len(ctn) == 0 {
+		return ctn
+	}
+	if strings.HasPrefix(ctn, "00") {
+		return ctn[2:]
+	}
+	if strings.HasPrefix(ctn, "0") {
+		return countryCode + ctn[1:]
+	}
+	if !strings.HasPrefix(ctn, countryCode) {
+		return countryCode + ctn
+	}
+	return ctn
+}
+
+// SJWTCompareTN - return true if the telephone numbers have the same
+// canonical form
+func SJWTCompareTN(tn1 string, tn2 string, countryCode string) bool {
+	return SJWTCanonicalizeTN(tn1, countryCode) == SJWTCanonicalizeTN(tn2, countryCode)
+}
+
+// CompareTN - return true if the telephone numbers match, comparing their
+// canonical forms if CanonicalizeTN is set in the verifier options
+func (v *Verifier) CompareTN(tn1 string, tn2 string) bool {
+	if v.opts.CanonicalizeTN {
+		return SJWTCompareTN(tn1, tn2, v.opts.CountryCode)
+	}
+	return tn1 == tn2
+}
+
+// sjwtCanonicalTNs - return the canonical forms of the telephone numbers
+func sjwtCanonicalTNs(tnList []string, countryCode string) []string {
+	if tnList == nil {
+		return nil
+	}
+	ctns := make([]string, len(tnList))
+	for i, tn := range tnList {
+		ctns[i] = SJWTCanonicalizeTN(tn, countryCode)
+	}
+	return ctns
+}
@@ -0,0 +1,185 @@
+package secsipid_test
+
+import (
+	"path"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+type CanonicalizeTNTest struct {
+	tn          string
+	countryCode string
+	expected    string
+}
+
+func TestCanonicalizeTN(t *testing.T) {
+	testCases := map[string]CanonicalizeTNTest{
+		"E.164 with visual separators": {
+			tn:       "+1 (555) 123-4567",
+			expected: "15551234567",
+		},
+		"E.164 with dots": {
+			tn:          "+49.30.4444.8888",
+			countryCode: "1",
+			expected:    "493044448888",
+		},
+		"Digits only without country code": {
+			tn:       "15551234567",
+			expected: "15551234567",
+		},
+		"Digits only starting with the country code": {
+			tn:          "15551234567",
+			countryCode: "1",
+			expected:    "15551234567",
+		},
+		"National number without prefix": {
+			tn:          "(555) 123-4567",
+			countryCode: "1",
+			expected:    "15551234567",
+		},
+		"National number with prefix 0": {
+			tn:          "030 4444 8888",
+			countryCode: "+49",
+			expected:    "493044448888",
+		},
+		"International prefix 00": {
+			tn:          "0049 30 4444 8888",
+			countryCode: "1",
+			expected:    "493044448888",
+		},
+		"National number starting with the country code taken as E.164": {
+			tn:          "491 2345 678",
+			countryCode: "49",
+			expected:    "4912345678",
+		},
+		"National number starting with the country code with prefix 0": {
+			tn:          "0491 2345 678",
+			countryCode: "49",
+			expected:    "494912345678",
+		},
+		"E.164 with national number starting with the country code": {
+			tn:          "+49 491 2345 678",
+			countryCode: "49",
+			expected:    "494912345678",
+		},
+		"National number with prefix 0 without country code": {
+			tn:       "030-4444-8888",
+			expected: "03044448888",
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			expect(secsipid.SJWTCanonicalizeTN(testCase.tn, testCase.countryCode)).ToBe(testCase.expected)
+		})
+	}
+}
+
+func TestCompareTN(t *testing.T) {
+	t.Run("SJWTCompareTN matches the canonical forms", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(secsipid.SJWTCompareTN("+1 (555) 123-4567", "15551234567", "")).ToBe(true)
+		expect(secsipid.SJWTCompareTN("555-123-4567", "+15551234567", "1")).ToBe(true)
+		expect(secsipid.SJWTCompareTN("+15551234567", "+15551234568", "1")).ToBe(false)
+	})
+
+	t.Run("Verifier compares exact values by default", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		verifier := secsipid.NewVerifier(secsipid.VerifierOptions{})
+
+		expect(verifier.CompareTN("+15551234567", "15551234567")).ToBe(false)
+		expect(verifier.CompareTN("15551234567", "15551234567")).ToBe(true)
+	})
+
+	t.Run("Verifier compares canonical forms with CanonicalizeTN", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+			CanonicalizeTN: true,
+			CountryCode:    "1",
+		})
+
+		expect(verifier.CompareTN("+1 555 123 4567", "5551234567")).ToBe(true)
+	})
+
+	t.Run("Div chain with canonical comparison", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		payload := &secsipid.SJWTPayload{
+			Dest: secsipid.SJWTDest{TN: []string{"+1 555 123 4567"}},
+			Orig: secsipid.SJWTOrig{TN: "15559876543"},
+		}
+		divPayloads := []*secsipid.SJWTDivPayload{{
+			Dest: secsipid.SJWTDest{TN: []string{"15551110000"}},
+			Div:  secsipid.SJWTDiv{TN: "15551234567"},
+			Orig: secsipid.SJWTOrig{TN: "+1-555-987-6543"},
+		}}
+
+		errCode, _ := secsipid.NewVerifier(secsipid.VerifierOptions{}).CheckDivChain(payload, divPayloads)
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadDivChain)
+
+		errCode, _ = secsipid.NewVerifier(secsipid.VerifierOptions{CanonicalizeTN: true}).CheckDivChain(payload, divPayloads)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+	})
+}
+
+func TestSignCanonicalTN(t *testing.T) {
+	keyPath := path.Join(t.TempDir(), "ec256-private.pem")
+	_, pubKey := writeDummyECKey(keyPath)
+	verifier := secsipid.NewVerifier(secsipid.VerifierOptions{Expire: 60})
+
+	t.Run("Signer sets the canonical forms", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		signer, _, _ := secsipid.NewSigner(secsipid.SignerOptions{
+			PrvKeyPath:     keyPath,
+			X5u:            "https://127.0.0.1/cert.pem",
+			CanonicalizeTN: true,
+			CountryCode:    "1",
+		})
+
+		identity, errCode, _ := signer.Sign("+1 (555) 123-4567", []string{"555.987.6543"}, "A", "")
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+
+		res := verifier.CheckFullIdentityPubKeyResult(identity, string(pubKey))
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetOK)
+		expect(res.Payload.Orig.TN).ToBe("15551234567")
+		expect(res.Payload.Dest.TN).ToEqual([]string{"15559876543"})
+	})
+
+	t.Run("Numbers are kept verbatim by default", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identity, errCode, _ := secsipid.SJWTGetIdentityOpts(secsipid.SJWTIdentityOptions{
+			OrigTN:  "+1 (555) 123-4567",
+			DestTNs: []string{"15559876543"},
+			Attest:  "A",
+		}, keyPath)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+
+		res := verifier.CheckFullIdentityPubKeyResult(identity, string(pubKey))
+		expect(res.Payload.Orig.TN).ToBe("+1 (555) 123-4567")
+	})
+
+	t.Run("Library options enable the canonical forms", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("TNCanonicalize", 1)
+		secsipid.SJWTLibOptSetS("TNCountryCode", "49")
+		defer secsipid.SJWTLibOptSetN("TNCanonicalize", 0)
+		defer secsipid.SJWTLibOptSetS("TNCountryCode", "")
+
+		identity, errCode, _ := secsipid.SJWTGetIdentity("030 4444 8888", "+49 30 5555 9999", "A", "", "", keyPath)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+
+		res := verifier.CheckFullIdentityPubKeyResult(identity, string(pubKey))
+		expect(res.Payload.Orig.TN).ToBe("493044448888")
+		expect(res.Payload.Dest.TN).ToEqual([]string{"493055559999"})
+	})
+}
@@ -0,0 +1,281 @@
+package secsipid
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"strconv"
+	"strings"
+)
+
+// SJWTOIDTNAuthList - OID of the TNAuthList certificate extension (RFC 8226)
+var SJWTOIDTNAuthList = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 26}
+
+// TNRange - range of telephone numbers of the TNAuthList
+type TNRange struct {
+	// first telephone number of the range
+	Start string `json:"start"`
+	// number of telephone numbers in the range
+	Count int `json:"count"`
+}
+
+// TNAuthList - entries of the TNAuthList certificate extension (RFC 8226
+// section 9), in the order of the certificate
+type TNAuthList struct {
+	// service provider codes
+	SPCs []string `json:"spc,omitempty"`
+	// ranges of telephone numbers
+	Ranges []TNRange `json:"range,omitempty"`
+	// single telephone numbers
+	TNs []string `json:"one,omitempty"`
+}
+
+// tnAuthListRange - ASN.1 structure of the TelephoneNumberRange
+type tnAuthListRange struct {
+	Start string `asn1:"ia5"`
+	Count int
+}
+
+// SJWTParseTNAuthList - parse the DER value of the TNAuthList certificate
+// extension
+func SJWTParseTNAuthList(der []byte) (*TNAuthList, int, error) {
+	var entries []asn1.RawValue
+	rest, err := asn1.Unmarshal(der, &entries)
+	if err != nil {
+		return nil, SJWTRetErrCertTNAuthList, wrapError(SJWTRetErrCertTNAuthList, "failed to parse TNAuthList", err)
+	}
+	if len(rest) > 0 {
+		return nil, SJWTRetErrCertTNAuthList, newError(SJWTRetErrCertTNAuthList, "trailing data after TNAuthList")
+	}
+
+	tnAuthList := &TNAuthList{}
+	for _, entry := range entries {
+		if entry.Class != asn1.ClassContextSpecific {
+			return nil, SJWTRetErrCertTNAuthList, newError(SJWTRetErrCertTNAuthList, "invalid TNAuthList entry")
+		}
+		switch entry.Tag {
+		case 0:
+			spc, ret, err := tnAuthListString(entry)
+			if err != nil {
+				return nil, ret, err
+			}
+			if len(spc) == 0 {
+				return nil, SJWTRetErrCertTNAuthList, newError(SJWTRetErrCertTNAuthList, "empty service provider code")
+			}
+			tnAuthList.SPCs = append(tnAuthList.SPCs, spc)
+		case 1:
+			var tnRange tnAuthListRange
+			if _, err = asn1.Unmarshal(entry.Bytes, &tnRange); err != nil {
+				return nil, SJWTRetErrCertTNAuthList, wrapError(SJWTRetErrCertTNAuthList, "failed to parse TNAuthList range", err)
+			}
+			if !isTNAuthListTN(tnRange.Start) || tnRange.Count < 2 {
+				return nil, SJWTRetErrCertTNAuthList, newError(SJWTRetErrCertTNAuthList, "invalid TNAuthList range")
+			}
+			tnAuthList.Ranges = append(tnAuthList.Ranges, TNRange{Start: tnRange.Start, Count: tnRange.Count})
+		case 2:
+			tn, ret, err := tnAuthListString(entry)
+			if err != nil {
+				return nil, ret, err
+			}
+			if !isTNAuthListTN(tn) {
+				return nil, SJWTRetErrCertTNAuthList, newError(SJWTRetErrCertTNAuthList, "invalid TNAuthList telephone number")
+			}
+			tnAuthList.TNs = append(tnAuthList.TNs, tn)
+		default:
+			return nil, SJWTRetErrCertTNAuthList, newError(SJWTRetErrCertTNAuthList, "invalid TNAuthList entry")
+		}
+	}
+	return tnAuthList, SJWTRetOK, nil
+}
+
+// SJWTGetTNAuthList - return the TNAuthList of the certificate, nil if the
+// certificate does not have the extension
+func SJWTGetTNAuthList(cert *x509.Certificate) (*TNAuthList, int, error) {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(SJWTOIDTNAuthList) {
+			return SJWTParseTNAuthList(ext.Value)
+		}
+	}
+	return nil, SJWTRetOK, nil
+}
+
+// SPC - return the first service provider code, empty if there is none
+func (l *TNAuthList) SPC() string {
+	if l == nil || len(l.SPCs) == 0 {
+		return ""
+	}
+	return l.SPCs[0]
+}
+
+// Empty - return true if the TNAuthList has no entry
+func (l *TNAuthList) Empty() bool {
+	return l == nil || (len(l.SPCs) == 0 && len(l.Ranges) == 0 && len(l.TNs) == 0)
+}
+
+// HasTNs - return true if the TNAuthList has telephone numbers or ranges,
+// like the delegate certificates (RFC 9060)
+func (l *TNAuthList) HasTNs() bool {
+	return l != nil && (len(l.Ranges) > 0 || len(l.TNs) > 0)
+}
+
+// Contains - return true if the telephone number, in canonical form, is one
+// of the numbers or in one of the ranges of the TNAuthList
+func (l *TNAuthList) Contains(tn string) bool {
+	if l == nil {
+		return false
+	}
+	for _, one := range l.TNs {
+		if one == tn {
+			return true
+		}
+	}
+	return l.covers(tn, 1)
+}
+
+// covers - return true if the count numbers starting with tn are in the
+// numbers and the ranges of the TNAuthList, which can be contiguous
+func (l *TNAuthList) covers(tn string, count int) bool {
+	start, ok := tnAuthListNumber(tn)
+	if !ok {
+		return false
+	}
+	end := start + uint64(count)
+
+	type interval struct{ start, end uint64 }
+	var intervals []interval
+	for _, one := range l.TNs {
+		if n, ok := tnAuthListNumber(one); ok && len(one) == len(tn) {
+			intervals = append(intervals, interval{n, n + 1})
+		}
+	}
+	for _, r := range l.Ranges {
+		if n, ok := tnAuthListNumber(r.Start); ok && len(r.Start) == len(tn) {
+			intervals = append(intervals, interval{n, n + uint64(r.Count)})
+		}
+	}
+
+	// move the start after each interval containing it, until the end
+	for moved := true; moved && start < end; {
+		moved = false
+		for _, i := range intervals {
+			if i.start <= start && start < i.end {
+				start = i.end
+				moved = true
+			}
+		}
+	}
+	return start >= end
+}
+
+// within - return true if the entries are in the scope of the TNAuthList of
+// the issuer; the numbers cannot be checked against an issuer having only
+// service provider codes
+func (l *TNAuthList) within(issuer *TNAuthList) bool {
+	for _, spc := range l.SPCs {
+		found := false
+		for _, ispc := range issuer.SPCs {
+			found = found || spc == ispc
+		}
+		if !found {
+			return false
+		}
+	}
+	if !issuer.HasTNs() {
+		return true
+	}
+	for _, one := range l.TNs {
+		if !issuer.Contains(one) {
+			return false
+		}
+	}
+	for _, r := range l.Ranges {
+		if !issuer.covers(r.Start, r.Count) {
+			return false
+		}
+	}
+	return true
+}
+
+// tnAuthListNumber - return the numeric value of a telephone number with
+// only digits
+func tnAuthListNumber(tn string) (uint64, bool) {
+	if strings.ContainsAny(tn, "#*") {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(tn, 10, 64)
+	return n, err == nil
+}
+
+// tnAuthListString - return the IA5String of the entry, which is explicitly
+// tagged by RFC 8226 module, but implicit tagging is also accepted
+func tnAuthListString(entry asn1.RawValue) (string, int, error) {
+	if !entry.IsCompound {
+		return string(entry.Bytes), SJWTRetOK, nil
+	}
+	var val string
+	if _, err := asn1.UnmarshalWithParams(entry.Bytes, &val, "ia5"); err != nil {
+		return "", SJWTRetErrCertTNAuthList, wrapError(SJWTRetErrCertTNAuthList, "failed to parse TNAuthList entry", err)
+	}
+	return val, SJWTRetOK, nil
+}
+
+// isTNAuthListTN - telephone number with 1 to 15 characters from "0-9#*"
+func isTNAuthListTN(tn string) bool {
+	if len(tn) == 0 || len(tn) > 15 {
+		return false
+	}
+	for i := 0; i < len(tn); i++ {
+		if strings.IndexByte("0123456789#*", tn[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkTNAuthList - verify that the certificate has a TNAuthList with at
+// least one entry (SHAKEN certificate profile)
+func checkTNAuthList(cert *x509.Certificate) (int, error) {
+	tnAuthList, ret, err := SJWTGetTNAuthList(cert)
+	if err != nil {
+		return ret, err
+	}
+	if tnAuthList == nil {
+		return SJWTRetErrCertTNAuthList, newError(SJWTRetErrCertTNAuthList, "no TNAuthList extension")
+	}
+	if tnAuthList.Empty() {
+		return SJWTRetErrCertTNAuthList, newError(SJWTRetErrCertTNAuthList, "empty TNAuthList extension")
+	}
+	return SJWTRetOK, nil
+}
+
+// checkTNAuthorized - for a verified certificate with telephone numbers in
+// TNAuthList (delegate certificate), verify that the telephone number of the
+// signer is one of them and that each certificate of the chain is in the
+// scope of its issuer (RFC 9060); nothing is checked for a signer without
+// telephone number, like an orig with only an uri
+func (v *Verifier) checkTNAuthorized(signerTN string, res *VerificationResult) (int, error) {
+	if v.opts.CertVerify == 0 || len(signerTN) == 0 || res == nil || !res.TNAuthList.HasTNs() {
+		return SJWTRetOK, nil
+	}
+
+	tn := SJWTCanonicalizeTN(signerTN, v.opts.CountryCode)
+	if len(tn) == 0 || !res.TNAuthList.Contains(tn) {
+		return SJWTRetErrCertTNNotAuthorized, newError(SJWTRetErrCertTNNotAuthorized, "telephone number not authorized by the certificate")
+	}
+
+	// the chain built by the verification with CertVerify, otherwise the
+	// certificates of the downloaded file
+	for i := 0; i+1 < len(res.Chain); i++ {
+		issuerList, _, err := SJWTGetTNAuthList(res.Chain[i+1])
+		if err != nil {
+			return SJWTRetErrCertDelegateScope, wrapError(SJWTRetErrCertDelegateScope, "invalid TNAuthList of issuer", err)
+		}
+		if issuerList == nil {
+			continue
+		}
+		certList, _, err := SJWTGetTNAuthList(res.Chain[i])
+		if err != nil || certList == nil || !certList.within(issuerList) {
+			return SJWTRetErrCertDelegateScope, newError(SJWTRetErrCertDelegateScope, "delegate certificate not in the scope of its issuer")
+		}
+	}
+	return SJWTRetOK, nil
+}
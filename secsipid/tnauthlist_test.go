@@ -0,0 +1,407 @@
+package secsipid_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+// tnAuthListEntry - explicitly tagged TNAuthList entry with the value
+func tnAuthListEntry(tag int, val interface{}) asn1.RawValue {
+	var der []byte
+	if s, ok := val.(string); ok {
+		der, _ = asn1.MarshalWithParams(s, "ia5")
+	} else {
+		der, _ = asn1.Marshal(val)
+	}
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: der}
+}
+
+type tnAuthListTestRange struct {
+	Start string `asn1:"ia5"`
+	Count int
+}
+
+// generateCertWithTNAuthList - certificate signed by the CA, with the
+// TNAuthList extension if der is not nil
+func (gen DummyCertGenerator) generateCertWithTNAuthList(der []byte) []byte {
+	prvKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return gen.generateECCertWithTNAuthList(der, prvKey)
+}
+
+// generateECCertWithTNAuthList - like generateCertWithTNAuthList, for the
+// public key of prvKey
+func (gen DummyCertGenerator) generateECCertWithTNAuthList(der []byte, prvKey *ecdsa.PrivateKey) []byte {
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(2022),
+		Subject:      pkix.Name{Organization: []string{"Bar, Inc."}},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if der != nil {
+		cert.ExtraExtensions = []pkix.Extension{{Id: secsipid.SJWTOIDTNAuthList, Value: der}}
+	}
+	certBytes, _ := x509.CreateCertificate(rand.Reader, cert, gen.ca, &prvKey.PublicKey, gen.caPrivKey)
+
+	certPEM := new(bytes.Buffer)
+	pem.Encode(certPEM, &pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: certBytes,
+	})
+	return certPEM.Bytes()
+}
+
+// newDelegateCA - intermediate CA signed by the CA, with the TNAuthList
+// extension
+func newDelegateCA(gen DummyCertGenerator, der []byte) DummyCertGenerator {
+	caPrivKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(2023),
+		Subject:               pkix.Name{Organization: []string{"Delegate, Inc."}},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		ExtraExtensions:       []pkix.Extension{{Id: secsipid.SJWTOIDTNAuthList, Value: der}},
+	}
+	caBytes, _ := x509.CreateCertificate(rand.Reader, ca, gen.ca, &caPrivKey.PublicKey, gen.caPrivKey)
+	ca, _ = x509.ParseCertificate(caBytes)
+
+	caPEM := new(bytes.Buffer)
+	pem.Encode(caPEM, &pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: caBytes,
+	})
+
+	return DummyCertGenerator{
+		ca:         ca,
+		caPrivKey:  caPrivKey,
+		caPEMBytes: caPEM.Bytes(),
+	}
+}
+
+type ParseTNAuthListTest struct {
+	entries []asn1.RawValue
+
+	expectedErrCode    int
+	expectedTNAuthList *secsipid.TNAuthList
+}
+
+func TestParseTNAuthList(t *testing.T) {
+	testCases := map[string]ParseTNAuthListTest{
+		"OK with SPC": {
+			entries:            []asn1.RawValue{tnAuthListEntry(0, "123A")},
+			expectedErrCode:    secsipid.SJWTRetOK,
+			expectedTNAuthList: &secsipid.TNAuthList{SPCs: []string{"123A"}},
+		},
+		"OK with SPC, range and single number": {
+			entries: []asn1.RawValue{
+				tnAuthListEntry(0, "123A"),
+				tnAuthListEntry(1, tnAuthListTestRange{Start: "15551230000", Count: 100}),
+				tnAuthListEntry(2, "15559876543"),
+			},
+			expectedErrCode: secsipid.SJWTRetOK,
+			expectedTNAuthList: &secsipid.TNAuthList{
+				SPCs:   []string{"123A"},
+				Ranges: []secsipid.TNRange{{Start: "15551230000", Count: 100}},
+				TNs:    []string{"15559876543"},
+			},
+		},
+		"OK with implicitly tagged SPC": {
+			entries:            []asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: []byte("123A")}},
+			expectedErrCode:    secsipid.SJWTRetOK,
+			expectedTNAuthList: &secsipid.TNAuthList{SPCs: []string{"123A"}},
+		},
+		"ErrCertTNAuthList with invalid telephone number": {
+			entries:         []asn1.RawValue{tnAuthListEntry(2, "1555abc")},
+			expectedErrCode: secsipid.SJWTRetErrCertTNAuthList,
+		},
+		"ErrCertTNAuthList with range of one number": {
+			entries:         []asn1.RawValue{tnAuthListEntry(1, tnAuthListTestRange{Start: "15551230000", Count: 1})},
+			expectedErrCode: secsipid.SJWTRetErrCertTNAuthList,
+		},
+		"ErrCertTNAuthList with unknown entry": {
+			entries:         []asn1.RawValue{tnAuthListEntry(3, "123A")},
+			expectedErrCode: secsipid.SJWTRetErrCertTNAuthList,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			der, _ := asn1.Marshal(testCase.entries)
+			tnAuthList, errCode, err := secsipid.SJWTParseTNAuthList(der)
+
+			expect(errCode).ToBe(testCase.expectedErrCode)
+			expect(secsipid.SJWTErrorCode(err)).ToBe(testCase.expectedErrCode)
+			expect(tnAuthList).ToEqual(testCase.expectedTNAuthList)
+		})
+	}
+
+	t.Run("ErrCertTNAuthList with invalid DER", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, errCode, _ := secsipid.SJWTParseTNAuthList([]byte{0x30, 0x05, 0xa0})
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertTNAuthList)
+	})
+}
+
+func TestVerifierTNAuthList(t *testing.T) {
+	ca := NewDummyCA()
+	spcDER, _ := asn1.Marshal([]asn1.RawValue{tnAuthListEntry(0, "123A")})
+	emptyDER, _ := asn1.Marshal([]asn1.RawValue{})
+
+	verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+		CertVerify: secsipid.SJWTCertVerifyCAFile | secsipid.SJWTCertVerifyTNAuthList,
+		RootCAs:    []*x509.Certificate{parseDummyCA(ca)},
+	})
+
+	t.Run("OK with SPC", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		errCode, _ := verifier.PubKeyVerify(ca.generateCertWithTNAuthList(spcDER))
+
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("ErrCertTNAuthList without extension", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		errCode, err := verifier.PubKeyVerify(ca.generateCertWithTNAuthList(nil))
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertTNAuthList)
+		expect(getMsgFromErr(err)).ToBe("no TNAuthList extension")
+	})
+
+	t.Run("ErrCertTNAuthList with empty extension", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		errCode, err := verifier.PubKeyVerify(ca.generateCertWithTNAuthList(emptyDER))
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertTNAuthList)
+		expect(getMsgFromErr(err)).ToBe("empty TNAuthList extension")
+	})
+
+	t.Run("SPC in verification result", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		certPath := path.Join(t.TempDir(), "cert.pem")
+		os.WriteFile(certPath, ca.generateCertWithTNAuthList(spcDER), 0600)
+		keyPath := path.Join(t.TempDir(), "ec256-private.pem")
+		writeDummyECKey(keyPath)
+		identity, _, _ := secsipid.SJWTGetIdentity("15559876543", "15551234567", "A", "", "https://127.0.0.1/cert.pem", keyPath)
+
+		// the token is not signed with the key of the certificate
+		res := verifier.CheckFullIdentityResult(identity, certPath)
+
+		expect(res.ErrCode).ToBe(secsipid.SJWTRetErrJSONSignatureInvalid)
+		expect(res.SPC).ToBe("123A")
+		expect(res.TNAuthList.SPCs).ToEqual([]string{"123A"})
+	})
+
+	t.Run("OK without extension if not required", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+			CertVerify: secsipid.SJWTCertVerifyCAFile,
+			RootCAs:    []*x509.Certificate{parseDummyCA(ca)},
+		})
+		errCode, _ := verifier.PubKeyVerify(ca.generateCertWithTNAuthList(nil))
+
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+	})
+}
+
+func TestTNAuthListContains(t *testing.T) {
+	tnAuthList := &secsipid.TNAuthList{
+		Ranges: []secsipid.TNRange{{Start: "15551230000", Count: 100}, {Start: "15551230100", Count: 50}},
+		TNs:    []string{"15559876543", "*72"},
+	}
+
+	testCases := map[string]bool{
+		"15559876543": true,
+		"*72":         true,
+		"15551230000": true,
+		"15551230120": true,
+		"15551230150": false,
+		"1555123000":  false,
+		"15559876544": false,
+	}
+
+	for tn, expected := range testCases {
+		t.Run(tn, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			expect(tnAuthList.Contains(tn)).ToBe(expected)
+		})
+	}
+}
+
+type DelegateCertTest struct {
+	certTNs    []asn1.RawValue
+	origTN     string
+	origURI    string
+	certVerify int
+
+	expectedErrCode int
+}
+
+func TestVerifierDelegateCert(t *testing.T) {
+	ca := NewDummyCA()
+	caDER, _ := asn1.Marshal([]asn1.RawValue{
+		tnAuthListEntry(1, tnAuthListTestRange{Start: "15551230000", Count: 1000}),
+	})
+	delegateCA := newDelegateCA(ca, caDER)
+
+	testCases := map[string]DelegateCertTest{
+		"OK with orig in the range": {
+			certTNs:         []asn1.RawValue{tnAuthListEntry(1, tnAuthListTestRange{Start: "15551230100", Count: 100})},
+			origTN:          "+1 555 123 0150",
+			expectedErrCode: secsipid.SJWTRetOK,
+		},
+		"OK with orig number": {
+			certTNs:         []asn1.RawValue{tnAuthListEntry(2, "15551230999")},
+			origTN:          "15551230999",
+			expectedErrCode: secsipid.SJWTRetOK,
+		},
+		"OK with orig uri without telephone number": {
+			certTNs:         []asn1.RawValue{tnAuthListEntry(2, "15551230999")},
+			origURI:         "sip:alice@example.com",
+			expectedErrCode: secsipid.SJWTRetOK,
+		},
+		"OK with orig out of the range without certificate verification": {
+			certTNs:         []asn1.RawValue{tnAuthListEntry(1, tnAuthListTestRange{Start: "15551230100", Count: 100})},
+			origTN:          "15551230200",
+			certVerify:      -1,
+			expectedErrCode: secsipid.SJWTRetOK,
+		},
+		"ErrCertTNNotAuthorized with orig out of the range": {
+			certTNs:         []asn1.RawValue{tnAuthListEntry(1, tnAuthListTestRange{Start: "15551230100", Count: 100})},
+			origTN:          "15551230200",
+			expectedErrCode: secsipid.SJWTRetErrCertTNNotAuthorized,
+		},
+		"ErrCertDelegateScope with range out of the issuer range": {
+			certTNs:         []asn1.RawValue{tnAuthListEntry(1, tnAuthListTestRange{Start: "15551230900", Count: 200})},
+			origTN:          "15551230950",
+			expectedErrCode: secsipid.SJWTRetErrCertDelegateScope,
+		},
+		"ErrCertDelegateScope with SPC not in the issuer": {
+			certTNs: []asn1.RawValue{
+				tnAuthListEntry(0, "123A"),
+				tnAuthListEntry(2, "15551230999"),
+			},
+			origTN:          "15551230999",
+			expectedErrCode: secsipid.SJWTRetErrCertDelegateScope,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			certVerify := secsipid.SJWTCertVerifyCAFile
+			if testCase.certVerify < 0 {
+				certVerify = 0
+			}
+			verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+				CertVerify: certVerify,
+				RootCAs:    []*x509.Certificate{parseDummyCA(ca)},
+				Expire:     60,
+			})
+
+			prvKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			der, _ := asn1.Marshal(testCase.certTNs)
+			certPath := path.Join(t.TempDir(), "cert.pem")
+			os.WriteFile(certPath, append(delegateCA.generateECCertWithTNAuthList(der, prvKey), delegateCA.caPEMBytes...), 0600)
+
+			header := secsipid.SJWTHeader{Alg: "ES256", Ppt: "shaken", Typ: "passport", X5u: "https://127.0.0.1/cert.pem"}
+			payload := secsipid.SJWTPayload{
+				ATTest: "A",
+				Dest:   secsipid.SJWTDest{TN: []string{"15559876543"}},
+				IAT:    time.Now().Unix(),
+				Orig:   secsipid.SJWTOrig{TN: testCase.origTN, URI: testCase.origURI},
+				OrigID: "32c7e392-33fc-11ea-840b-784f435c76a8",
+			}
+			identity := secsipid.SJWTEncode(header, payload, prvKey) + ";info=<https://127.0.0.1/cert.pem>;alg=ES256;ppt=shaken"
+
+			errCode, err := verifier.CheckFullIdentity(identity, certPath)
+
+			expect(errCode).ToBe(testCase.expectedErrCode)
+			expect(secsipid.SJWTErrorCode(err)).ToBe(testCase.expectedErrCode)
+		})
+	}
+}
+
+type DelegateCertDivTest struct {
+	divTN string
+
+	expectedErrCode int
+}
+
+func TestVerifierDelegateCertDiv(t *testing.T) {
+	ca := NewDummyCA()
+	caDER, _ := asn1.Marshal([]asn1.RawValue{
+		tnAuthListEntry(1, tnAuthListTestRange{Start: "15551230000", Count: 1000}),
+	})
+	delegateCA := newDelegateCA(ca, caDER)
+
+	verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+		CertVerify: secsipid.SJWTCertVerifyCAFile,
+		RootCAs:    []*x509.Certificate{parseDummyCA(ca)},
+		Expire:     60,
+	})
+
+	// the certificate of the diverting carrier covers the div number, not
+	// the orig number
+	testCases := map[string]DelegateCertDivTest{
+		"OK with div in the certificate": {
+			divTN:           "15551230999",
+			expectedErrCode: secsipid.SJWTRetOK,
+		},
+		"ErrCertTNNotAuthorized with div not in the certificate": {
+			divTN:           "15551230998",
+			expectedErrCode: secsipid.SJWTRetErrCertTNNotAuthorized,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			prvKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			der, _ := asn1.Marshal([]asn1.RawValue{tnAuthListEntry(2, "15551230999")})
+			certPath := path.Join(t.TempDir(), "cert.pem")
+			os.WriteFile(certPath, append(delegateCA.generateECCertWithTNAuthList(der, prvKey), delegateCA.caPEMBytes...), 0600)
+
+			prvKeyDER, _ := x509.MarshalECPrivateKey(prvKey)
+			signer, _, _ := secsipid.NewSigner(secsipid.SignerOptions{
+				PrvKeyData: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: prvKeyDER}),
+				X5u:        "https://127.0.0.1/cert.pem",
+			})
+			identity, _, _ := signer.SignDiv("12025550100", []string{"15559876543"}, testCase.divTN)
+
+			_, errCode, err := verifier.CheckDivIdentity(identity, certPath)
+
+			expect(errCode).ToBe(testCase.expectedErrCode)
+			expect(secsipid.SJWTErrorCode(err)).ToBe(testCase.expectedErrCode)
+		})
+	}
+}
@@ -0,0 +1,825 @@
+package secsipid
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// VerifierOptions - settings used by a Verifier instance
+type VerifierOptions struct {
+	// directory where downloaded public keys are cached ('' - no caching)
+	CacheDirPath string
+	// number of seconds after which a cached public key is invalidated
+	CacheExpire int
+	// path to file with custom root CA certificates
+	CertCAFile string
+	// path to file with custom intermediate CA certificates
+	CertCAInter string
+	// comma separated paths to files or directories with certificate
+	// revocation lists, in PEM or DER format
+	CertCRLFile string
+	// certificate verification mode (bit flags, see README)
+	CertVerify int
+	// custom root CA certificates, used together with CertCAFile
+	RootCAs []*x509.Certificate
+	// custom intermediate CA certificates, used together with CertCAInter
+	InterCAs []*x509.Certificate
+	// certificate revocation lists, used together with CertCRLFile
+	CRLs []*x509.RevocationList
+	// number of seconds a CRL is accepted after its next update
+	CRLGrace int
+	// do not check the thisUpdate and nextUpdate of the CRLs against Now
+	// (e.g., when verifying old captured messages with the current CRLs)
+	SkipCRLTime bool
+	// client used to download public keys ('nil' - one built from Timeout)
+	HTTPClient *http.Client
+	// number of seconds after iat until the token is considered expired (0 -
+	// default of SJWTIATMaxAgeDefault seconds)
+	Expire int
+	// number of seconds iat can be in the future, to tolerate the clock skew
+	// ('nil' - default of SJWTIATFutureSkewDefault seconds, 0 - iat cannot be
+	// in the future)
+	IATFutureSkew *int
+	// verify the validity of the certificate at the time of iat instead of
+	// the current time
+	CertTimeIAT bool
+	// http get timeout in seconds, used only when HTTPClient is 'nil'
+	Timeout int
+	// check the rcd claim and the rcdi digests of shaken PASSporTs
+	CheckRCD bool
+	// compare the telephone numbers in canonical form (RFC 8224 section 8.3)
+	CanonicalizeTN bool
+	// country code used to canonicalize national telephone numbers
+	CountryCode string
+	// maximum difference in seconds between iat and the SIP Date header (0 -
+	// default of 60 seconds)
+	DateSkew int
+	// clock used for validity checks ('nil' - time.Now); the cached content
+	// is expired against the wall clock
+	Now func() time.Time
+}
+
+// Verifier - checks Identity headers using its own trust configuration
+//
+// A Verifier is not changed after it is created, so it is safe for concurrent
+// use by multiple goroutines.
+type Verifier struct {
+	opts VerifierOptions
+}
+
+// NewVerifier - create a Verifier instance from the options
+func NewVerifier(opts VerifierOptions) *Verifier {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{
+			Timeout: time.Duration(opts.Timeout) * time.Second,
+		}
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Verifier{opts: opts}
+}
+
+// Options - return a copy of the options used by the verifier
+func (v *Verifier) Options() VerifierOptions {
+	return v.opts
+}
+
+// defaultVerifier - build a Verifier from a snapshot of the global library options
+func defaultVerifier(expireVal int, timeoutVal int) *Verifier {
+	globalLibOptionsMu.RLock()
+	opts := VerifierOptions{
+		CacheDirPath: globalLibOptions.cacheDirPath,
+		CacheExpire:  globalLibOptions.cacheExpire,
+		CertCAFile:   globalLibOptions.certCAFile,
+		CertCAInter:  globalLibOptions.certCAInter,
+		CertCRLFile:  globalLibOptions.certCRLFile,
+		CRLGrace:     globalLibOptions.crlGrace,
+		CertVerify:   globalLibOptions.certVerify,
+		Expire:       expireVal,
+		Timeout:      timeoutVal,
+
+		CertTimeIAT: globalLibOptions.certTimeIAT != 0,
+		CheckRCD:    globalLibOptions.checkRCD != 0,
+
+		CanonicalizeTN: globalLibOptions.tnCanonicalize != 0,
+		CountryCode:    globalLibOptions.tnCountryCode,
+	}
+	if globalLibOptions.iatFutureSkew >= 0 {
+		futureSkew := globalLibOptions.iatFutureSkew
+		opts.IATFutureSkew = &futureSkew
+	}
+	globalLibOptionsMu.RUnlock()
+	return NewVerifier(opts)
+}
+
+// GetURLCacheFilePath - return the path of the cache file for the URL
+func (v *Verifier) GetURLCacheFilePath(urlVal string) string {
+	filePath := strings.Replace(urlVal, "://", "_", -1)
+	filePath = strings.Replace(filePath, "/", "_", -1)
+	if len(v.opts.CacheDirPath) > 0 {
+		filePath = v.opts.CacheDirPath + "/" + filePath
+	}
+	return filePath
+}
+
+// GetURLCachedContent - return the cached content for the URL, if not expired
+// (the age of the file being computed with the wall clock, not with Now)
+func (v *Verifier) GetURLCachedContent(urlVal string) ([]byte, error) {
+	filePath := v.GetURLCacheFilePath(urlVal)
+
+	fileStat, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if int(time.Since(fileStat.ModTime()).Seconds()) > v.opts.CacheExpire {
+		os.Remove(filePath)
+		return nil, nil
+	}
+	return ioutil.ReadFile(filePath)
+}
+
+// SetURLCachedContent - store the content for the URL in the cache directory
+func (v *Verifier) SetURLCachedContent(urlVal string, data []byte) error {
+	filePath := v.GetURLCacheFilePath(urlVal)
+
+	return ioutil.WriteFile(filePath, data, 0640)
+}
+
+// GetURLContent - return the content of the URL, using the cache if enabled
+func (v *Verifier) GetURLContent(urlVal string) ([]byte, int, error) {
+	if len(urlVal) == 0 {
+		return nil, SJWTRetErrHTTPInvalidURL, newError(SJWTRetErrHTTPInvalidURL, "no URL value")
+	}
+
+	if !(strings.HasPrefix(urlVal, "http://") || strings.HasPrefix(urlVal, "https://")) {
+		return nil, SJWTRetErrHTTPInvalidURL, newError(SJWTRetErrHTTPInvalidURL, "invalid URL value")
+	}
+
+	if len(v.opts.CacheDirPath) > 0 {
+		cdata, cerr := v.GetURLCachedContent(urlVal)
+		if cdata != nil {
+			return cdata, SJWTRetOK, cerr
+		}
+	}
+	data, ret, err := v.httpGet(urlVal)
+	if err != nil {
+		return nil, ret, err
+	}
+
+	if len(v.opts.CacheDirPath) > 0 {
+		v.SetURLCachedContent(urlVal, data)
+	}
+
+	return data, SJWTRetOK, nil
+}
+
+// httpGet - download the content of the URL with the http client
+func (v *Verifier) httpGet(urlVal string) ([]byte, int, error) {
+	resp, err := v.opts.HTTPClient.Get(urlVal)
+	if err != nil {
+		return nil, SJWTRetErrHTTPGet, wrapError(SJWTRetErrHTTPGet, "http get failure", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, SJWTRetErrHTTPStatusCode, newError(SJWTRetErrHTTPStatusCode, fmt.Sprintf("http status error: %d", resp.StatusCode))
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, SJWTRetErrHTTPReadBody, wrapError(SJWTRetErrHTTPReadBody, "read http body failure", err)
+	}
+	return data, SJWTRetOK, nil
+}
+
+// PubKeyVerify - verify the certificate according to the CertVerify mode
+func (v *Verifier) PubKeyVerify(pubKey []byte) (int, error) {
+	return v.pubKeyVerify(pubKey, 0, nil)
+}
+
+// parseCertChainPEM - parse the signing certificate and the intermediate
+// certificates that follow it in the PEM data
+func parseCertChainPEM(pubKey []byte) (*x509.Certificate, []*x509.Certificate, int, error) {
+	var certVal *x509.Certificate
+	var certInter []*x509.Certificate
+
+	// The public key may contain multiple intermediate certificates, we must
+	// parse those out and include them when doing the actual validation.
+	var toDecode = pubKey
+	var block *pem.Block
+	for true {
+		// Decode the next block in the public key. If there are no more blocks then
+		// this will return nil.
+		block, toDecode = pem.Decode(toDecode)
+		if block == nil {
+			break
+		}
+
+		// Parse the block as an x509 certificate.
+		blockCert, err := x509.ParseCertificate(block.Bytes)
+		if blockCert == nil {
+			return nil, nil, SJWTRetErrCertInvalidFormat, wrapError(SJWTRetErrCertInvalidFormat, "", err)
+		}
+
+		// If this was the first block then it represents the public certificate,
+		// otherwise it is an intermediate certificate.
+		if certVal == nil {
+			certVal = blockCert
+		} else {
+			certInter = append(certInter, blockCert)
+		}
+	}
+
+	if certVal == nil {
+		return nil, nil, SJWTRetErrCertInvalidFormat, newError(SJWTRetErrCertInvalidFormat, "failed to parse certificate PEM")
+	}
+	return certVal, certInter, SJWTRetOK, nil
+}
+
+// pubKeyVerify - verify the certificate, storing its details in res if not
+// nil; iat is the time of the token, used with the CertTimeIAT option
+func (v *Verifier) pubKeyVerify(pubKey []byte, iat int64, res *VerificationResult) (int, error) {
+	var certVal *x509.Certificate
+	var certInter []*x509.Certificate
+	var rootCAs *x509.CertPool
+	var interCAs *x509.CertPool
+	var sysCerts []*x509.Certificate
+	var ret int
+	var err error
+
+	if v.opts.CertVerify == 0 {
+		if res != nil {
+			// best effort, the public key may not be a certificate
+			if certVal, certInter, _, err = parseCertChainPEM(pubKey); err == nil {
+				res.setCertificates(certVal, append([]*x509.Certificate{certVal}, certInter...))
+			}
+		}
+		return SJWTRetOK, nil
+	}
+
+	if certVal, certInter, ret, err = parseCertChainPEM(pubKey); err != nil || certVal == nil {
+		return ret, err
+	}
+	if res != nil {
+		res.setCertificates(certVal, append([]*x509.Certificate{certVal}, certInter...))
+	}
+
+	tnow := v.opts.Now()
+	if v.opts.CertTimeIAT && iat > 0 {
+		tnow = time.Unix(iat, 0)
+	}
+	if (v.opts.CertVerify & SJWTCertVerifyTime) != 0 {
+		if !tnow.Before(certVal.NotAfter) {
+			return SJWTRetErrCertExpired, newError(SJWTRetErrCertExpired, "certificate expired")
+		} else if !tnow.After(certVal.NotBefore) {
+			return SJWTRetErrCertBeforeValidity, newError(SJWTRetErrCertBeforeValidity, "certificate not valid yet")
+		}
+	}
+	if (v.opts.CertVerify & SJWTCertVerifyProfile) != 0 {
+		if ret, err = SJWTCheckCertProfile(certVal); err != nil {
+			return ret, err
+		}
+	}
+	if (v.opts.CertVerify & SJWTCertVerifyTNAuthList) != 0 {
+		if ret, err = checkTNAuthList(certVal); err != nil {
+			return ret, err
+		}
+	}
+
+	rootCAs = nil
+	interCAs = nil
+	if (v.opts.CertVerify & SJWTCertVerifySystemCAs) != 0 {
+		// Get the SystemCertPool
+		rootCAs, sysCerts, err = systemRoots()
+		if rootCAs == nil {
+			return SJWTRetErrCertProcessing, wrapError(SJWTRetErrCertProcessing, "", err)
+		}
+	}
+	if (v.opts.CertVerify & SJWTCertVerifyCAFile) != 0 {
+		if len(v.opts.CertCAFile) <= 0 && len(v.opts.RootCAs) == 0 {
+			return SJWTRetErrCertNoCAFile, newError(SJWTRetErrCertNoCAFile, "no CA file")
+		}
+
+		// The system pool is shared, build a new one to add the custom CAs
+		rootCAs = x509.NewCertPool()
+		for _, sCert := range sysCerts {
+			rootCAs.AddCert(sCert)
+		}
+		if len(v.opts.CertCAFile) > 0 {
+			var certsCA []byte
+			// Read in the cert file
+			certsCA, err = ioutil.ReadFile(v.opts.CertCAFile)
+			if err != nil {
+				return SJWTRetErrCertReadCAFile, newError(SJWTRetErrCertReadCAFile, "failed to read CA file")
+			}
+
+			// Append our cert to the pool
+			if ok := rootCAs.AppendCertsFromPEM(certsCA); !ok {
+				return SJWTRetErrCertProcessing, newError(SJWTRetErrCertProcessing, "failed to append CA file")
+			}
+		}
+		for _, rCert := range v.opts.RootCAs {
+			rootCAs.AddCert(rCert)
+		}
+	}
+	if (v.opts.CertVerify & SJWTCertVerifyCAInter) != 0 {
+		if len(v.opts.CertCAInter) <= 0 && len(v.opts.InterCAs) == 0 {
+			return SJWTRetErrCertNoCAInter, newError(SJWTRetErrCertNoCAInter, "no intermediate CA file")
+		}
+		interCAs = x509.NewCertPool()
+		if len(v.opts.CertCAInter) > 0 {
+			var certsCA []byte
+			// Read in the cert file
+			certsCA, err = ioutil.ReadFile(v.opts.CertCAInter)
+			if err != nil {
+				return SJWTRetErrCertReadCAInter, newError(SJWTRetErrCertReadCAInter, "failed to read intermediate CA file")
+			}
+
+			// Append our cert to the pool
+			if ok := interCAs.AppendCertsFromPEM(certsCA); !ok {
+				return SJWTRetErrCertProcessing, newError(SJWTRetErrCertProcessing, "failed to append intermediate CA file")
+			}
+		}
+		for _, iCert := range v.opts.InterCAs {
+			interCAs.AddCert(iCert)
+		}
+	}
+
+	// Append any intermediate certificates included in pubKey.
+	if len(certInter) > 0 {
+		if interCAs == nil {
+			interCAs = x509.NewCertPool()
+		}
+		// Append our certs
+		for _, iCert := range certInter {
+			interCAs.AddCert(iCert)
+		}
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         rootCAs,
+		Intermediates: interCAs,
+		CurrentTime:   tnow,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	var certChains [][]*x509.Certificate
+	if certChains, err = certVal.Verify(opts); err != nil {
+		return SJWTRetErrCertInvalid, wrapError(SJWTRetErrCertInvalid, "", err)
+	}
+	certChain := append([]*x509.Certificate{certVal}, certInter...)
+	if len(certChains) > 0 {
+		certChain = certChains[0]
+	}
+	if res != nil {
+		res.Chain = certChain
+	}
+
+	if (v.opts.CertVerify & SJWTCertVerifyCRL) != 0 {
+		if len(v.opts.CertCRLFile) <= 0 && len(v.opts.CRLs) == 0 {
+			return SJWTRetErrCertNoCRLFile, newError(SJWTRetErrCertNoCRLFile, "no CRL file")
+		}
+		crlList := v.opts.CRLs
+		if len(v.opts.CertCRLFile) > 0 {
+			var fileCRLs []*x509.RevocationList
+			if fileCRLs, ret, err = loadCRLFiles(v.opts.CertCRLFile); err != nil {
+				return ret, err
+			}
+			crlList = append(fileCRLs, crlList...)
+		}
+		if ret, err = v.checkCRLList(certChain, crlList); err != nil {
+			return ret, err
+		}
+	}
+	if (v.opts.CertVerify & SJWTCertVerifyCRLDP) != 0 {
+		if ret, err = v.checkCRLDP(certChain); err != nil {
+			return ret, err
+		}
+	}
+
+	return SJWTRetOK, nil
+}
+
+// GetValidPayload - decode the payload and check that it is not expired
+func (v *Verifier) GetValidPayload(base64Payload string) (*SJWTPayload, int, error) {
+	payload := SJWTPayload{}
+
+	if ret, err := decodePayload(base64Payload, &payload); err != nil {
+		return nil, ret, err
+	}
+	if ret, err := v.checkIAT(payload.IAT); err != nil {
+		return nil, ret, err
+	}
+
+	return &payload, SJWTRetOK, nil
+}
+
+// decodePayload - decode the base64 JSON payload into the structure
+func decodePayload(base64Payload string, payload interface{}) (int, error) {
+	if len(base64Payload) == 0 {
+		return SJWTRetErrJSONPayloadParse, newError(SJWTRetErrJSONPayloadParse, "empty payload")
+	}
+	decodedPayload, payloadErr := SJWTBase64DecodeString(base64Payload)
+	if payloadErr != nil {
+		return SJWTRetErrJSONPayloadParse, wrapError(SJWTRetErrJSONPayloadParse, "invalid payload", payloadErr)
+	}
+
+	err := json.Unmarshal([]byte(decodedPayload), payload)
+	if err != nil {
+		return SJWTRetErrJSONPayloadParse, wrapError(SJWTRetErrJSONPayloadParse, "invalid payload", err)
+	}
+	return SJWTRetOK, nil
+}
+
+// checkIAT - check that the token with the iat value is not expired and
+// not issued in the future, beyond the tolerated clock skew
+func (v *Verifier) checkIAT(iat int64) (int, error) {
+	if iat == 0 {
+		return SJWTRetErrJSONPayloadIATExpired, newError(SJWTRetErrJSONPayloadIATExpired, "missing iat - expired token")
+	}
+	maxAge := v.opts.Expire
+	if maxAge <= 0 {
+		maxAge = SJWTIATMaxAgeDefault
+	}
+	futureSkew := SJWTIATFutureSkewDefault
+	if v.opts.IATFutureSkew != nil && *v.opts.IATFutureSkew >= 0 {
+		futureSkew = *v.opts.IATFutureSkew
+	}
+
+	tnow := v.opts.Now().Unix()
+	if tnow > iat+int64(maxAge) {
+		return SJWTRetErrJSONPayloadIATExpired, newError(SJWTRetErrJSONPayloadIATExpired, "expired token")
+	}
+	if iat > tnow+int64(futureSkew) {
+		return SJWTRetErrJSONPayloadIATFuture, newError(SJWTRetErrJSONPayloadIATFuture, "token issued in the future")
+	}
+	return SJWTRetOK, nil
+}
+
+// DecodeWithPubKey - decode JWT string
+func (v *Verifier) DecodeWithPubKey(jwt string, pubkey interface{}) (*SJWTPayload, error) {
+	var ret int
+	var err error
+	var payload *SJWTPayload
+
+	token := strings.Split(strings.TrimSpace(jwt), ".")
+
+	if len(token) != 3 {
+		return nil, newError(SJWTRetErrSIPHdrParse, "invalid token - must contain header, payload and signature")
+	}
+
+	payload, ret, err = v.GetValidPayload(token[1])
+	if err != nil {
+		return nil, wrapError(ret, "getting payload failed", err)
+	}
+
+	signatureValue := token[0] + "." + token[1]
+
+	ret, err = SJWTVerifyWithPubKey(signatureValue, token[2], pubkey)
+	if err != nil {
+		return nil, wrapError(ret, "verify failed", err)
+	}
+	return payload, nil
+}
+
+// CheckIdentityPKMode - implements the verify of identity, pubkeyVal is the
+// public key value if pubkeyMode is 1, otherwise its URL or file path
+func (v *Verifier) CheckIdentityPKMode(identityVal string, pubkeyVal string, pubkeyMode int) (int, error) {
+	return v.checkIdentityPKMode(identityVal, pubkeyVal, pubkeyMode, &VerificationResult{})
+}
+
+func (v *Verifier) checkIdentityPKMode(identityVal string, pubkeyVal string, pubkeyMode int, res *VerificationResult) (int, error) {
+	var err error
+	var ret int
+	var ecdsaPubKey *ecdsa.PublicKey
+	var payload *SJWTPayload
+
+	token := strings.Split(strings.TrimSpace(identityVal), ".")
+
+	if len(token) != 3 {
+		return SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "invalid token - must contain header, payload and signature")
+	}
+	if len(token[0]) == 0 && len(token[1]) == 0 {
+		return SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "token in compact form - it has to be rebuilt from the SIP request")
+	}
+
+	payload, ret, err = v.GetValidPayload(token[1])
+	if err != nil {
+		return ret, err
+	}
+	res.setPayload(payload)
+
+	if ecdsaPubKey, ret, err = v.getPubKey(pubkeyVal, pubkeyMode, payload.IAT, payload.Orig.TN, res); err != nil {
+		return ret, err
+	}
+	ret, err = SJWTVerifyWithPubKey(token[0]+"."+token[1], token[2], ecdsaPubKey)
+	if err == nil {
+		if v.opts.CheckRCD {
+			return v.CheckRCD(payload.RCD, payload.RCDI)
+		}
+		return SJWTRetOK, nil
+	}
+
+	return ret, wrapError(ret, fmt.Sprintf("failed to verify - origid (%s)", payload.OrigID), err)
+}
+
+// passportClaims - claims of the PASSporT types used to verify the
+// certificate
+type passportClaims struct {
+	IAT  int64    `json:"iat"`
+	Orig SJWTOrig `json:"orig"`
+	Div  SJWTDiv  `json:"div"`
+}
+
+// signerTN - return the telephone number the signer of the PASSporT of
+// extension type ppt has to be authorized for: the div claim for div
+// PASSporTs (RFC 8946), otherwise the orig claim
+func (c *passportClaims) signerTN(ppt string) string {
+	if ppt == SJWTPptDiv {
+		return c.Div.TN
+	}
+	return c.Orig.TN
+}
+
+// getPubKey - retrieve and verify the public key, pubkeyVal is the public key
+// value if pubkeyMode is 1, otherwise its URL or file path; iat is the time
+// of the token and signerTN the telephone number the certificate has to
+// authorize
+func (v *Verifier) getPubKey(pubkeyVal string, pubkeyMode int, iat int64, signerTN string, res *VerificationResult) (*ecdsa.PublicKey, int, error) {
+	var ret int
+	var err error
+	var pubkey []byte
+
+	if pubkeyMode == 1 {
+		pubkey = []byte(pubkeyVal)
+	} else {
+		if strings.HasPrefix(pubkeyVal, "http://") || strings.HasPrefix(pubkeyVal, "https://") {
+			pubkey, ret, err = v.GetURLContent(pubkeyVal)
+		} else if strings.HasPrefix(pubkeyVal, "file://") {
+			fileUrl, _ := url.Parse(pubkeyVal)
+			pubkey, err = ioutil.ReadFile(fileUrl.Path)
+			ret = SJWTRetErrFileRead
+		} else {
+			pubkey, err = ioutil.ReadFile(pubkeyVal)
+			ret = SJWTRetErrFileRead
+		}
+		if err != nil {
+			if ret == SJWTRetErrFileRead {
+				err = wrapError(ret, "failed to read public key file", err)
+			}
+			return nil, ret, err
+		}
+	}
+
+	ret, err = v.pubKeyVerify(pubkey, iat, res)
+	if ret != SJWTRetOK {
+		return nil, ret, err
+	}
+	if ret, err = v.checkTNAuthorized(signerTN, res); err != nil {
+		return nil, ret, err
+	}
+
+	return SJWTParseECPublicKeyFromPEM(pubkey)
+}
+
+// checkPASSporT - verify the Identity header with a PASSporT of extension type
+// ppt, decoding its payload in the structure; pubkeyVal is the public key
+// value if pubkeyMode is 1, otherwise its URL or file path, if empty the value
+// of the info parameter is used; the iat is checked before the public key is
+// retrieved
+func (v *Verifier) checkPASSporT(identityVal string, pubkeyVal string, pubkeyMode int, ppt string, payload interface{}) (int, error) {
+	var ecdsaPubKey *ecdsa.PublicKey
+	var ret int
+	var err error
+
+	hdr, ret, err := SJWTParseIdentityHeader(identityVal)
+	if err != nil {
+		return ret, err
+	}
+	if !hdr.hasParams() {
+		return SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "missing parts of the message header")
+	}
+
+	paramInfo, ret, err := hdr.validInfo(ppt)
+	if err != nil {
+		return ret, err
+	}
+
+	btoken, ret, err := hdr.tokenParts()
+	if err != nil {
+		return ret, err
+	}
+
+	if _, ret, err = sjwtCheckAttributesPpt(btoken[0], paramInfo, ppt); err != nil {
+		return ret, err
+	}
+
+	if ret, err = decodePayload(btoken[1], payload); err != nil {
+		return ret, err
+	}
+	claims := passportClaims{}
+	if ret, err = decodePayload(btoken[1], &claims); err != nil {
+		return ret, err
+	}
+	// the certificate is not downloaded for expired tokens
+	if ret, err = v.checkIAT(claims.IAT); err != nil {
+		return ret, err
+	}
+
+	if pubkeyMode == 0 && len(pubkeyVal) == 0 {
+		pubkeyVal = paramInfo
+	}
+	if ecdsaPubKey, ret, err = v.getPubKey(pubkeyVal, pubkeyMode, claims.IAT, claims.signerTN(ppt), &VerificationResult{}); err != nil {
+		return ret, err
+	}
+
+	return SJWTVerifyWithPubKey(btoken[0]+"."+btoken[1], btoken[2], ecdsaPubKey)
+}
+
+// CheckIdentity - implements the verify of identity
+func (v *Verifier) CheckIdentity(identityVal string, pubkeyPath string) (int, error) {
+	return v.CheckIdentityPKMode(identityVal, pubkeyPath, 0)
+}
+
+// CheckFullIdentity - implements the verify of identity with header parameters,
+// the public key is downloaded from the info parameter if pubkeyPath is empty
+func (v *Verifier) CheckFullIdentity(identityVal string, pubkeyPath string) (int, error) {
+	return v.checkFullIdentity(identityVal, pubkeyPath, &VerificationResult{})
+}
+
+// CheckFullIdentityResult - like CheckFullIdentity, but returns the details
+// collected during the verification
+func (v *Verifier) CheckFullIdentityResult(identityVal string, pubkeyPath string) *VerificationResult {
+	tstart := time.Now()
+	res := &VerificationResult{}
+	res.ErrCode, res.Err = v.checkFullIdentity(identityVal, pubkeyPath, res)
+	res.Elapsed = time.Since(tstart)
+	return res
+}
+
+func (v *Verifier) checkFullIdentity(identityVal string, pubkeyPath string, res *VerificationResult) (int, error) {
+	if len(pubkeyPath) == 0 {
+		return v.checkFullIdentityURL(identityVal, res)
+	}
+
+	hdr, ret, err := SJWTParseIdentityHeader(identityVal)
+	if err != nil {
+		return ret, err
+	}
+
+	ret, err = v.checkIdentityPKMode(hdr.Token, pubkeyPath, 0, res)
+	if ret != 0 {
+		return ret, err
+	}
+
+	if !hdr.hasParams() {
+		return SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "missing parameters of the identity header")
+	}
+
+	paramInfo := ""
+	paramInfo, ret, err = hdr.validInfo(SJWTPptShaken)
+	if err != nil {
+		return ret, err
+	}
+	res.Info = paramInfo
+
+	btoken := strings.Split(hdr.Token, ".")
+
+	if len(btoken[0]) == 0 {
+		return SJWTRetErrJSONHdrParse, newError(SJWTRetErrJSONHdrParse, "no json header part")
+	}
+	res.Header, ret, err = sjwtCheckAttributes(btoken[0], paramInfo)
+	return ret, err
+}
+
+// CheckFullIdentityURL - implements the verify of identity using URL
+func (v *Verifier) CheckFullIdentityURL(identityVal string) (int, error) {
+	return v.checkFullIdentityURL(identityVal, &VerificationResult{})
+}
+
+func (v *Verifier) checkFullIdentityURL(identityVal string, res *VerificationResult) (int, error) {
+	var ecdsaPubKey *ecdsa.PublicKey
+	var ret int
+	var err error
+	var pubkey []byte
+
+	hdr, ret, err := SJWTParseIdentityHeader(identityVal)
+	if err != nil {
+		return ret, err
+	}
+	if !hdr.hasParams() {
+		return SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "missing parts of the message header")
+	}
+
+	paramInfo := ""
+	paramInfo, ret, err = hdr.validInfo(SJWTPptShaken)
+	if err != nil {
+		return ret, err
+	}
+	res.Info = paramInfo
+
+	btoken, ret, err := hdr.tokenParts()
+	if err != nil {
+		return ret, err
+	}
+
+	if len(btoken[0]) == 0 {
+		return SJWTRetErrSIPHdrParse, newError(SJWTRetErrSIPHdrParse, "no json header part")
+	}
+
+	// the payload is checked first, the certificate is not downloaded for
+	// expired tokens
+	var payload *SJWTPayload
+	payload, ret, err = v.GetValidPayload(btoken[1])
+	if payload == nil || err != nil {
+		return ret, err
+	}
+	res.setPayload(payload)
+
+	pubkey, ret, err = v.GetURLContent(paramInfo)
+
+	if pubkey == nil {
+		return ret, err
+	}
+
+	ret, err = v.pubKeyVerify(pubkey, payload.IAT, res)
+	if ret != SJWTRetOK {
+		return ret, err
+	}
+	if ret, err = v.checkTNAuthorized(payload.Orig.TN, res); err != nil {
+		return ret, err
+	}
+
+	if ecdsaPubKey, ret, err = SJWTParseECPublicKeyFromPEM(pubkey); err != nil {
+		return ret, err
+	}
+
+	ret, err = SJWTVerifyWithPubKey(btoken[0]+"."+btoken[1], btoken[2], ecdsaPubKey)
+	if err != nil {
+		return ret, err
+	}
+	if v.opts.CheckRCD {
+		if ret, err = v.CheckRCD(payload.RCD, payload.RCDI); err != nil {
+			return ret, err
+		}
+	}
+
+	res.Header, ret, err = sjwtCheckAttributes(btoken[0], paramInfo)
+	return ret, err
+}
+
+// CheckFullIdentityPubKey - implements the verify of identity using public key
+func (v *Verifier) CheckFullIdentityPubKey(identityVal string, pubkeyVal string) (int, error) {
+	return v.checkFullIdentityPubKey(identityVal, pubkeyVal, &VerificationResult{})
+}
+
+// CheckFullIdentityPubKeyResult - like CheckFullIdentityPubKey, but returns
+// the details collected during the verification
+func (v *Verifier) CheckFullIdentityPubKeyResult(identityVal string, pubkeyVal string) *VerificationResult {
+	tstart := time.Now()
+	res := &VerificationResult{}
+	res.ErrCode, res.Err = v.checkFullIdentityPubKey(identityVal, pubkeyVal, res)
+	res.Elapsed = time.Since(tstart)
+	return res
+}
+
+func (v *Verifier) checkFullIdentityPubKey(identityVal string, pubkeyVal string, res *VerificationResult) (int, error) {
+	hdr, ret, err := SJWTParseIdentityHeader(identityVal)
+	if err != nil {
+		return ret, err
+	}
+
+	ret, err = v.checkIdentityPKMode(hdr.Token, pubkeyVal, 1, res)
+	if ret != 0 {
+		return ret, err
+	}
+
+	if !hdr.hasParams() {
+		return SJWTRetOK, nil
+	}
+
+	paramInfo := ""
+	paramInfo, ret, err = hdr.validInfo(SJWTPptShaken)
+	if err != nil {
+		return ret, err
+	}
+	res.Info = paramInfo
+
+	btoken := strings.Split(hdr.Token, ".")
+
+	if len(btoken[0]) == 0 {
+		return SJWTRetOK, nil
+	}
+	res.Header, ret, err = sjwtCheckAttributes(btoken[0], paramInfo)
+	return ret, err
+}
@@ -0,0 +1,383 @@
+package secsipid_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestVerifierPubKeyVerify(t *testing.T) {
+	caOne := NewDummyCA()
+	caTwo := NewDummyCA()
+
+	verifierOne := secsipid.NewVerifier(secsipid.VerifierOptions{
+		CertVerify: 0b00100,
+		RootCAs:    []*x509.Certificate{parseDummyCA(caOne)},
+	})
+	verifierTwo := secsipid.NewVerifier(secsipid.VerifierOptions{
+		CertVerify: 0b00100,
+		RootCAs:    []*x509.Certificate{parseDummyCA(caTwo)},
+	})
+
+	t.Run("Each verifier uses its own trust anchors", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		certOne := caOne.generateValidCert()
+		certTwo := caTwo.generateValidCert()
+
+		errCode, _ := verifierOne.PubKeyVerify(certOne)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		errCode, _ = verifierOne.PubKeyVerify(certTwo)
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertInvalid)
+
+		errCode, _ = verifierTwo.PubKeyVerify(certTwo)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+		errCode, _ = verifierTwo.PubKeyVerify(certOne)
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertInvalid)
+	})
+
+	t.Run("Verifier is not affected by global options", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		cert := caOne.generateValidCert()
+
+		secsipid.SJWTLibOptSetN("CertVerify", 0b00100)
+		secsipid.SJWTLibOptSetS("CertCAFile", "nonexistant.pem")
+		defer secsipid.SJWTLibOptSetN("CertVerify", 0)
+
+		errCode, _ := secsipid.SJWTPubKeyVerify(cert)
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertReadCAFile)
+
+		errCode, _ = verifierOne.PubKeyVerify(cert)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("Verifier uses its own clock", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		cert := caOne.generateValidCert()
+
+		verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+			CertVerify: 0b00001,
+			Now: func() time.Time {
+				return time.Now().AddDate(2, 0, 0)
+			},
+		})
+
+		errCode, err := verifier.PubKeyVerify(cert)
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertExpired)
+		expect(getMsgFromErr(err)).ToBe("certificate expired")
+	})
+
+	t.Run("Concurrent use with global options updates", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		certOne := caOne.generateValidCert()
+		certTwo := caTwo.generateValidCert()
+
+		var wg sync.WaitGroup
+		results := make([]int, 100)
+		for i := 0; i < 100; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				if i%2 == 0 {
+					results[i], _ = verifierOne.PubKeyVerify(certOne)
+				} else {
+					results[i], _ = verifierTwo.PubKeyVerify(certTwo)
+				}
+			}(i)
+			go func(i int) {
+				defer wg.Done()
+				secsipid.SJWTLibOptSetN("CacheExpires", i)
+			}(i)
+		}
+		wg.Wait()
+		secsipid.SJWTLibOptSetN("CacheExpires", 3600)
+
+		for _, ret := range results {
+			expect(ret).ToBe(secsipid.SJWTRetOK)
+		}
+	})
+}
+
+func TestVerifierURLCachedContent(t *testing.T) {
+	expect := expectate.Expect(t)
+
+	// the verifier clock is one year before the wall clock, like for an old
+	// capture, the cached file is aged with the wall clock
+	verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+		CacheDirPath: t.TempDir(),
+		CacheExpire:  3600,
+		Now: func() time.Time {
+			return time.Now().AddDate(-1, 0, 0)
+		},
+	})
+	urlVal := "https://127.0.0.1/cert.pem"
+	verifier.SetURLCachedContent(urlVal, []byte("cert"))
+
+	data, _ := verifier.GetURLCachedContent(urlVal)
+	expect(string(data)).ToBe("cert")
+
+	modTime := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(verifier.GetURLCacheFilePath(urlVal), modTime, modTime)
+	data, _ = verifier.GetURLCachedContent(urlVal)
+	expect(data == nil).ToBe(true)
+}
+
+func TestVerifierGetValidPayload(t *testing.T) {
+	expect := expectate.Expect(t)
+
+	iat := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	payloadJSON, _ := json.Marshal(secsipid.SJWTPayload{
+		ATTest: "A",
+		Dest:   secsipid.SJWTDest{TN: []string{"493044444444"}},
+		IAT:    iat.Unix(),
+		Orig:   secsipid.SJWTOrig{TN: "493055555555"},
+		OrigID: "32c7e392-33fc-11ea-840b-784f435c76a8",
+	})
+	base64Payload := secsipid.SJWTBase64EncodeString(string(payloadJSON))
+
+	newVerifier := func(tnow time.Time) *secsipid.Verifier {
+		return secsipid.NewVerifier(secsipid.VerifierOptions{
+			Expire: 60,
+			Now: func() time.Time {
+				return tnow
+			},
+		})
+	}
+
+	payload, errCode, _ := newVerifier(iat.Add(30 * time.Second)).GetValidPayload(base64Payload)
+	expect(errCode).ToBe(secsipid.SJWTRetOK)
+	expect(payload.OrigID).ToBe("32c7e392-33fc-11ea-840b-784f435c76a8")
+
+	payload, errCode, _ = newVerifier(iat.Add(90 * time.Second)).GetValidPayload(base64Payload)
+	expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadIATExpired)
+	expect(payload).ToBe((*secsipid.SJWTPayload)(nil))
+}
+
+type CheckIATTest struct {
+	expire        int
+	iatFutureSkew *int
+	tnowOffset    time.Duration
+
+	expectedErrCode int
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestVerifierCheckIAT(t *testing.T) {
+	iat := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	payloadJSON, _ := json.Marshal(secsipid.SJWTPayload{
+		ATTest: "A",
+		Dest:   secsipid.SJWTDest{TN: []string{"493044444444"}},
+		IAT:    iat.Unix(),
+		Orig:   secsipid.SJWTOrig{TN: "493055555555"},
+	})
+	base64Payload := secsipid.SJWTBase64EncodeString(string(payloadJSON))
+
+	testCases := map[string]CheckIATTest{
+		"OK with iat in the past within expire": {
+			expire:          300,
+			tnowOffset:      200 * time.Second,
+			expectedErrCode: secsipid.SJWTRetOK,
+		},
+		"OK with iat in the future within default skew": {
+			tnowOffset:      -30 * time.Second,
+			expectedErrCode: secsipid.SJWTRetOK,
+		},
+		"OK with iat in the future within skew": {
+			iatFutureSkew:   intPtr(300),
+			tnowOffset:      -200 * time.Second,
+			expectedErrCode: secsipid.SJWTRetOK,
+		},
+		"ErrJSONPayloadIATExpired with default expire": {
+			tnowOffset:      90 * time.Second,
+			expectedErrCode: secsipid.SJWTRetErrJSONPayloadIATExpired,
+		},
+		"ErrJSONPayloadIATFuture with default skew": {
+			tnowOffset:      -90 * time.Second,
+			expectedErrCode: secsipid.SJWTRetErrJSONPayloadIATFuture,
+		},
+		"OK with iat at the current time and zero skew": {
+			iatFutureSkew:   intPtr(0),
+			expectedErrCode: secsipid.SJWTRetOK,
+		},
+		"ErrJSONPayloadIATFuture with zero skew": {
+			iatFutureSkew:   intPtr(0),
+			tnowOffset:      -1 * time.Second,
+			expectedErrCode: secsipid.SJWTRetErrJSONPayloadIATFuture,
+		},
+		"ErrJSONPayloadIATFuture beyond skew": {
+			iatFutureSkew:   intPtr(10),
+			tnowOffset:      -20 * time.Second,
+			expectedErrCode: secsipid.SJWTRetErrJSONPayloadIATFuture,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+				Expire:        testCase.expire,
+				IATFutureSkew: testCase.iatFutureSkew,
+				Now: func() time.Time {
+					return iat.Add(testCase.tnowOffset)
+				},
+			})
+			_, errCode, err := verifier.GetValidPayload(base64Payload)
+
+			expect(errCode).ToBe(testCase.expectedErrCode)
+			expect(secsipid.SJWTErrorCode(err)).ToBe(testCase.expectedErrCode)
+		})
+	}
+
+	t.Run("ErrJSONPayloadIATFuture with zero skew library option", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		futurePayloadJSON, _ := json.Marshal(secsipid.SJWTPayload{
+			ATTest: "A",
+			Dest:   secsipid.SJWTDest{TN: []string{"493044444444"}},
+			IAT:    time.Now().Add(30 * time.Second).Unix(),
+			Orig:   secsipid.SJWTOrig{TN: "493055555555"},
+		})
+		futurePayload := secsipid.SJWTBase64EncodeString(string(futurePayloadJSON))
+
+		_, errCode, _ := secsipid.SJWTGetValidPayload(futurePayload, 60)
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+
+		secsipid.SJWTLibOptSetN("IATFutureSkew", 0)
+		defer secsipid.SJWTLibOptSetN("IATFutureSkew", -1)
+		_, errCode, _ = secsipid.SJWTGetValidPayload(futurePayload, 60)
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadIATFuture)
+	})
+}
+
+func TestVerifierCertTimeIAT(t *testing.T) {
+	ca := NewDummyCA()
+	prvKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	// the certificate expires in ten days, the check is done in twelve days
+	// for a token signed in nine days
+	tnow := time.Now()
+	certTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2021),
+		Subject:      pkix.Name{Organization: []string{"Bar, Inc."}},
+		NotBefore:    tnow,
+		NotAfter:     tnow.AddDate(0, 0, 10),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	certBytes, _ := x509.CreateCertificate(rand.Reader, certTmpl, ca.ca, &prvKey.PublicKey, ca.caPrivKey)
+	certPEM, _ := pemEncode(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+	certPath := path.Join(t.TempDir(), "cert.pem")
+	os.WriteFile(certPath, certPEM, 0600)
+
+	header := secsipid.SJWTHeader{Alg: "ES256", Ppt: "shaken", Typ: "passport", X5u: "https://127.0.0.1/cert.pem"}
+	payload := secsipid.SJWTPayload{
+		ATTest: "A",
+		Dest:   secsipid.SJWTDest{TN: []string{"15551234567"}},
+		IAT:    tnow.AddDate(0, 0, 9).Unix(),
+		Orig:   secsipid.SJWTOrig{TN: "15559876543"},
+		OrigID: "32c7e392-33fc-11ea-840b-784f435c76a8",
+	}
+	token := secsipid.SJWTEncode(header, payload, prvKey)
+	identity := token + ";info=<https://127.0.0.1/cert.pem>;alg=ES256;ppt=shaken"
+
+	newVerifier := func(certTimeIAT bool) *secsipid.Verifier {
+		return secsipid.NewVerifier(secsipid.VerifierOptions{
+			CertVerify:  0b00101,
+			RootCAs:     []*x509.Certificate{parseDummyCA(ca)},
+			Expire:      4 * 24 * 3600,
+			CertTimeIAT: certTimeIAT,
+			Now: func() time.Time {
+				return tnow.AddDate(0, 0, 12)
+			},
+		})
+	}
+
+	t.Run("ErrCertExpired with current time", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		errCode, _ := newVerifier(false).CheckFullIdentity(identity, certPath)
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrCertExpired)
+	})
+
+	t.Run("OK with time of iat", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		errCode, _ := newVerifier(true).CheckFullIdentity(identity, certPath)
+
+		expect(errCode).ToBe(secsipid.SJWTRetOK)
+	})
+}
+
+func TestVerifierCheckPASSporT(t *testing.T) {
+	var hitCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hitCount, 1)
+		w.Write([]byte("cert"))
+	}))
+	defer server.Close()
+
+	x5u := server.URL + "/cert.pem"
+	verifier := secsipid.NewVerifier(secsipid.VerifierOptions{
+		Expire:  60,
+		Timeout: 5,
+	})
+	jsonHeader := `{"alg":"ES256","ppt":"rph","typ":"passport","x5u":"` + x5u + `"}`
+	identity := func(jsonPayload string) string {
+		return secsipid.SJWTBase64EncodeString(jsonHeader) + "." + secsipid.SJWTBase64EncodeString(jsonPayload) +
+			".c2lnbmF0dXJl;info=<" + x5u + ">;alg=ES256;ppt=rph"
+	}
+
+	t.Run("ErrJSONPayloadIATExpired without downloading the certificate", func(t *testing.T) {
+		expect := expectate.Expect(t)
+		atomic.StoreInt32(&hitCount, 0)
+
+		jsonPayload := fmt.Sprintf(`{"dest":{"tn":["493044444444"]},"iat":%d,"orig":{"tn":"493055555555"},"rph":{"auth":["ets.0"]}}`,
+			time.Now().Unix()-120)
+		_, errCode, _ := verifier.CheckRPHIdentity(identity(jsonPayload), "", "")
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadIATExpired)
+		expect(atomic.LoadInt32(&hitCount)).ToBe(int32(0))
+	})
+
+	t.Run("ErrJSONPayloadParse with invalid div claim without downloading the certificate", func(t *testing.T) {
+		expect := expectate.Expect(t)
+		atomic.StoreInt32(&hitCount, 0)
+
+		jsonPayload := fmt.Sprintf(`{"dest":{"tn":["493044444444"]},"div":"493066666666","iat":%d,"orig":{"tn":"493055555555"},"rph":{"auth":["ets.0"]}}`,
+			time.Now().Unix())
+		_, errCode, _ := verifier.CheckRPHIdentity(identity(jsonPayload), "", "")
+
+		expect(errCode).ToBe(secsipid.SJWTRetErrJSONPayloadParse)
+		expect(atomic.LoadInt32(&hitCount)).ToBe(int32(0))
+	})
+}
+
+func parseDummyCA(gen DummyCertGenerator) *x509.Certificate {
+	block, _ := pem.Decode(gen.caPEMBytes)
+	cert, _ := x509.ParseCertificate(block.Bytes)
+	return cert
+}
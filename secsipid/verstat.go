@@ -0,0 +1,83 @@
+package secsipid
+
+import (
+	"strings"
+)
+
+// verstat values (ATIS-1000074, 3GPP TS 24.229)
+const (
+	SJWTVerstatPassed = "TN-Validation-Passed"
+	SJWTVerstatFailed = "TN-Validation-Failed"
+	SJWTVerstatNoTN   = "No-TN-Validation"
+)
+
+// SJWTGetVerstat - return the verstat value for the SJWTRet* code of the
+// verification and the attestation level of the PASSporT
+//
+// A successful verification results in TN-Validation-Passed for any
+// attestation level (A, B or C), as the verstat reports the result of the
+// signature verification (ATIS-1000074) and the attestation level is given
+// separately in the attest claim, so attestVal does not change the value. A
+// missing Identity header results in No-TN-Validation, any other failure in
+// TN-Validation-Failed.
+func SJWTGetVerstat(errCode int, attestVal string) string {
+	if errCode == SJWTRetErrSIPHdrEmpty {
+		return SJWTVerstatNoTN
+	}
+	if errCode != SJWTRetOK {
+		return SJWTVerstatFailed
+	}
+	return SJWTVerstatPassed
+}
+
+// SJWTSetVerstat - add the verstat parameter to the URI of a From or
+// P-Asserted-Identity header value, replacing an existing verstat parameter
+//
+// The header value can be in name-addr or addr-spec format, the latter
+// being converted to name-addr, so the parameter is not taken as header
+// parameter.
+func SJWTSetVerstat(hdrVal string, verstat string) string {
+	var uri, prefix, suffix string
+
+	hdrVal = strings.TrimSpace(hdrVal)
+	if lt := strings.Index(hdrVal, "<"); lt >= 0 {
+		gt := strings.Index(hdrVal[lt:], ">")
+		if gt < 0 {
+			return hdrVal
+		}
+		prefix = hdrVal[:lt]
+		uri = hdrVal[lt+1 : lt+gt]
+		suffix = hdrVal[lt+gt+1:]
+	} else {
+		// addr-spec - parameters after the URI are header parameters
+		if sc := strings.Index(hdrVal, ";"); sc >= 0 {
+			uri = hdrVal[:sc]
+			suffix = hdrVal[sc:]
+		} else {
+			uri = hdrVal
+		}
+	}
+
+	uriHeaders := ""
+	if qm := strings.Index(uri, "?"); qm >= 0 {
+		uriHeaders = uri[qm:]
+		uri = uri[:qm]
+	}
+
+	params := strings.Split(uri, ";")
+	uri = params[0]
+	for _, param := range params[1:] {
+		if strings.HasPrefix(strings.ToLower(param), "verstat=") || strings.ToLower(param) == "verstat" {
+			continue
+		}
+		uri += ";" + param
+	}
+	uri += ";verstat=" + verstat + uriHeaders
+
+	return prefix + "<" + uri + ">" + suffix
+}
+
+// Verstat - return the verstat value for the result
+func (r *VerificationResult) Verstat() string {
+	return SJWTGetVerstat(r.ErrCode, r.Attest)
+}
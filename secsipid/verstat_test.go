@@ -0,0 +1,64 @@
+package secsipid_test
+
+import (
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestGetVerstat(t *testing.T) {
+	expect := expectate.Expect(t)
+
+	expect(secsipid.SJWTGetVerstat(secsipid.SJWTRetOK, "A")).ToBe(secsipid.SJWTVerstatPassed)
+	expect(secsipid.SJWTGetVerstat(secsipid.SJWTRetOK, "B")).ToBe(secsipid.SJWTVerstatPassed)
+	expect(secsipid.SJWTGetVerstat(secsipid.SJWTRetOK, "C")).ToBe(secsipid.SJWTVerstatPassed)
+	expect(secsipid.SJWTGetVerstat(secsipid.SJWTRetErrSIPHdrEmpty, "")).ToBe(secsipid.SJWTVerstatNoTN)
+	expect(secsipid.SJWTGetVerstat(secsipid.SJWTRetErrJSONSignatureInvalid, "A")).ToBe(secsipid.SJWTVerstatFailed)
+	expect(secsipid.SJWTGetVerstat(secsipid.SJWTRetErrCertExpired, "A")).ToBe(secsipid.SJWTVerstatFailed)
+}
+
+type SetVerstatTest struct {
+	hdrVal string
+
+	expectedHdrVal string
+}
+
+func TestSetVerstat(t *testing.T) {
+	runTest := func(t *testing.T, testCase SetVerstatTest) {
+		expect := expectate.Expect(t)
+
+		hdrVal := secsipid.SJWTSetVerstat(testCase.hdrVal, secsipid.SJWTVerstatPassed)
+
+		expect(hdrVal).ToBe(testCase.expectedHdrVal)
+	}
+
+	testCases := map[string]SetVerstatTest{
+		"name-addr with display name and tag": {
+			hdrVal:         `"Alice" <sip:+493055555555@127.0.0.1;user=phone>;tag=abc`,
+			expectedHdrVal: `"Alice" <sip:+493055555555@127.0.0.1;user=phone;verstat=TN-Validation-Passed>;tag=abc`,
+		},
+		"name-addr with tel URI": {
+			hdrVal:         `<tel:+493055555555>`,
+			expectedHdrVal: `<tel:+493055555555;verstat=TN-Validation-Passed>`,
+		},
+		"addr-spec with header parameters": {
+			hdrVal:         `sip:+493055555555@127.0.0.1;tag=abc`,
+			expectedHdrVal: `<sip:+493055555555@127.0.0.1;verstat=TN-Validation-Passed>;tag=abc`,
+		},
+		"replaces existing verstat": {
+			hdrVal:         `<sip:+493055555555@127.0.0.1;verstat=TN-Validation-Failed;user=phone>`,
+			expectedHdrVal: `<sip:+493055555555@127.0.0.1;user=phone;verstat=TN-Validation-Passed>`,
+		},
+		"keeps URI headers at the end": {
+			hdrVal:         `<sip:+493055555555@127.0.0.1?X-Hdr=1>`,
+			expectedHdrVal: `<sip:+493055555555@127.0.0.1;verstat=TN-Validation-Passed?X-Hdr=1>`,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			runTest(t, testCase)
+		})
+	}
+}